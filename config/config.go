@@ -1,6 +1,9 @@
 package config
 
-import "os"
+import (
+	"os"
+	"time"
+)
 
 // AppConfig contains the application configuration
 type AppConfig struct {
@@ -9,6 +12,160 @@ type AppConfig struct {
 	IPStackKey      string
 	Version         string
 	AppHost         string
+	// IdempotencyWindow is the number of seconds responses are cached for an `Idempotency-Key`
+	IdempotencyWindow int
+	// FileStoragePath is the directory files attached to resource documents are stored in
+	FileStoragePath string
+	// CacheBackend is where project details and resource definitions are cached: `memory`, `redis` or `none`
+	CacheBackend string
+	// CacheTTL is the number of seconds project details and resource definitions are cached for
+	CacheTTL int
+	// JSONSnapshotRetention is the number of automatic snapshots kept for each JSON tree root key
+	JSONSnapshotRetention int
+	// JSONDeleteGracePeriod is the number of seconds the snapshot of a deleted root key is kept
+	JSONDeleteGracePeriod int
+	// ChangeBus is how changes are shared between instances for streams: `redis` or `postgres`
+	ChangeBus string
+	// ChangeLogRetention is the number of seconds changes are kept in the change log before they are compacted
+	ChangeLogRetention int
+	// HookWorkers is the number of web hook delivery workers run by each instance
+	HookWorkers int
+	// HookTimeout is the number of seconds a web hook receiver has to respond
+	HookTimeout int
+	// HookMaxAttempts is the number of attempts of a web hook delivery before it is given up
+	HookMaxAttempts int
+}
+
+const (
+	// CacheMemory caches in process, for single instance deployments
+	CacheMemory = "memory"
+	// CacheRedis caches in redis, shared by all instances
+	CacheRedis = "redis"
+	// CacheNone disables caching
+	CacheNone = "none"
+)
+
+const (
+	// ChangeBusRedis publishes the changes made through the API of each instance with redis pub/sub
+	ChangeBusRedis = "redis"
+	// ChangeBusPostgres notifies every change of resource documents and JSON trees with postgres triggers, including
+	// writes made outside of the API
+	ChangeBusPostgres = "postgres"
+)
+
+// GetChangeBus returns the configured change bus, `redis` by default
+func (c *AppConfig) GetChangeBus() string {
+	if c.ChangeBus == "" {
+		return ChangeBusRedis
+	}
+	return c.ChangeBus
+}
+
+// DefaultChangeLogRetention is used if the `ChangeLogRetention` is not configured
+const DefaultChangeLogRetention = 30 * 24 * time.Hour
+
+// GetChangeLogRetention returns the configured retention of the change log as a duration
+func (c *AppConfig) GetChangeLogRetention() time.Duration {
+	if c.ChangeLogRetention <= 0 {
+		return DefaultChangeLogRetention
+	}
+	return time.Duration(c.ChangeLogRetention) * time.Second
+}
+
+// DefaultHookWorkers is used if the `HookWorkers` is not configured
+const DefaultHookWorkers = 4
+
+// GetHookWorkers returns the configured number of web hook delivery workers
+func (c *AppConfig) GetHookWorkers() int {
+	if c.HookWorkers <= 0 {
+		return DefaultHookWorkers
+	}
+	return c.HookWorkers
+}
+
+// DefaultHookTimeout is used if the `HookTimeout` is not configured
+const DefaultHookTimeout = 10 * time.Second
+
+// GetHookTimeout returns the configured web hook timeout as a duration
+func (c *AppConfig) GetHookTimeout() time.Duration {
+	if c.HookTimeout <= 0 {
+		return DefaultHookTimeout
+	}
+	return time.Duration(c.HookTimeout) * time.Second
+}
+
+// DefaultHookMaxAttempts is used if the `HookMaxAttempts` is not configured
+const DefaultHookMaxAttempts = 5
+
+// GetHookMaxAttempts returns the configured number of attempts of a web hook delivery
+func (c *AppConfig) GetHookMaxAttempts() int {
+	if c.HookMaxAttempts <= 0 {
+		return DefaultHookMaxAttempts
+	}
+	return c.HookMaxAttempts
+}
+
+// DefaultCacheTTL is used if the `CacheTTL` is not configured
+const DefaultCacheTTL = time.Minute
+
+// GetCacheBackend returns the configured cache backend, `memory` by default
+func (c *AppConfig) GetCacheBackend() string {
+	if c.CacheBackend == "" {
+		return CacheMemory
+	}
+	return c.CacheBackend
+}
+
+// GetCacheTTL returns the configured cache ttl as a duration
+func (c *AppConfig) GetCacheTTL() time.Duration {
+	if c.CacheTTL <= 0 {
+		return DefaultCacheTTL
+	}
+	return time.Duration(c.CacheTTL) * time.Second
+}
+
+// DefaultIdempotencyWindow is used if the `IdempotencyWindow` is not configured
+const DefaultIdempotencyWindow = 24 * time.Hour
+
+// GetIdempotencyWindow returns the configured idempotency window as a duration
+func (c *AppConfig) GetIdempotencyWindow() time.Duration {
+	if c.IdempotencyWindow <= 0 {
+		return DefaultIdempotencyWindow
+	}
+	return time.Duration(c.IdempotencyWindow) * time.Second
+}
+
+// DefaultFileStoragePath is used if the `FileStoragePath` is not configured
+const DefaultFileStoragePath = "/var/lib/machinable/files"
+
+// GetFileStoragePath returns the configured file storage directory
+func (c *AppConfig) GetFileStoragePath() string {
+	if c.FileStoragePath == "" {
+		return DefaultFileStoragePath
+	}
+	return c.FileStoragePath
+}
+
+// DefaultJSONSnapshotRetention is used if the `JSONSnapshotRetention` is not configured
+const DefaultJSONSnapshotRetention = 10
+
+// GetJSONSnapshotRetention returns the configured number of automatic snapshots kept for each root key
+func (c *AppConfig) GetJSONSnapshotRetention() int {
+	if c.JSONSnapshotRetention <= 0 {
+		return DefaultJSONSnapshotRetention
+	}
+	return c.JSONSnapshotRetention
+}
+
+// DefaultJSONDeleteGracePeriod is used if the `JSONDeleteGracePeriod` is not configured
+const DefaultJSONDeleteGracePeriod = 7 * 24 * time.Hour
+
+// GetJSONDeleteGracePeriod returns the configured grace period of deleted root keys as a duration
+func (c *AppConfig) GetJSONDeleteGracePeriod() time.Duration {
+	if c.JSONDeleteGracePeriod <= 0 {
+		return DefaultJSONDeleteGracePeriod
+	}
+	return time.Duration(c.JSONDeleteGracePeriod) * time.Second
 }
 
 // LoadSecrets loads secret config values from env vars
@@ -21,6 +178,7 @@ func (c *AppConfig) LoadSecrets() {
 // LoadEnv loads config values from env vars
 func (c *AppConfig) LoadEnv() {
 	c.Version = getEnv("VERSION", c.Version)
+	c.FileStoragePath = getEnv("FILE_STORAGE_PATH", c.FileStoragePath)
 }
 
 func getEnv(key, fallback string) string {
@@ -0,0 +1,246 @@
+package cache
+
+import (
+	"bytes"
+	"encoding/gob"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/machinable/machinable/dsi/errors"
+	"github.com/machinable/machinable/dsi/interfaces"
+	"github.com/machinable/machinable/dsi/models"
+)
+
+// Store is a key/value store of cached values. Values are stored as copies, so callers can modify the values they
+// retrieve without affecting the cache.
+type Store interface {
+	// Get decodes the cached value of the key into `v`, returning false if the key is not cached
+	Get(key string, v interface{}) bool
+	// Set caches the value of the key
+	Set(key string, v interface{})
+	// Delete removes the keys from the cache
+	Delete(keys ...string)
+}
+
+// New returns a pointer to a new `Datastore`, caching the reads of `store` in `cache`
+func New(store interfaces.Datastore, cache Store) *Datastore {
+	return &Datastore{
+		Datastore: store,
+		cache:     cache,
+	}
+}
+
+// Datastore wraps a datastore to cache the project details, web hooks and resource definitions which are read on
+// every project request. Writes through the `Datastore` invalidate the cached values they change, including changes
+// of tiers, whose limits are part of the project details.
+type Datastore struct {
+	interfaces.Datastore
+	cache Store
+}
+
+// projectsGenerationKey is the cache key of the generation of the cached project details. Changing the generation
+// invalidates the details of every project.
+const projectsGenerationKey = "projects-generation"
+
+func (d *Datastore) projectKey(slug string) string {
+	var generation string
+	d.cache.Get(projectsGenerationKey, &generation)
+	return fmt.Sprintf("project:%s:%s", generation, slug)
+}
+
+func projectSlugKey(projectID string) string {
+	return fmt.Sprintf("project-slug:%s", projectID)
+}
+
+func hooksKey(projectID string) string {
+	return fmt.Sprintf("hooks:%s", projectID)
+}
+
+func definitionKey(projectID, pathName string) string {
+	return fmt.Sprintf("definition:%s:%s", projectID, pathName)
+}
+
+// encode serializes cached values with gob, as the JSON encoding of some models is not symmetric
+func encode(v interface{}) ([]byte, error) {
+	var buf bytes.Buffer
+	err := gob.NewEncoder(&buf).Encode(v)
+	return buf.Bytes(), err
+}
+
+func decode(b []byte, v interface{}) error {
+	return gob.NewDecoder(bytes.NewReader(b)).Decode(v)
+}
+
+/* PROJECTS */
+
+// GetProjectDetailBySlug retrieves the project detail from the cache, or the datastore if it is not cached
+func (d *Datastore) GetProjectDetailBySlug(slug string) (*models.ProjectDetail, error) {
+	project := &models.ProjectDetail{}
+	if d.cache.Get(d.projectKey(slug), project) {
+		return project, nil
+	}
+
+	project, err := d.Datastore.GetProjectDetailBySlug(slug)
+	if err != nil {
+		return nil, err
+	}
+
+	d.cache.Set(d.projectKey(slug), project)
+	// projects are updated by ID
+	d.cache.Set(projectSlugKey(project.ID), slug)
+
+	return project, nil
+}
+
+// invalidateProject removes the cached project detail of the project ID
+func (d *Datastore) invalidateProject(projectID string) {
+	var slug string
+	if d.cache.Get(projectSlugKey(projectID), &slug) {
+		d.cache.Delete(d.projectKey(slug), projectSlugKey(projectID))
+	}
+}
+
+// UpdateProject updates the project and invalidates its cached detail
+func (d *Datastore) UpdateProject(projectID, userID string, project *models.Project) (*models.Project, error) {
+	defer d.invalidateProject(projectID)
+	return d.Datastore.UpdateProject(projectID, userID, project)
+}
+
+// UpdateProjectUserRegistration updates the project user registration and invalidates its cached detail
+func (d *Datastore) UpdateProjectUserRegistration(projectID, userID string, registration bool) (*models.Project, error) {
+	defer d.invalidateProject(projectID)
+	return d.Datastore.UpdateProjectUserRegistration(projectID, userID, registration)
+}
+
+// DeleteProject deletes the project and invalidates its cached detail and web hooks
+func (d *Datastore) DeleteProject(projectID string) error {
+	defer d.invalidateProject(projectID)
+	defer d.cache.Delete(hooksKey(projectID))
+	return d.Datastore.DeleteProject(projectID)
+}
+
+/* TIERS */
+
+// UpdateTier updates the tier and invalidates the cached detail of every project, which includes the limits of the tier
+// of the project owner
+func (d *Datastore) UpdateTier(tier *models.Tier) error {
+	defer d.cache.Set(projectsGenerationKey, strconv.FormatInt(time.Now().UnixNano(), 36))
+	return d.Datastore.UpdateTier(tier)
+}
+
+// UpdateUserTier changes the tier of the user and invalidates the cached details of the projects of the user
+func (d *Datastore) UpdateUserTier(userID, tierID string) error {
+	defer d.invalidateUserProjects(userID)
+	return d.Datastore.UpdateUserTier(userID, tierID)
+}
+
+// invalidateUserProjects removes the cached project details of the projects of the user
+func (d *Datastore) invalidateUserProjects(userID string) {
+	projects, err := d.Datastore.ListUserProjects(userID)
+	if err != nil {
+		return
+	}
+
+	for _, project := range projects {
+		d.cache.Delete(d.projectKey(project.Slug), projectSlugKey(project.ID))
+	}
+}
+
+/* WEB HOOKS */
+
+// ListHooks retrieves the project web hooks from the cache, or the datastore if they are not cached
+func (d *Datastore) ListHooks(projectID string) ([]*models.WebHook, *errors.DatastoreError) {
+	hooks := make([]*models.WebHook, 0)
+	if d.cache.Get(hooksKey(projectID), &hooks) {
+		return hooks, nil
+	}
+
+	hooks, err := d.Datastore.ListHooks(projectID)
+	if err != nil {
+		return nil, err
+	}
+
+	d.cache.Set(hooksKey(projectID), hooks)
+
+	return hooks, nil
+}
+
+// AddHook saves the web hook and invalidates the cached project web hooks
+func (d *Datastore) AddHook(projectID string, hook *models.WebHook) *errors.DatastoreError {
+	defer d.cache.Delete(hooksKey(projectID))
+	return d.Datastore.AddHook(projectID, hook)
+}
+
+// UpdateHook updates the web hook and invalidates the cached project web hooks
+func (d *Datastore) UpdateHook(projectID, hookID string, hook *models.WebHook) *errors.DatastoreError {
+	defer d.cache.Delete(hooksKey(projectID))
+	return d.Datastore.UpdateHook(projectID, hookID, hook)
+}
+
+// DeleteHook deletes the web hook and invalidates the cached project web hooks
+func (d *Datastore) DeleteHook(projectID, hookID string) *errors.DatastoreError {
+	defer d.cache.Delete(hooksKey(projectID))
+	return d.Datastore.DeleteHook(projectID, hookID)
+}
+
+/* RESOURCE DEFINITIONS */
+
+// GetDefinitionByPathName retrieves the definition from the cache, or the datastore if it is not cached
+func (d *Datastore) GetDefinitionByPathName(projectID, pathName string) (*models.ResourceDefinition, *errors.DatastoreError) {
+	def := &models.ResourceDefinition{}
+	if d.cache.Get(definitionKey(projectID, pathName), def) {
+		return def, nil
+	}
+
+	def, err := d.Datastore.GetDefinitionByPathName(projectID, pathName)
+	if err != nil {
+		return nil, err
+	}
+
+	d.cache.Set(definitionKey(projectID, pathName), def)
+
+	return def, nil
+}
+
+// definitionKeys returns the cache keys of the definitions of the project
+func (d *Datastore) definitionKeys(projectID string) []string {
+	defs, err := d.Datastore.ListDefinitions(projectID)
+	if err != nil {
+		return nil
+	}
+
+	keys := make([]string, len(defs))
+	for i, def := range defs {
+		keys[i] = definitionKey(projectID, def.PathName)
+	}
+	return keys
+}
+
+// AddDefinition saves the definition, invalidating any cached definition of the same path
+func (d *Datastore) AddDefinition(projectID string, def *models.ResourceDefinition) (string, *errors.DatastoreError) {
+	defer d.cache.Delete(definitionKey(projectID, def.PathName))
+	return d.Datastore.AddDefinition(projectID, def)
+}
+
+// UpdateDefinition updates the definition and invalidates the cached definition
+func (d *Datastore) UpdateDefinition(projectID, definitionID string, def *models.ResourceDefinition) *errors.DatastoreError {
+	if existing, err := d.Datastore.GetDefinition(projectID, definitionID); err == nil {
+		defer d.cache.Delete(definitionKey(projectID, existing.PathName))
+	}
+	return d.Datastore.UpdateDefinition(projectID, definitionID, def)
+}
+
+// DeleteDefinition deletes the definition and invalidates the cached definition
+func (d *Datastore) DeleteDefinition(projectID, definitionID string) *errors.DatastoreError {
+	if existing, err := d.Datastore.GetDefinition(projectID, definitionID); err == nil {
+		defer d.cache.Delete(definitionKey(projectID, existing.PathName))
+	}
+	return d.Datastore.DeleteDefinition(projectID, definitionID)
+}
+
+// DropProjectResources drops the project resources and invalidates the cached definitions
+func (d *Datastore) DropProjectResources(projectID string) *errors.DatastoreError {
+	defer d.cache.Delete(d.definitionKeys(projectID)...)
+	return d.Datastore.DropProjectResources(projectID)
+}
@@ -0,0 +1,111 @@
+package cache
+
+import (
+	"testing"
+	"time"
+
+	"github.com/machinable/machinable/dsi/errors"
+	"github.com/machinable/machinable/dsi/interfaces"
+	"github.com/machinable/machinable/dsi/models"
+	"github.com/stretchr/testify/assert"
+)
+
+// countingStore counts the definition reads which reach the datastore
+type countingStore struct {
+	interfaces.Datastore
+	reads int
+	def   *models.ResourceDefinition
+}
+
+func (s *countingStore) GetDefinitionByPathName(projectID, pathName string) (*models.ResourceDefinition, *errors.DatastoreError) {
+	s.reads++
+	def := *s.def
+	return &def, nil
+}
+
+func (s *countingStore) GetDefinition(projectID, definitionID string) (*models.ResourceDefinition, *errors.DatastoreError) {
+	def := *s.def
+	return &def, nil
+}
+
+func (s *countingStore) UpdateDefinition(projectID, definitionID string, def *models.ResourceDefinition) *errors.DatastoreError {
+	s.def = def
+	return nil
+}
+
+func TestDefinitionCache(t *testing.T) {
+	store := &countingStore{def: &models.ResourceDefinition{ID: "1", PathName: "dogs"}}
+	cached := New(store, NewMemory(time.Minute))
+
+	def, err := cached.GetDefinitionByPathName("project", "dogs")
+	assert.Nil(t, err)
+	assert.Equal(t, "1", def.ID)
+
+	// cached values are copies
+	def.Upsert = true
+	def, _ = cached.GetDefinitionByPathName("project", "dogs")
+	assert.False(t, def.Upsert)
+	assert.Equal(t, 1, store.reads)
+
+	assert.Nil(t, cached.UpdateDefinition("project", "1", &models.ResourceDefinition{ID: "1", PathName: "dogs", Upsert: true}))
+	def, _ = cached.GetDefinitionByPathName("project", "dogs")
+	assert.True(t, def.Upsert)
+	assert.Equal(t, 2, store.reads)
+}
+
+// tierStore serves the details of a project with the limits of the tier of its owner
+type tierStore struct {
+	interfaces.Datastore
+	tiers map[string]*models.Tier
+	owner string
+}
+
+func (s *tierStore) GetProjectDetailBySlug(slug string) (*models.ProjectDetail, error) {
+	tier := s.tiers[s.owner]
+	return &models.ProjectDetail{ID: "project", Slug: slug, Requests: tier.Requests, Storage: tier.Storage}, nil
+}
+
+func (s *tierStore) ListUserProjects(userID string) ([]*models.Project, error) {
+	return []*models.Project{{ID: "project", Slug: "pets"}}, nil
+}
+
+func (s *tierStore) UpdateTier(tier *models.Tier) error {
+	*s.tiers[tier.ID] = *tier
+	return nil
+}
+
+func (s *tierStore) UpdateUserTier(userID, tierID string) error {
+	s.owner = tierID
+	return nil
+}
+
+func TestProjectTierInvalidation(t *testing.T) {
+	store := &tierStore{
+		tiers: map[string]*models.Tier{"free": {ID: "free", Requests: 10}, "paid": {ID: "paid", Requests: 100}},
+		owner: "free",
+	}
+	cached := New(store, NewMemory(time.Minute))
+
+	project, _ := cached.GetProjectDetailBySlug("pets")
+	assert.Equal(t, 10, project.Requests)
+
+	assert.Nil(t, cached.UpdateTier(&models.Tier{ID: "free", Requests: 20}))
+	project, _ = cached.GetProjectDetailBySlug("pets")
+	assert.Equal(t, 20, project.Requests)
+
+	assert.Nil(t, cached.UpdateUserTier("jane", "paid"))
+	project, _ = cached.GetProjectDetailBySlug("pets")
+	assert.Equal(t, 100, project.Requests)
+}
+
+func TestMemoryExpiry(t *testing.T) {
+	m := NewMemory(time.Millisecond)
+	m.Set("key", "value")
+
+	var v string
+	assert.True(t, m.Get("key", &v))
+	assert.Equal(t, "value", v)
+
+	time.Sleep(5 * time.Millisecond)
+	assert.False(t, m.Get("key", &v))
+}
@@ -0,0 +1,72 @@
+package cache
+
+import (
+	"log"
+	"sync"
+	"time"
+)
+
+type memoryEntry struct {
+	value   []byte
+	expires time.Time
+}
+
+// NewMemory returns a pointer to a new `Memory` store, values expire after `ttl`
+func NewMemory(ttl time.Duration) *Memory {
+	return &Memory{
+		ttl:     ttl,
+		entries: map[string]memoryEntry{},
+	}
+}
+
+// Memory is an in-process `Store`. Invalidations are not shared between processes, so values of other instances
+// can be stale for up to the ttl.
+type Memory struct {
+	ttl     time.Duration
+	mu      sync.RWMutex
+	entries map[string]memoryEntry
+}
+
+// Get decodes the cached value of the key
+func (m *Memory) Get(key string, v interface{}) bool {
+	m.mu.RLock()
+	entry, ok := m.entries[key]
+	m.mu.RUnlock()
+
+	if !ok || time.Now().After(entry.expires) {
+		return false
+	}
+
+	return decode(entry.value, v) == nil
+}
+
+// Set caches the value of the key, expired entries are removed as new values are cached
+func (m *Memory) Set(key string, v interface{}) {
+	b, err := encode(v)
+	if err != nil {
+		log.Println("could not encode cache value ", err.Error())
+		return
+	}
+
+	now := time.Now()
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for k, entry := range m.entries {
+		if now.After(entry.expires) {
+			delete(m.entries, k)
+		}
+	}
+	m.entries[key] = memoryEntry{value: b, expires: now.Add(m.ttl)}
+}
+
+// Delete removes the keys
+func (m *Memory) Delete(keys ...string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, key := range keys {
+		delete(m.entries, key)
+	}
+}
@@ -0,0 +1,67 @@
+package cache
+
+import (
+	"log"
+	"time"
+
+	"github.com/go-redis/redis"
+)
+
+// redisKeyPrefix namespaces the cached values in redis
+const redisKeyPrefix = "dsicache:"
+
+// NewRedis returns a pointer to a new `Redis` store, values expire after `ttl`
+func NewRedis(client redis.UniversalClient, ttl time.Duration) *Redis {
+	return &Redis{
+		client: client,
+		ttl:    ttl,
+	}
+}
+
+// Redis is a `Store` shared by every instance of the API, so invalidations are seen by all instances
+type Redis struct {
+	client redis.UniversalClient
+	ttl    time.Duration
+}
+
+// Get decodes the cached value of the key
+func (r *Redis) Get(key string, v interface{}) bool {
+	b, err := r.client.Get(redisKeyPrefix + key).Bytes()
+	if err != nil {
+		if err != redis.Nil {
+			log.Println("could not read from cache ", err.Error())
+		}
+		return false
+	}
+
+	return decode(b, v) == nil
+}
+
+// Set caches the value of the key
+func (r *Redis) Set(key string, v interface{}) {
+	b, err := encode(v)
+	if err != nil {
+		log.Println("could not encode cache value ", err.Error())
+		return
+	}
+
+	if err := r.client.Set(redisKeyPrefix+key, b, r.ttl).Err(); err != nil {
+		log.Println("could not write to cache ", err.Error())
+	}
+}
+
+// Delete removes the keys
+func (r *Redis) Delete(keys ...string) {
+	if len(keys) == 0 {
+		return
+	}
+
+	prefixed := make([]string, len(keys))
+	for i, key := range keys {
+		prefixed[i] = redisKeyPrefix + key
+	}
+
+	if err := r.client.Del(prefixed...).Err(); err != nil {
+		log.Println("could not delete from cache ", err.Error())
+	}
+}
@@ -50,3 +50,8 @@ func (e *DatastoreError) Code() int {
 func (e *DatastoreError) Error() string {
 	return e.err.Error()
 }
+
+// Unwrap returns the underlying error
+func (e *DatastoreError) Unwrap() error {
+	return e.err
+}
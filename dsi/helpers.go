@@ -23,6 +23,16 @@ const (
 	MetadataCreated     = "_metadata.created"
 	MetadataCreator     = "_metadata.creator"
 	MetadataCreatorType = "_metadata.creator_type"
+	// NearKey is used to query documents near a point, `lat,lon`
+	NearKey = "near"
+	// WithinKey is the maximum distance from the `near` point, i.e. `5km`
+	WithinKey = "within"
+	// BoundingBoxKey is used to query documents inside of a bounding box, `minLat,minLon,maxLat,maxLon`
+	BoundingBoxKey = "bbox"
+	// GeoFieldKey selects the geopoint field of geo queries, if the resource has more than one
+	GeoFieldKey = "geo_field"
+	// DistanceKey is used to sort by the distance from the `near` point
+	DistanceKey = "_distance"
 
 	// MaxRecursion is the maximum amount of levels allowed in a JSON object (array and objects)
 	MaxRecursion = 8
@@ -34,6 +44,19 @@ var MaxLengthOfCollectionInfo = 12
 // ValidPathFormat is the regular expression used to validate resource path names, collection names, and project slugs
 var ValidPathFormat = regexp.MustCompile(`^[a-zA-Z0-9_-]*$`)
 
+// reservedPathNames cannot be used as resource path names, as `_changes` is the path of the change log, `/api/_changes`
+var reservedPathNames = []string{"_changes"}
+
+// ReservedPathName returns true if the string is a reserved resource path name
+func ReservedPathName(a string) bool {
+	for _, b := range reservedPathNames {
+		if b == a {
+			return true
+		}
+	}
+	return false
+}
+
 // reservedFieldKeys is the list of keys that cannot be used, as they are reserved for machinable use
 var reservedFieldKeys = []string{JSONIDKey, DocumentIDKey, LimitKey, OffsetKey, SortKey, MetadataKey, MetadataCreated, MetadataCreator, MetadataCreatorType}
 
@@ -0,0 +1,21 @@
+package interfaces
+
+import (
+	"time"
+
+	"github.com/machinable/machinable/dsi/models"
+)
+
+// ChangesDatastore is implemented by datastores which notify the changes of resource documents and JSON trees,
+// including writes made outside of the API, so every instance can stream every change
+type ChangesDatastore interface {
+	// ListenChanges calls `fn` with each change as JSON, in the format of `events.Change`. Blocks until listening fails.
+	ListenChanges(fn func(change []byte)) error
+}
+
+// ProjectChangesDatastore exposes functions to the change log of resource documents and JSON trees
+type ProjectChangesDatastore interface {
+	ListChanges(projectID string, since int64, limit int64, scopes []*models.ChangeScope) ([]*models.ProjectChange, error)
+	GetChangeHorizon(projectID string) (int64, error)
+	CompactChanges(retention time.Duration) error
+}
@@ -9,8 +9,12 @@ import "github.com/machinable/machinable/dsi/models"
 type Datastore interface {
 	// Project resources/definitions
 	ResourcesDatastore
+	// Project resource document files
+	ProjectFilesDatastore
 	// JSON Key/val
 	ProjectJSONDatastore
+	// Change log
+	ProjectChangesDatastore
 	// Project users
 	ProjectUsersDatastore
 	// Project apikeys
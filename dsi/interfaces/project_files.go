@@ -0,0 +1,20 @@
+package interfaces
+
+import (
+	"github.com/machinable/machinable/dsi/errors"
+	"github.com/machinable/machinable/dsi/models"
+)
+
+// ProjectFilesDatastore exposes functions to the files attached to resource documents
+type ProjectFilesDatastore interface {
+	// AttachDefDocumentFile saves the file and sets the document field to the file ID, returning the file it replaced, if any
+	AttachDefDocumentFile(projectID, path, documentID string, file *models.File) (*models.File, *errors.DatastoreError)
+	// DetachDefDocumentFile deletes the file of the field and removes the field from the document
+	DetachDefDocumentFile(projectID, path, documentID, field string) (*models.File, *errors.DatastoreError)
+	GetDefDocumentFile(projectID, path, documentID, field string) (*models.File, *errors.DatastoreError)
+	ListDefDocumentFiles(projectID, path, documentID string) ([]*models.File, *errors.DatastoreError)
+	DropDefDocumentFiles(projectID, path, documentID string) *errors.DatastoreError
+	GetFileStats(projectID string) (*models.Stats, *errors.DatastoreError)
+	// GetProjectStorageSize returns the size in bytes of the documents and files of the project
+	GetProjectStorageSize(projectID string) (int64, *errors.DatastoreError)
+}
@@ -1,6 +1,10 @@
 package interfaces
 
-import "github.com/machinable/machinable/dsi/models"
+import (
+	"time"
+
+	"github.com/machinable/machinable/dsi/models"
+)
 
 // ProjectJSONDatastore exposes functions to the project json trees
 type ProjectJSONDatastore interface {
@@ -11,7 +15,14 @@ type ProjectJSONDatastore interface {
 	DeleteRootKey(projectID, rootKey string) error
 
 	GetJSONKey(projectID, rootKey string, keys ...string) ([]byte, error)
-	CreateJSONKey(projectID, rootKey string, data []byte, keys ...string) error
-	UpdateJSONKey(projectID, rootKey string, data []byte, keys ...string) error
-	DeleteJSONKey(projectID, rootKey string, keys ...string) error
+	QueryJSONKey(projectID, rootKey string, query *models.JSONQuery, keys ...string) ([]byte, error)
+	CreateJSONKey(projectID, rootKey string, data []byte, validate models.JSONValidator, keys ...string) error
+	UpdateJSONKey(projectID, rootKey string, data []byte, validate models.JSONValidator, keys ...string) error
+	DeleteJSONKey(projectID, rootKey string, validate models.JSONValidator, keys ...string) error
+	ApplyJSONOperation(projectID, rootKey string, op *models.JSONOperation, validate models.JSONValidator, keys ...string) ([]byte, error)
+
+	CreateJSONSnapshot(projectID, rootKey, reason string, ttl time.Duration, keep int) (*models.JSONSnapshot, error)
+	ListJSONSnapshots(projectID, rootKey string) ([]*models.JSONSnapshot, error)
+	GetJSONSnapshot(projectID, rootKey, snapshotID string) (*models.JSONSnapshot, error)
+	DeleteJSONSnapshot(projectID, rootKey, snapshotID string) error
 }
@@ -12,7 +12,14 @@ type ProjectHooksDatastore interface {
 	GetHook(projectID, hookID string) (*models.WebHook, *errors.DatastoreError)
 	UpdateHook(projectID, hookID string, hook *models.WebHook) *errors.DatastoreError
 	DeleteHook(projectID, hookID string) *errors.DatastoreError
+	GetHookSecret(projectID, hookID string) (string, *errors.DatastoreError)
+	UpdateHookSecret(projectID, hookID, secret string) *errors.DatastoreError
 
 	AddResult(result *models.HookResult) *errors.DatastoreError
 	ListResults(projectID, hookID string) ([]*models.HookResult, *errors.DatastoreError)
+
+	AddFailure(failure *models.HookFailure) *errors.DatastoreError
+	ListFailures(projectID, hookID string) ([]*models.HookFailure, *errors.DatastoreError)
+	GetFailure(projectID, hookID, failureID string) (*models.HookFailure, *errors.DatastoreError)
+	DeleteFailure(projectID, hookID, failureID string) *errors.DatastoreError
 }
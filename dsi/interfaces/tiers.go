@@ -5,4 +5,5 @@ import "github.com/machinable/machinable/dsi/models"
 // TiersDatastore exposes functions for app tiers
 type TiersDatastore interface {
 	ListTiers() ([]*models.Tier, error)
+	UpdateTier(tier *models.Tier) error
 }
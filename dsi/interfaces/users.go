@@ -9,4 +9,5 @@ type UsersDatastore interface {
 	CreateAppUser(user *models.User) error
 	UpdateUserPassword(userID, passwordHash string) error
 	ActivateUser(userID string, active bool) error
+	UpdateUserTier(userID, tierID string) error
 }
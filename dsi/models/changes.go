@@ -0,0 +1,27 @@
+package models
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// ProjectChange is an entry of the change log of a project, a create, edit or delete of a resource document or a JSON
+// tree root key. Deletes are tombstones, without data.
+type ProjectChange struct {
+	// Seq increases with every change
+	Seq        int64           `json:"seq"`
+	Entity     string          `json:"entity"` // resource, json
+	EntityKey  string          `json:"entity_key"`
+	DocumentID string          `json:"document_id,omitempty"`
+	Action     string          `json:"action"` // create, edit, delete
+	Creator    string          `json:"creator,omitempty"`
+	Data       json.RawMessage `json:"data,omitempty"`
+	Created    time.Time       `json:"created"`
+}
+
+// ChangeScope selects the changes of a resource or root key, limited to the documents of `Creator` if it is set
+type ChangeScope struct {
+	Entity    string
+	EntityKey string
+	Creator   string
+}
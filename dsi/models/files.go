@@ -0,0 +1,87 @@
+package models
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// FormatFile is the schema property format of fields which reference a file attached to the document
+const FormatFile = "file"
+
+// File is the metadata of a file attached to a field of a resource document. The field of the document is set to
+// the ID of the file.
+type File struct {
+	ID           string    `json:"id"`
+	ProjectID    string    `json:"project_id"`
+	ResourcePath string    `json:"resource_path"`
+	DocumentID   string    `json:"document_id"`
+	Field        string    `json:"field"`
+	Name         string    `json:"name"`
+	ContentType  string    `json:"content_type"`
+	Size         int64     `json:"size"`
+	Created      time.Time `json:"created"`
+}
+
+// StorageKey returns the key of the file contents in the storage backend
+func (f *File) StorageKey() string {
+	return DocumentFilesPrefix(f.ProjectID, f.ResourcePath, f.DocumentID) + "/" + f.ID
+}
+
+// ProjectFilesPrefix returns the storage key prefix of all files of a project
+func ProjectFilesPrefix(projectID string) string {
+	return projectID
+}
+
+// ResourceFilesPrefix returns the storage key prefix of all files of a resource
+func ResourceFilesPrefix(projectID, resourcePath string) string {
+	return ProjectFilesPrefix(projectID) + "/" + resourcePath
+}
+
+// DocumentFilesPrefix returns the storage key prefix of all files of a document
+func DocumentFilesPrefix(projectID, resourcePath, documentID string) string {
+	return ResourceFilesPrefix(projectID, resourcePath) + "/" + documentID
+}
+
+// GetFileFields returns the names of the schema properties with the `file` format
+func (def *ResourceDefinition) GetFileFields() (map[string]bool, error) {
+	schema := JSONSchemaObject{}
+	if err := json.Unmarshal([]byte(def.Schema), &schema); err != nil {
+		return nil, err
+	}
+
+	fields := map[string]bool{}
+	for field, property := range schema.Properties {
+		if format, _ := property["format"].(string); format == FormatFile {
+			fields[field] = true
+		}
+	}
+
+	return fields, nil
+}
+
+// validateFileFields verifies file properties are optional strings, as files can only be attached to existing documents
+func (def *ResourceDefinition) validateFileFields() error {
+	schema := JSONSchemaObject{}
+	if err := json.Unmarshal([]byte(def.Schema), &schema); err != nil {
+		return err
+	}
+
+	fields, err := def.GetFileFields()
+	if err != nil {
+		return err
+	}
+
+	for field := range fields {
+		if propertyType, _ := schema.Properties[field]["type"].(string); propertyType != "string" {
+			return fmt.Errorf("file property '%s' must be of type 'string'", field)
+		}
+		for _, required := range schema.Required {
+			if required == field {
+				return fmt.Errorf("file property '%s' cannot be required", field)
+			}
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,242 @@
+package models
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// FormatGeoPoint is the schema property format of fields which store a location, as `{"lat": 0.0, "lon": 0.0}`
+const FormatGeoPoint = "geopoint"
+
+// EarthRadius is the mean radius of the earth in meters, used for great-circle distances
+const EarthRadius = 6371008.8
+
+// distanceUnits are the supported units of distances, in meters
+var distanceUnits = map[string]float64{
+	"m":  1,
+	"km": 1000,
+	"mi": 1609.344,
+	"ft": 0.3048,
+}
+
+// GeoPoint is a location, in degrees
+type GeoPoint struct {
+	Lat float64 `json:"lat"`
+	Lon float64 `json:"lon"`
+}
+
+// Valid returns true if the latitude and longitude are within range
+func (p *GeoPoint) Valid() bool {
+	return p.Lat >= -90 && p.Lat <= 90 && p.Lon >= -180 && p.Lon <= 180
+}
+
+// GeoBox is a bounding box of the south west and north east corners. Boxes crossing the antimeridian have a `Min.Lon`
+// greater than the `Max.Lon`.
+type GeoBox struct {
+	Min GeoPoint `json:"min"`
+	Max GeoPoint `json:"max"`
+}
+
+// GeoFilter filters documents by the location of a geopoint field. Documents are filtered by their distance to `Near`
+// if `Within` (in meters) is set, and/or by being inside of `Box`.
+type GeoFilter struct {
+	Near   *GeoPoint
+	Within float64
+	Box    *GeoBox
+}
+
+// Distance returns the great-circle (haversine) distance to the point, in meters
+func (p *GeoPoint) Distance(to *GeoPoint) float64 {
+	radians := func(degrees float64) float64 { return degrees * math.Pi / 180 }
+
+	h := math.Pow(math.Sin(radians(p.Lat-to.Lat)/2), 2) +
+		math.Cos(radians(to.Lat))*math.Cos(radians(p.Lat))*math.Pow(math.Sin(radians(p.Lon-to.Lon)/2), 2)
+	return EarthRadius * 2 * math.Asin(math.Min(1, math.Sqrt(h)))
+}
+
+// Match returns true if the geopoint value of a document field passes the filter, as the datastore filters documents.
+// Values without a numeric `lat` and `lon` never match.
+func (g *GeoFilter) Match(value interface{}) bool {
+	obj, ok := value.(map[string]interface{})
+	if !ok {
+		return false
+	}
+	lat, latOk := obj["lat"].(float64)
+	lon, lonOk := obj["lon"].(float64)
+	if !latOk || !lonOk {
+		return false
+	}
+
+	if g.Near != nil && g.Within > 0 && (&GeoPoint{Lat: lat, Lon: lon}).Distance(g.Near) > g.Within {
+		return false
+	}
+
+	if g.Box != nil {
+		if lat < g.Box.Min.Lat || lat > g.Box.Max.Lat {
+			return false
+		}
+		// boxes crossing the antimeridian wrap around
+		if g.Box.Min.Lon > g.Box.Max.Lon {
+			return lon >= g.Box.Min.Lon || lon <= g.Box.Max.Lon
+		}
+		return lon >= g.Box.Min.Lon && lon <= g.Box.Max.Lon
+	}
+
+	return true
+}
+
+// ParseGeoPoint parses a `lat,lon` pair
+func ParseGeoPoint(s string) (*GeoPoint, error) {
+	values, err := parseFloats(s, 2)
+	if err != nil {
+		return nil, errors.New("invalid point, expected 'lat,lon'")
+	}
+
+	point := &GeoPoint{Lat: values[0], Lon: values[1]}
+	if !point.Valid() {
+		return nil, errors.New("invalid point, latitude or longitude out of range")
+	}
+	return point, nil
+}
+
+// ParseGeoBox parses a `minLat,minLon,maxLat,maxLon` bounding box
+func ParseGeoBox(s string) (*GeoBox, error) {
+	values, err := parseFloats(s, 4)
+	if err != nil {
+		return nil, errors.New("invalid bounding box, expected 'minLat,minLon,maxLat,maxLon'")
+	}
+
+	box := &GeoBox{
+		Min: GeoPoint{Lat: values[0], Lon: values[1]},
+		Max: GeoPoint{Lat: values[2], Lon: values[3]},
+	}
+	if !box.Min.Valid() || !box.Max.Valid() || box.Min.Lat > box.Max.Lat {
+		return nil, errors.New("invalid bounding box, latitude or longitude out of range")
+	}
+	return box, nil
+}
+
+// ParseDistance parses a distance with an optional unit (m, km, mi, ft), i.e. `5km`, returning meters
+func ParseDistance(s string) (float64, error) {
+	s = strings.TrimSpace(s)
+	unit := strings.TrimLeft(s, "0123456789.")
+	multiplier, ok := distanceUnits[unit]
+	if unit == "" {
+		multiplier, ok = 1, true
+	}
+	if !ok {
+		return 0, fmt.Errorf("invalid distance unit '%s'", unit)
+	}
+
+	value, err := strconv.ParseFloat(strings.TrimSuffix(s, unit), 64)
+	if err != nil || value <= 0 {
+		return 0, errors.New("invalid distance")
+	}
+	return value * multiplier, nil
+}
+
+func parseFloats(s string, count int) ([]float64, error) {
+	parts := strings.Split(s, ",")
+	if len(parts) != count {
+		return nil, errors.New("invalid number of values")
+	}
+
+	values := make([]float64, count)
+	for i, part := range parts {
+		value, err := strconv.ParseFloat(strings.TrimSpace(part), 64)
+		if err != nil {
+			return nil, err
+		}
+		values[i] = value
+	}
+	return values, nil
+}
+
+// GetGeoFields returns the names of the schema properties with the `geopoint` format, in order
+func (def *ResourceDefinition) GetGeoFields() ([]string, error) {
+	schema := JSONSchemaObject{}
+	if err := json.Unmarshal([]byte(def.Schema), &schema); err != nil {
+		return nil, err
+	}
+
+	fields := []string{}
+	for field, property := range schema.Properties {
+		if format, _ := property["format"].(string); format == FormatGeoPoint {
+			fields = append(fields, field)
+		}
+	}
+	sort.Strings(fields)
+
+	return fields, nil
+}
+
+// validateGeoFields verifies geopoint properties are objects
+func (def *ResourceDefinition) validateGeoFields() error {
+	schema := JSONSchemaObject{}
+	if err := json.Unmarshal([]byte(def.Schema), &schema); err != nil {
+		return err
+	}
+
+	fields, err := def.GetGeoFields()
+	if err != nil {
+		return err
+	}
+
+	for _, field := range fields {
+		if propertyType, _ := schema.Properties[field]["type"].(string); propertyType != "object" {
+			return fmt.Errorf("geopoint property '%s' must be of type 'object'", field)
+		}
+	}
+
+	return nil
+}
+
+// validateGeoPoints verifies the geopoint fields of the object are valid `lat`/`lon` pairs
+func (obj *ResourceObject) validateGeoPoints(definition *ResourceDefinition) error {
+	fields, err := definition.GetGeoFields()
+	if err != nil {
+		return err
+	}
+
+	errs := ValidationErrors{}
+	for _, field := range fields {
+		value, ok := (*obj)[field]
+		if !ok || value == nil {
+			continue
+		}
+		if !validGeoPoint(value) {
+			errs = append(errs, &ValidationError{
+				Path:     JSONPointer([]string{field}),
+				Keyword:  "format",
+				Expected: FormatGeoPoint,
+				Actual:   value,
+				Message:  fmt.Sprintf("%s must be a geopoint, with a 'lat' between -90 and 90 and a 'lon' between -180 and 180", field),
+			})
+		}
+	}
+
+	if len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
+
+func validGeoPoint(value interface{}) bool {
+	obj, ok := value.(map[string]interface{})
+	if !ok {
+		return false
+	}
+
+	lat, latOk := obj["lat"].(float64)
+	lon, lonOk := obj["lon"].(float64)
+	if !latOk || !lonOk {
+		return false
+	}
+
+	return (&GeoPoint{Lat: lat, Lon: lon}).Valid()
+}
@@ -0,0 +1,87 @@
+package models
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseDistance(t *testing.T) {
+	tables := []struct {
+		in       string
+		expected float64
+		isErr    bool
+	}{
+		{"500", 500, false},
+		{"5km", 5000, false},
+		{"1.5mi", 2414.016, false},
+		{"10ft", 3.048, false},
+		{"5 parsecs", 0, true},
+		{"km", 0, true},
+		{"0m", 0, true},
+	}
+
+	for _, tt := range tables {
+		meters, err := ParseDistance(tt.in)
+		assert.Equal(t, tt.isErr, err != nil, tt.in)
+		assert.InDelta(t, tt.expected, meters, 0.0001, tt.in)
+	}
+}
+
+func TestGeoPoints(t *testing.T) {
+	point, err := ParseGeoPoint("40.7128, -74.0060")
+	assert.Nil(t, err)
+	assert.Equal(t, &GeoPoint{Lat: 40.7128, Lon: -74.0060}, point)
+
+	_, err = ParseGeoPoint("91,0")
+	assert.NotNil(t, err)
+
+	_, err = ParseGeoBox("10,170,20,-170")
+	assert.Nil(t, err, "boxes can cross the antimeridian")
+	_, err = ParseGeoBox("20,0,10,10")
+	assert.NotNil(t, err)
+
+	def := &ResourceDefinition{Schema: `{
+		"type": "object",
+		"properties": {
+			"location": {"type": "object", "format": "geopoint"}
+		}
+	}`}
+
+	valid := ResourceObject{"location": map[string]interface{}{"lat": 40.7128, "lon": -74.0060}}
+	assert.Nil(t, valid.Validate(def))
+
+	invalid := ResourceObject{"location": map[string]interface{}{"lat": 140.0, "lon": -74.0060}}
+	errs := AsValidationErrors(invalid.Validate(def))
+	if assert.Len(t, errs, 1) {
+		assert.Equal(t, "/location", errs[0].Path)
+		assert.Equal(t, "format", errs[0].Keyword)
+	}
+}
+
+func TestGeoFilterMatch(t *testing.T) {
+	newYork := &GeoPoint{Lat: 40.7128, Lon: -74.0060}
+	philadelphia := map[string]interface{}{"lat": 39.9526, "lon": -75.1652}
+
+	assert.InDelta(t, 129600, (&GeoPoint{Lat: 39.9526, Lon: -75.1652}).Distance(newYork), 500)
+
+	tables := []struct {
+		filter   *GeoFilter
+		value    interface{}
+		expected bool
+	}{
+		{&GeoFilter{Near: newYork, Within: 150000}, philadelphia, true},
+		{&GeoFilter{Near: newYork, Within: 100000}, philadelphia, false},
+		{&GeoFilter{Near: newYork}, philadelphia, true},
+		{&GeoFilter{Box: &GeoBox{Min: GeoPoint{Lat: 39, Lon: -76}, Max: GeoPoint{Lat: 41, Lon: -74}}}, philadelphia, true},
+		{&GeoFilter{Box: &GeoBox{Min: GeoPoint{Lat: 40, Lon: -76}, Max: GeoPoint{Lat: 41, Lon: -74}}}, philadelphia, false},
+		{&GeoFilter{Box: &GeoBox{Min: GeoPoint{Lat: -10, Lon: 170}, Max: GeoPoint{Lat: 10, Lon: -170}}}, map[string]interface{}{"lat": 0.0, "lon": 179.0}, true},
+		{&GeoFilter{Box: &GeoBox{Min: GeoPoint{Lat: -10, Lon: 170}, Max: GeoPoint{Lat: 10, Lon: -170}}}, map[string]interface{}{"lat": 0.0, "lon": 0.0}, false},
+		{&GeoFilter{Near: newYork}, "40.7,-74.0", false},
+		{&GeoFilter{Near: newYork}, nil, false},
+	}
+
+	for i, tt := range tables {
+		assert.Equal(t, tt.expected, tt.filter.Match(tt.value), i)
+	}
+}
@@ -0,0 +1,149 @@
+package models
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+)
+
+// Changed is the operator of hook filters which is true if the value of the field changed with the event, i.e.
+// `{"status": {"$eq": "shipped", "$changed": true}}`
+const Changed Op = "$changed"
+
+// PreviousField prefixes the fields of hook filters which are compared to the value before the event, i.e.
+// `{"$previous.status": {"$eq": "packed"}}`
+const PreviousField = "$previous."
+
+// ValidateHookFilter returns an error if the filter of a hook has an unknown operator, or a value the operator can not
+// compare
+func ValidateHookFilter(filter Filters) error {
+	for field, value := range filter {
+		if strings.TrimPrefix(field, PreviousField) == "" {
+			return errors.New("filter field can not be empty")
+		}
+		if len(value) == 0 {
+			return fmt.Errorf("filter of '%s' has no operators", field)
+		}
+
+		for op, v := range value {
+			switch op {
+			case EQ:
+				switch v.(type) {
+				case nil, string, float64, bool:
+				default:
+					return fmt.Errorf("'%s' of '%s' must be a string, number, boolean or null", op, field)
+				}
+			case GT, GTE, LT, LTE:
+				switch v.(type) {
+				case string, float64:
+				default:
+					return fmt.Errorf("'%s' of '%s' must be a string or number", op, field)
+				}
+			case Changed:
+				if _, ok := v.(bool); !ok {
+					return fmt.Errorf("'%s' of '%s' must be a boolean", op, field)
+				}
+				if strings.HasPrefix(field, PreviousField) {
+					return fmt.Errorf("'%s' can not be used with '%s' fields", op, PreviousField)
+				}
+			default:
+				return fmt.Errorf("unknown filter operator '%s'", op)
+			}
+		}
+	}
+	return nil
+}
+
+// MatchHookFilter returns true if the value of an event passes every condition of the filter. Fields are dot separated
+// paths of the value, i.e. `owner.name`, compared after the event, or before the event with the `$previous.` prefix.
+// Deletes have no value after the event, so their fields are compared to the deleted value. Previous values are nil
+// for creates, and for edits of which they are unknown.
+func MatchHookFilter(filter Filters, before, after interface{}, action string) bool {
+	current := after
+	if action == HookDelete {
+		current = before
+	}
+
+	for field, value := range filter {
+		var v, previous interface{}
+		var ok bool
+		if strings.HasPrefix(field, PreviousField) {
+			v, ok = lookupField(before, strings.TrimPrefix(field, PreviousField))
+		} else {
+			v, ok = lookupField(current, field)
+			previous, _ = lookupField(before, field)
+		}
+
+		for op, operand := range value {
+			if op == Changed {
+				afterValue, _ := lookupField(after, field)
+				if changed := !reflect.DeepEqual(previous, afterValue); changed != operand.(bool) {
+					return false
+				}
+				continue
+			}
+			if !ok || !compare(op, v, operand) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// lookupField returns the value at the dot separated path of a decoded JSON value
+func lookupField(value interface{}, path string) (interface{}, bool) {
+	for _, key := range strings.Split(path, ".") {
+		obj, ok := value.(map[string]interface{})
+		if !ok {
+			return nil, false
+		}
+		if value, ok = obj[key]; !ok {
+			return nil, false
+		}
+	}
+	return value, true
+}
+
+// compare applies the operator to a decoded JSON value and the operand. Numbers are compared numerically and strings
+// lexically, and values of different types never pass.
+func compare(op Op, value, operand interface{}) bool {
+	if op == EQ {
+		return reflect.DeepEqual(value, operand)
+	}
+
+	var cmp int
+	switch a := value.(type) {
+	case float64:
+		b, ok := operand.(float64)
+		if !ok {
+			return false
+		}
+		switch {
+		case a < b:
+			cmp = -1
+		case a > b:
+			cmp = 1
+		}
+	case string:
+		b, ok := operand.(string)
+		if !ok {
+			return false
+		}
+		cmp = strings.Compare(a, b)
+	default:
+		return false
+	}
+
+	switch op {
+	case GT:
+		return cmp > 0
+	case GTE:
+		return cmp >= 0
+	case LT:
+		return cmp < 0
+	case LTE:
+		return cmp <= 0
+	}
+	return false
+}
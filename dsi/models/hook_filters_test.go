@@ -0,0 +1,71 @@
+package models
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidateHookFilter(t *testing.T) {
+	valid := []string{
+		`{}`,
+		`{"status": {"$eq": "shipped", "$changed": true}, "amount": {"$gt": 1000}}`,
+		`{"$previous.status": {"$eq": null}, "owner.name": {"$lte": "m"}}`,
+	}
+	for _, v := range valid {
+		filter := Filters{}
+		assert.Nil(t, json.Unmarshal([]byte(v), &filter))
+		assert.Nil(t, ValidateHookFilter(filter), v)
+	}
+
+	invalid := []string{
+		`{"": {"$eq": 1}}`,
+		`{"$previous.": {"$eq": 1}}`,
+		`{"status": {}}`,
+		`{"status": {"$eq": ["shipped"]}}`,
+		`{"amount": {"$gt": true}}`,
+		`{"status": {"$changed": "yes"}}`,
+		`{"$previous.status": {"$changed": true}}`,
+		`{"status": {"$in": ["shipped"]}}`,
+	}
+	for _, v := range invalid {
+		filter := Filters{}
+		assert.Nil(t, json.Unmarshal([]byte(v), &filter))
+		assert.NotNil(t, ValidateHookFilter(filter), v)
+	}
+}
+
+func TestMatchHookFilter(t *testing.T) {
+	before := map[string]interface{}{"status": "packed", "amount": float64(1200), "owner": map[string]interface{}{"name": "jane"}}
+	after := map[string]interface{}{"status": "shipped", "amount": float64(1200), "owner": map[string]interface{}{"name": "jane"}}
+
+	tables := []struct {
+		filter  string
+		before  interface{}
+		after   interface{}
+		action  string
+		matches bool
+	}{
+		{`{}`, nil, after, HookCreate, true},
+		{`{"status": {"$eq": "shipped"}}`, nil, after, HookCreate, true},
+		{`{"status": {"$eq": "packed"}}`, nil, after, HookCreate, false},
+		{`{"amount": {"$gt": 1000, "$lte": 1200}}`, nil, after, HookCreate, true},
+		{`{"amount": {"$gt": "1000"}}`, nil, after, HookCreate, false},
+		{`{"owner.name": {"$gte": "j"}}`, nil, after, HookCreate, true},
+		{`{"owner.email": {"$eq": null}}`, nil, after, HookCreate, false},
+		{`{"status": {"$eq": "shipped", "$changed": true}}`, before, after, HookEdit, true},
+		{`{"amount": {"$changed": true}}`, before, after, HookEdit, false},
+		{`{"amount": {"$changed": false}}`, before, after, HookEdit, true},
+		{`{"$previous.status": {"$eq": "packed"}}`, before, after, HookEdit, true},
+		{`{"$previous.status": {"$eq": "packed"}}`, nil, after, HookEdit, false},
+		{`{"status": {"$eq": "packed"}}`, before, map[string]interface{}{}, HookDelete, true},
+		{`{"status": {"$changed": true}}`, before, map[string]interface{}{}, HookDelete, true},
+	}
+
+	for i, tt := range tables {
+		filter := Filters{}
+		assert.Nil(t, json.Unmarshal([]byte(tt.filter), &filter))
+		assert.Equal(t, tt.matches, MatchHookFilter(filter, tt.before, tt.after, tt.action), i)
+	}
+}
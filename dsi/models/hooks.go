@@ -3,31 +3,71 @@ package models
 import (
 	"encoding/json"
 	"errors"
+	"fmt"
+	"net/http"
 	"net/url"
 	"time"
 )
 
-// HookResult contains relevant information regarding the http response of a web hook
+// HookResult contains relevant information regarding the http response of a web hook. The request and response bodies
+// are truncated.
 type HookResult struct {
-	WebHookID    string    `json:"webhook_id"`
-	ProjectID    string    `json:"project_id"`
-	StatusCode   int       `json:"status_code"`
-	ResponseTime int64     `json:"response_time"`
-	ErrorMessage string    `json:"error_message"`
-	Created      time.Time `json:"created"`
+	WebHookID       string      `json:"webhook_id"`
+	ProjectID       string      `json:"project_id"`
+	StatusCode      int         `json:"status_code"`
+	ResponseTime    int64       `json:"response_time"`
+	ErrorMessage    string      `json:"error_message"`
+	RequestHeaders  http.Header `json:"request_headers,omitempty"`
+	RequestBody     string      `json:"request_body,omitempty"`
+	ResponseHeaders http.Header `json:"response_headers,omitempty"`
+	ResponseBody    string      `json:"response_body,omitempty"`
+	Created         time.Time   `json:"created"`
 }
 
-// WebHook defines the structure of a project web hook
+// HookFailure is a web hook delivery which failed every attempt, kept with its payload and the result of each attempt
+// so it can be replayed
+type HookFailure struct {
+	ID         string          `json:"id"`
+	ProjectID  string          `json:"project_id"`
+	WebHookID  string          `json:"webhook_id"`
+	DeliveryID string          `json:"delivery_id"`
+	Event      string          `json:"event"`
+	EntityKey  string          `json:"entity_key"`
+	Payload    json.RawMessage `json:"payload"`
+	Attempts   []*HookResult   `json:"attempts"`
+	Created    time.Time       `json:"created"`
+}
+
+// Succeeded returns true if the receiver responded with a 2xx status code
+func (h *HookResult) Succeeded() bool {
+	return h.StatusCode >= 200 && h.StatusCode < 300
+}
+
+// Web hook events, the actions of writes
+const (
+	HookCreate = "create"
+	HookEdit   = "edit"
+	HookDelete = "delete"
+)
+
+// WebHook defines the structure of a project web hook. A hook subscribes to one or more events of an entity: a
+// resource, or a JSON tree root key by `EntityID`, or every resource or root key of the project if `EntityID` is empty.
+// Hooks of a root key can be limited to the writes of the JSON Pointer `Path` of the tree. Hooks with a `Filter` only
+// fire for the events which pass it, see `MatchHookFilter`.
 type WebHook struct {
-	ID        string `json:"id"`
-	ProjectID string `json:"project_id"`
-	Label     string `json:"label"`
-	IsEnabled bool   `json:"is_enabled"`
-	Entity    string `json:"entity"`
-	EntityID  string `json:"entity_id"`
-	HookEvent string `json:"event"`
-	Headers   []byte `json:"headers"`
-	HookURL   string `json:"hook_url"`
+	ID         string   `json:"id"`
+	ProjectID  string   `json:"project_id"`
+	Label      string   `json:"label"`
+	IsEnabled  bool     `json:"is_enabled"`
+	Entity     string   `json:"entity"`
+	EntityID   string   `json:"entity_id"`
+	Path       string   `json:"path"`
+	HookEvents []string `json:"events"`
+	Filter     Filters  `json:"filter"`
+	Headers    []byte   `json:"headers"`
+	HookURL    string   `json:"hook_url"`
+	// Secret signs the deliveries of the hook. It is only returned when it is generated, and is never read from requests.
+	Secret string `json:"-"`
 }
 
 // validURL parses the string as a url and verifies it is valid
@@ -42,19 +82,66 @@ func (w *WebHook) Validate() error {
 		return errors.New("invalid project id")
 	} else if w.Label == "" {
 		return errors.New("label can not be empty")
-	} else if w.Entity == "" {
-		return errors.New("entity can not be empty")
-	} else if w.EntityID == "" {
-		return errors.New("entity can not be empty")
-	} else if w.HookEvent == "" {
-		return errors.New("hook event can not be empty")
+	} else if w.Entity != EndpointResource && w.Entity != EndpointJSON {
+		return errors.New("entity must be 'resource' or 'json'")
+	} else if len(w.HookEvents) == 0 {
+		return errors.New("hook events can not be empty")
 	} else if w.HookURL == "" {
 		return errors.New("hook URL can not be empty")
 	} else if !validURL(w.HookURL) {
 		return errors.New("invalid hook URL")
 	}
 
-	return nil
+	seen := map[string]bool{}
+	for _, event := range w.HookEvents {
+		if event != HookCreate && event != HookEdit && event != HookDelete {
+			return fmt.Errorf("invalid hook event '%s'", event)
+		} else if seen[event] {
+			return fmt.Errorf("duplicate hook event '%s'", event)
+		}
+		seen[event] = true
+	}
+
+	if w.Path != "" {
+		if w.Entity != EndpointJSON || w.EntityID == "" {
+			return errors.New("hook path requires a JSON root key")
+		}
+		if _, err := ParseJSONPointer(w.Path); err != nil {
+			return err
+		}
+	}
+
+	return ValidateHookFilter(w.Filter)
+}
+
+// Subscribes returns true if the hook is enabled and subscribes to the event of the entity. Writes of JSON trees match
+// the path of the hook if they write the path, below it, or above it, which replaces it.
+func (w *WebHook) Subscribes(action, entity, entityID string, keys []string) bool {
+	if !w.IsEnabled || w.Entity != entity || (w.EntityID != "" && w.EntityID != entityID) {
+		return false
+	}
+
+	subscribed := false
+	for _, event := range w.HookEvents {
+		if event == action {
+			subscribed = true
+			break
+		}
+	}
+	if !subscribed {
+		return false
+	}
+
+	path, err := ParseJSONPointer(w.Path)
+	if err != nil {
+		return false
+	}
+	for i := 0; i < len(path) && i < len(keys); i++ {
+		if path[i] != keys[i] {
+			return false
+		}
+	}
+	return true
 }
 
 // MarshalJSON custom marshaller to marshall properties to json
@@ -66,40 +153,48 @@ func (w *WebHook) MarshalJSON() ([]byte, error) {
 	}
 
 	return json.Marshal(&struct {
-		ID        string              `json:"id"`
-		ProjectID string              `json:"project_id"`
-		Label     string              `json:"label"`
-		IsEnabled bool                `json:"is_enabled"`
-		Entity    string              `json:"entity"`
-		EntityID  string              `json:"entity_id"`
-		HookEvent string              `json:"event"`
-		Headers   []map[string]string `json:"headers"`
-		HookURL   string              `json:"hook_url"`
+		ID         string              `json:"id"`
+		ProjectID  string              `json:"project_id"`
+		Label      string              `json:"label"`
+		IsEnabled  bool                `json:"is_enabled"`
+		Entity     string              `json:"entity"`
+		EntityID   string              `json:"entity_id"`
+		Path       string              `json:"path"`
+		HookEvents []string            `json:"events"`
+		Filter     Filters             `json:"filter,omitempty"`
+		Headers    []map[string]string `json:"headers"`
+		HookURL    string              `json:"hook_url"`
 	}{
-		ID:        w.ID,
-		ProjectID: w.ProjectID,
-		Label:     w.Label,
-		IsEnabled: w.IsEnabled,
-		Entity:    w.Entity,
-		EntityID:  w.EntityID,
-		HookEvent: w.HookEvent,
-		Headers:   headers,
-		HookURL:   w.HookURL,
+		ID:         w.ID,
+		ProjectID:  w.ProjectID,
+		Label:      w.Label,
+		IsEnabled:  w.IsEnabled,
+		Entity:     w.Entity,
+		EntityID:   w.EntityID,
+		Path:       w.Path,
+		HookEvents: w.HookEvents,
+		Filter:     w.Filter,
+		Headers:    headers,
+		HookURL:    w.HookURL,
 	})
 }
 
-// UnmarshalJSON is a custom unmarshaller, specificall for the `headers`
+// UnmarshalJSON is a custom unmarshaller, specificall for the `headers`. The single `event` of earlier hooks is read
+// as their only event.
 func (w *WebHook) UnmarshalJSON(b []byte) error {
 	payload := struct {
-		ID        string          `json:"id"`
-		ProjectID string          `json:"project_id"`
-		Label     string          `json:"label"`
-		IsEnabled bool            `json:"is_enabled"`
-		Entity    string          `json:"entity"`
-		EntityID  string          `json:"entity_id"`
-		HookEvent string          `json:"event"`
-		Headers   json.RawMessage `json:"headers"`
-		HookURL   string          `json:"hook_url"`
+		ID         string          `json:"id"`
+		ProjectID  string          `json:"project_id"`
+		Label      string          `json:"label"`
+		IsEnabled  bool            `json:"is_enabled"`
+		Entity     string          `json:"entity"`
+		EntityID   string          `json:"entity_id"`
+		Path       string          `json:"path"`
+		HookEvent  string          `json:"event"`
+		HookEvents []string        `json:"events"`
+		Filter     Filters         `json:"filter"`
+		Headers    json.RawMessage `json:"headers"`
+		HookURL    string          `json:"hook_url"`
 	}{}
 
 	err := json.Unmarshal(b, &payload)
@@ -114,7 +209,12 @@ func (w *WebHook) UnmarshalJSON(b []byte) error {
 	w.IsEnabled = payload.IsEnabled
 	w.Entity = payload.Entity
 	w.EntityID = payload.EntityID
-	w.HookEvent = payload.HookEvent
+	w.Path = payload.Path
+	w.HookEvents = payload.HookEvents
+	w.Filter = payload.Filter
+	if len(w.HookEvents) == 0 && payload.HookEvent != "" {
+		w.HookEvents = []string{payload.HookEvent}
+	}
 	w.Headers = payload.Headers
 	w.HookURL = payload.HookURL
 
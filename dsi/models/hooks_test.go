@@ -0,0 +1,76 @@
+package models
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWebHookValidate(t *testing.T) {
+	valid := func() *WebHook {
+		return &WebHook{
+			ProjectID:  "project",
+			Label:      "audit",
+			Entity:     EndpointJSON,
+			EntityID:   "root",
+			Path:       "/owners",
+			HookEvents: []string{HookCreate, HookDelete},
+			HookURL:    "https://example.com/hooks",
+		}
+	}
+	assert.Nil(t, valid().Validate())
+
+	tables := []func(w *WebHook){
+		func(w *WebHook) { w.Entity = "" },
+		func(w *WebHook) { w.HookEvents = nil },
+		func(w *WebHook) { w.HookEvents = []string{"update"} },
+		func(w *WebHook) { w.HookEvents = []string{HookEdit, HookEdit} },
+		func(w *WebHook) { w.Path = "owners" },
+		func(w *WebHook) { w.EntityID = "" },
+		func(w *WebHook) { w.Entity = EndpointResource },
+		func(w *WebHook) { w.HookURL = "example.com" },
+		func(w *WebHook) { w.Filter = Filters{"status": {"$in": "shipped"}} },
+	}
+	for i, invalidate := range tables {
+		w := valid()
+		invalidate(w)
+		assert.NotNil(t, w.Validate(), i)
+	}
+}
+
+func TestWebHookSubscribes(t *testing.T) {
+	all := &WebHook{IsEnabled: true, Entity: EndpointResource, HookEvents: []string{HookCreate, HookEdit}}
+	assert.True(t, all.Subscribes(HookCreate, EndpointResource, "dogs", nil))
+	assert.True(t, all.Subscribes(HookEdit, EndpointResource, "cats", nil))
+	assert.False(t, all.Subscribes(HookDelete, EndpointResource, "dogs", nil))
+	assert.False(t, all.Subscribes(HookCreate, EndpointJSON, "dogs", nil))
+
+	one := &WebHook{IsEnabled: true, Entity: EndpointResource, EntityID: "dogs", HookEvents: []string{HookCreate}}
+	assert.True(t, one.Subscribes(HookCreate, EndpointResource, "dogs", nil))
+	assert.False(t, one.Subscribes(HookCreate, EndpointResource, "cats", nil))
+
+	one.IsEnabled = false
+	assert.False(t, one.Subscribes(HookCreate, EndpointResource, "dogs", nil))
+
+	path := &WebHook{IsEnabled: true, Entity: EndpointJSON, EntityID: "root", Path: "/owners/a~1b", HookEvents: []string{HookEdit}}
+	assert.True(t, path.Subscribes(HookEdit, EndpointJSON, "root", []string{"owners", "a/b"}))
+	assert.True(t, path.Subscribes(HookEdit, EndpointJSON, "root", []string{"owners", "a/b", "name"}), "writes below the path")
+	assert.True(t, path.Subscribes(HookEdit, EndpointJSON, "root", []string{"owners"}), "writes above the path")
+	assert.True(t, path.Subscribes(HookEdit, EndpointJSON, "root", []string{}), "writes of the root key")
+	assert.False(t, path.Subscribes(HookEdit, EndpointJSON, "root", []string{"owners", "c"}))
+	assert.False(t, path.Subscribes(HookEdit, EndpointJSON, "root", []string{"pets"}))
+}
+
+func TestWebHookUnmarshalEvent(t *testing.T) {
+	w := &WebHook{}
+	assert.Nil(t, json.Unmarshal([]byte(`{"entity": "resource", "event": "edit", "headers": []}`), w))
+	assert.Equal(t, []string{HookEdit}, w.HookEvents)
+
+	assert.Nil(t, json.Unmarshal([]byte(`{"entity": "resource", "event": "edit", "events": ["create", "delete"], "headers": []}`), w))
+	assert.Equal(t, []string{HookCreate, HookDelete}, w.HookEvents)
+
+	b, err := json.Marshal(w)
+	assert.Nil(t, err)
+	assert.Contains(t, string(b), `"events":["create","delete"]`)
+}
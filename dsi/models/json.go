@@ -1,5 +1,17 @@
 package models
 
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+
+	"github.com/go-openapi/spec"
+	"github.com/go-openapi/strfmt"
+	"github.com/go-openapi/validate"
+)
+
 // RootKey defines the metadata of a project root JSON key
 type RootKey struct {
 	ID        string `json:"id"`
@@ -9,4 +21,208 @@ type RootKey struct {
 	Read      bool   `json:"read"`
 	Update    bool   `json:"update"`
 	Delete    bool   `json:"delete"`
+	// Schema is an optional JSON Schema of the whole tree
+	Schema json.RawMessage `json:"schema,omitempty"`
+	// Rules are optional expressions which further limit access to the paths of the tree
+	Rules []*JSONRule `json:"rules,omitempty"`
+}
+
+// JSONRule allows reads or writes of the paths matching the pattern, i.e. `/users/$uid`, when its expression is true.
+// Keys of the pattern starting with `$` match any key, which the expressions can reference as variables.
+type JSONRule struct {
+	Path  string `json:"path"`
+	Read  string `json:"read,omitempty"`
+	Write string `json:"write,omitempty"`
+}
+
+// JSONValidator validates the resulting tree of a write before it is saved
+type JSONValidator func(tree []byte) error
+
+// HasSchema returns true if the trees of the root key are validated against a schema
+func (k *RootKey) HasSchema() bool {
+	return len(k.Schema) > 0 && string(k.Schema) != "null"
+}
+
+// ValidateSchema verifies the schema of the root key is a JSON Schema object
+func (k *RootKey) ValidateSchema() error {
+	if !k.HasSchema() {
+		return nil
+	}
+
+	schema := map[string]interface{}{}
+	if err := json.Unmarshal(k.Schema, &schema); err != nil {
+		return errors.New("schema must be a JSON Schema object")
+	}
+	if err := json.Unmarshal(k.Schema, new(spec.Schema)); err != nil {
+		return fmt.Errorf("invalid schema: %s", err.Error())
+	}
+
+	return nil
+}
+
+// ValidateTree validates the tree against the schema of the root key
+func (k *RootKey) ValidateTree(tree []byte) error {
+	if !k.HasSchema() {
+		return nil
+	}
+
+	schema := new(spec.Schema)
+	if err := json.Unmarshal(k.Schema, schema); err != nil {
+		return err
+	}
+
+	var data interface{}
+	if err := json.Unmarshal(tree, &data); err != nil {
+		return err
+	}
+
+	res := validate.NewSchemaValidator(schema, nil, "", strfmt.Default).Validate(data)
+	if res.HasErrors() {
+		return newValidationErrors(res.Errors, schema, data)
+	}
+
+	return nil
+}
+
+// Validator returns the validator of the root key trees, nil if the root key has no schema
+func (k *RootKey) Validator() JSONValidator {
+	if !k.HasSchema() {
+		return nil
+	}
+	return k.ValidateTree
+}
+
+// JSON tree operations, applied atomically to the value at a path
+const (
+	// JSONOpIncrement adds `value` to a number, missing values start at 0
+	JSONOpIncrement = "increment"
+	// JSONOpDecrement subtracts `value` from a number, missing values start at 0
+	JSONOpDecrement = "decrement"
+	// JSONOpAppend appends `value` to an array, missing values start as an empty array
+	JSONOpAppend = "append"
+	// JSONOpRemove removes every element equal to `value` from an array
+	JSONOpRemove = "remove"
+	// JSONOpAddToSet appends `value` to an array if no element is equal to it
+	JSONOpAddToSet = "addToSet"
+	// JSONOpCompareAndSwap sets `value` if the current value is equal to `expected`, `null` matches missing values
+	JSONOpCompareAndSwap = "compareAndSwap"
+)
+
+// ErrJSONOperationConflict is returned when the current value does not allow the operation, i.e. incrementing a string
+// or a compare-and-swap against a value which has changed
+var ErrJSONOperationConflict = errors.New("operation conflicts with the current value")
+
+// JSONOperation is an atomic operation on the value at a JSON tree path
+type JSONOperation struct {
+	Op       string          `json:"op"`
+	Value    json.RawMessage `json:"value"`
+	Expected json.RawMessage `json:"expected"`
+}
+
+// Validate verifies the operation is supported and has the values it requires
+func (op *JSONOperation) Validate() error {
+	if len(op.Value) == 0 {
+		return errors.New("'value' is required")
+	}
+
+	switch op.Op {
+	case JSONOpIncrement, JSONOpDecrement:
+		var n float64
+		if err := json.Unmarshal(op.Value, &n); err != nil {
+			return fmt.Errorf("'value' of '%s' must be a number", op.Op)
+		}
+	case JSONOpAppend, JSONOpRemove, JSONOpAddToSet:
+	case JSONOpCompareAndSwap:
+		if len(op.Expected) == 0 {
+			return fmt.Errorf("'expected' is required for '%s'", op.Op)
+		}
+	default:
+		return fmt.Errorf("unsupported operation '%s'", op.Op)
+	}
+
+	return nil
+}
+
+// JSON tree query orderings, any other `orderBy` is the dot separated path of a value of each child, i.e. `profile.age`
+const (
+	// JSONOrderByKey orders children by their key
+	JSONOrderByKey = "$key"
+	// JSONOrderByValue orders children by their value
+	JSONOrderByValue = "$value"
+)
+
+// JSONQuery reads part of a JSON tree object, either the keys of its children or the children ordered and filtered by
+// a key, value or child path
+type JSONQuery struct {
+	// Shallow returns the keys of the children with a value of `true`
+	Shallow      bool
+	OrderBy      string
+	LimitToFirst int
+	LimitToLast  int
+	// StartAt and EndAt are inclusive JSON bounds of the ordered value
+	StartAt json.RawMessage
+	EndAt   json.RawMessage
+}
+
+// ChildPath returns the path of the ordered value of each child
+func (q *JSONQuery) ChildPath() []string {
+	return strings.Split(q.OrderBy, ".")
+}
+
+// Apply returns the value resulting from the operation on the current value, mirroring the datastore operations.
+// `ErrJSONOperationConflict` is returned if the current value does not allow the operation.
+func (op *JSONOperation) Apply(current interface{}) (interface{}, error) {
+	var value interface{}
+	if err := json.Unmarshal(op.Value, &value); err != nil {
+		return nil, err
+	}
+
+	switch op.Op {
+	case JSONOpIncrement, JSONOpDecrement:
+		n, isNumber := current.(float64)
+		if current != nil && !isNumber {
+			return nil, ErrJSONOperationConflict
+		}
+		delta, _ := value.(float64)
+		if op.Op == JSONOpDecrement {
+			delta = -delta
+		}
+		return n + delta, nil
+	case JSONOpAppend, JSONOpAddToSet:
+		arr, isArray := current.([]interface{})
+		if current != nil && !isArray {
+			return nil, ErrJSONOperationConflict
+		}
+		if op.Op == JSONOpAddToSet {
+			for _, element := range arr {
+				if reflect.DeepEqual(element, value) {
+					return arr, nil
+				}
+			}
+		}
+		return append(append([]interface{}{}, arr...), value), nil
+	case JSONOpRemove:
+		arr, isArray := current.([]interface{})
+		if !isArray {
+			return nil, ErrJSONOperationConflict
+		}
+		remaining := []interface{}{}
+		for _, element := range arr {
+			if !reflect.DeepEqual(element, value) {
+				remaining = append(remaining, element)
+			}
+		}
+		return remaining, nil
+	case JSONOpCompareAndSwap:
+		var expected interface{}
+		if err := json.Unmarshal(op.Expected, &expected); err != nil {
+			return nil, err
+		}
+		if !reflect.DeepEqual(current, expected) {
+			return nil, ErrJSONOperationConflict
+		}
+		return value, nil
+	}
+
+	return nil, fmt.Errorf("unsupported operation '%s'", op.Op)
 }
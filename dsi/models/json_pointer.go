@@ -0,0 +1,45 @@
+package models
+
+import (
+	"errors"
+	"strings"
+)
+
+// JSONPointerAppend is the pointer token which refers to the position after the last element of an array
+const JSONPointerAppend = "-"
+
+// ErrInvalidJSONPointer is returned for pointers which are not valid RFC 6901 JSON Pointers
+var ErrInvalidJSONPointer = errors.New("invalid JSON pointer, '~' must be escaped as '~0' and '/' as '~1'")
+
+// ParseJSONPointer parses an RFC 6901 JSON Pointer, i.e. `/dogs/0/a~1b`, into its unescaped reference tokens. The
+// empty pointer refers to the whole document and returns no tokens.
+func ParseJSONPointer(pointer string) ([]string, error) {
+	if pointer == "" {
+		return []string{}, nil
+	}
+	if !strings.HasPrefix(pointer, "/") {
+		return nil, errors.New("invalid JSON pointer, must start with '/'")
+	}
+
+	tokens := strings.Split(pointer[1:], "/")
+	for i, token := range tokens {
+		// every '~' must start an escape sequence
+		if strings.Count(token, "~") != strings.Count(token, "~0")+strings.Count(token, "~1") {
+			return nil, ErrInvalidJSONPointer
+		}
+		// '~1' is unescaped before '~0' so that '~01' becomes '~1'
+		tokens[i] = strings.Replace(strings.Replace(token, "~1", "/", -1), "~0", "~", -1)
+	}
+
+	return tokens, nil
+}
+
+// JSONPointer escapes the keys as an RFC 6901 JSON Pointer, the inverse of `ParseJSONPointer`
+func JSONPointer(keys []string) string {
+	var sb strings.Builder
+	for _, key := range keys {
+		sb.WriteString("/")
+		sb.WriteString(strings.Replace(strings.Replace(key, "~", "~0", -1), "/", "~1", -1))
+	}
+	return sb.String()
+}
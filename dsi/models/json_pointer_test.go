@@ -0,0 +1,41 @@
+package models
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseJSONPointer(t *testing.T) {
+	tables := []struct {
+		in       string
+		expected []string
+		isErr    bool
+	}{
+		{"", []string{}, false},
+		{"/dogs", []string{"dogs"}, false},
+		{"/dogs/0/name", []string{"dogs", "0", "name"}, false},
+		{"/dogs/-", []string{"dogs", "-"}, false},
+		{"/a~1b/c~0d", []string{"a/b", "c~d"}, false},
+		{"/~01", []string{"~1"}, false},
+		{"/a,b/{c}/\"d\"", []string{"a,b", "{c}", "\"d\""}, false},
+		{"/a//b", []string{"a", "", "b"}, false},
+		{"dogs", nil, true},
+		{"/a~b", nil, true},
+		{"/a~", nil, true},
+	}
+
+	for _, tt := range tables {
+		tokens, err := ParseJSONPointer(tt.in)
+		assert.Equal(t, tt.isErr, err != nil, tt.in)
+		assert.Equal(t, tt.expected, tokens, tt.in)
+	}
+}
+
+func TestJSONPointer(t *testing.T) {
+	assert.Equal(t, "", JSONPointer([]string{}))
+	assert.Equal(t, "/a~1b/c~0d/0", JSONPointer([]string{"a/b", "c~d", "0"}))
+
+	keys, _ := ParseJSONPointer(JSONPointer([]string{"~1", "x/y"}))
+	assert.Equal(t, []string{"~1", "x/y"}, keys)
+}
@@ -0,0 +1,115 @@
+package models
+
+import (
+	"encoding/json"
+	"reflect"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// Reasons a snapshot of a root key was taken
+const (
+	// SnapshotManual snapshots are taken through the management API and kept until they are deleted
+	SnapshotManual = "manual"
+	// SnapshotWrite snapshots are taken before writes which replace or remove data, only the latest are kept
+	SnapshotWrite = "write"
+	// SnapshotDelete snapshots are taken before a root key is deleted, and kept for a grace period
+	SnapshotDelete = "delete"
+)
+
+// JSONSnapshot is a copy of the tree and settings of a root key
+type JSONSnapshot struct {
+	ID        string `json:"id"`
+	ProjectID string `json:"project_id"`
+	RootKey   string `json:"root_key"`
+	Reason    string `json:"reason"`
+	// Size is the size of the tree in bytes
+	Size    int        `json:"size"`
+	Expires *time.Time `json:"expires,omitempty"`
+	Created time.Time  `json:"created"`
+	// Settings are the access policies, schema and rules of the root key, used to recreate a deleted root key
+	Settings *RootKey        `json:"settings,omitempty"`
+	Data     json.RawMessage `json:"data,omitempty"`
+}
+
+// Kinds of JSON changes, named after the JSON Patch (RFC 6902) operations
+const (
+	JSONChangeAdd     = "add"
+	JSONChangeRemove  = "remove"
+	JSONChangeReplace = "replace"
+)
+
+// JSONChange is a difference between two JSON values at the path
+type JSONChange struct {
+	Op       string      `json:"op"`
+	Path     string      `json:"path"`
+	Value    interface{} `json:"value,omitempty"`
+	Previous interface{} `json:"previous,omitempty"`
+}
+
+// DiffJSON returns the changes from one decoded JSON value to another. Objects and arrays are compared by key and
+// index, every other change replaces the value.
+func DiffJSON(from, to interface{}) []*JSONChange {
+	return diffJSON([]string{}, from, to, []*JSONChange{})
+}
+
+func diffJSON(keys []string, from, to interface{}, changes []*JSONChange) []*JSONChange {
+	path := func(key string) []string {
+		return append(append([]string{}, keys...), key)
+	}
+
+	switch f := from.(type) {
+	case map[string]interface{}:
+		t, ok := to.(map[string]interface{})
+		if !ok {
+			break
+		}
+
+		names := make([]string, 0, len(f)+len(t))
+		for name := range f {
+			names = append(names, name)
+		}
+		for name := range t {
+			if _, ok := f[name]; !ok {
+				names = append(names, name)
+			}
+		}
+		sort.Strings(names)
+
+		for _, name := range names {
+			fv, inFrom := f[name]
+			tv, inTo := t[name]
+			if !inTo {
+				changes = append(changes, &JSONChange{Op: JSONChangeRemove, Path: JSONPointer(path(name)), Previous: fv})
+			} else if !inFrom {
+				changes = append(changes, &JSONChange{Op: JSONChangeAdd, Path: JSONPointer(path(name)), Value: tv})
+			} else {
+				changes = diffJSON(path(name), fv, tv, changes)
+			}
+		}
+		return changes
+	case []interface{}:
+		t, ok := to.([]interface{})
+		if !ok {
+			break
+		}
+
+		for i := 0; i < len(f) && i < len(t); i++ {
+			changes = diffJSON(path(strconv.Itoa(i)), f[i], t[i], changes)
+		}
+		for i := len(f); i < len(t); i++ {
+			changes = append(changes, &JSONChange{Op: JSONChangeAdd, Path: JSONPointer(path(strconv.Itoa(i))), Value: t[i]})
+		}
+		// removed from the end, so the indexes of earlier changes stay valid
+		for i := len(f) - 1; i >= len(t); i-- {
+			changes = append(changes, &JSONChange{Op: JSONChangeRemove, Path: JSONPointer(path(strconv.Itoa(i))), Previous: f[i]})
+		}
+		return changes
+	}
+
+	if !reflect.DeepEqual(from, to) {
+		changes = append(changes, &JSONChange{Op: JSONChangeReplace, Path: JSONPointer(keys), Value: to, Previous: from})
+	}
+	return changes
+}
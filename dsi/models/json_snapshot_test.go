@@ -0,0 +1,26 @@
+package models
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDiffJSON(t *testing.T) {
+	var from, to interface{}
+	json.Unmarshal([]byte(`{"name": "rex", "age": 2, "tags": ["a", "b", "c"], "owner": {"id": 1}}`), &from)
+	json.Unmarshal([]byte(`{"name": "rex", "age": 3, "tags": ["a", "x"], "owner": "ann", "a/b": true}`), &to)
+
+	changes := DiffJSON(from, to)
+	assert.Equal(t, []*JSONChange{
+		{Op: JSONChangeAdd, Path: "/a~1b", Value: true},
+		{Op: JSONChangeReplace, Path: "/age", Value: float64(3), Previous: float64(2)},
+		{Op: JSONChangeReplace, Path: "/owner", Value: "ann", Previous: map[string]interface{}{"id": float64(1)}},
+		{Op: JSONChangeReplace, Path: "/tags/1", Value: "x", Previous: "b"},
+		{Op: JSONChangeRemove, Path: "/tags/2", Previous: "c"},
+	}, changes)
+
+	assert.Empty(t, DiffJSON(from, from))
+	assert.Equal(t, []*JSONChange{{Op: JSONChangeReplace, Path: "", Value: nil, Previous: from}}, DiffJSON(from, nil))
+}
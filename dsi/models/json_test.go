@@ -0,0 +1,69 @@
+package models
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestJSONOperationValidate(t *testing.T) {
+	tables := []struct {
+		in    string
+		isErr bool
+	}{
+		{`{"op": "increment", "value": 1}`, false},
+		{`{"op": "decrement", "value": 2.5}`, false},
+		{`{"op": "increment", "value": "1"}`, true},
+		{`{"op": "increment"}`, true},
+		{`{"op": "append", "value": {"name": "fido"}}`, false},
+		{`{"op": "addToSet", "value": null}`, false},
+		{`{"op": "compareAndSwap", "value": 2, "expected": null}`, false},
+		{`{"op": "compareAndSwap", "value": 2}`, true},
+		{`{"op": "multiply", "value": 2}`, true},
+	}
+
+	for _, tt := range tables {
+		op := &JSONOperation{}
+		assert.Nil(t, json.Unmarshal([]byte(tt.in), op), tt.in)
+		assert.Equal(t, tt.isErr, op.Validate() != nil, tt.in)
+	}
+}
+
+func TestRootKeyValidateTree(t *testing.T) {
+	key := &RootKey{Key: "app"}
+	assert.Nil(t, key.Validator(), "root keys without a schema are not validated")
+
+	key.Schema = json.RawMessage(`{
+		"type": "object",
+		"properties": {
+			"dogs": {
+				"type": "array",
+				"items": {"type": "object", "properties": {"age": {"type": "integer", "maximum": 30}}}
+			}
+		}
+	}`)
+	assert.Nil(t, key.ValidateSchema())
+	assert.Nil(t, key.ValidateTree([]byte(`{"dogs": [{"age": 2}]}`)))
+
+	err := key.ValidateTree([]byte(`{"dogs": [{"age": 2}, {"age": 31}]}`))
+	errs, ok := err.(ValidationErrors)
+	assert.True(t, ok)
+	assert.Equal(t, "/dogs/1/age", errs[0].Path)
+	assert.Equal(t, "maximum", errs[0].Keyword)
+	assert.Equal(t, float64(31), errs[0].Actual)
+
+	// each invalid element is reported
+	err = key.ValidateTree([]byte(`{"dogs": [{"age": 40}, {"age": 2}, {"age": 31}]}`))
+	errs, _ = err.(ValidationErrors)
+	assert.Equal(t, 2, len(errs))
+	paths := []string{errs[0].Path, errs[1].Path}
+	assert.Contains(t, paths, "/dogs/0/age")
+	assert.Contains(t, paths, "/dogs/2/age")
+
+	key.Schema = json.RawMessage(`[]`)
+	assert.NotNil(t, key.ValidateSchema())
+
+	key.Schema = json.RawMessage(`null`)
+	assert.False(t, key.HasSchema())
+}
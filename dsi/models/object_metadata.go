@@ -23,13 +23,19 @@ type MetaData struct {
 	Creator     string `json:"creator"`
 	CreatorType string `json:"creator_type"`
 	Created     int64  `json:"created"`
+	// Distance is the distance in meters to the point of a `near` query
+	Distance *float64 `json:"distance,omitempty"`
 }
 
 // Map returns the metadata object as a map[string]interface{}
 func (md *MetaData) Map() map[string]interface{} {
-	return map[string]interface{}{
+	m := map[string]interface{}{
 		"creator":      md.Creator,
 		"creator_type": md.CreatorType,
 		"created":      md.Created,
 	}
+	if md.Distance != nil {
+		m["distance"] = *md.Distance
+	}
+	return m
 }
@@ -0,0 +1,207 @@
+package models
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+
+	"github.com/machinable/machinable/auth"
+)
+
+// FieldPermission is the read and write access policy of a single resource property. The policy is defined with
+// keywords on the property of the resource schema, for example:
+//
+//	"owner": {
+//	  "type": "string",
+//	  "x-write-once": true,
+//	  "x-read-roles": ["admin"]
+//	}
+type FieldPermission struct {
+	// ReadOnly properties can not be set through the API
+	ReadOnly bool `json:"readOnly"`
+	// WriteOnce properties can be set when the document is created (or while empty), but not changed afterwards
+	WriteOnce bool `json:"x-write-once"`
+	// Hidden properties are never returned in responses
+	Hidden bool `json:"x-hidden"`
+	// ReadRoles are the only roles that can see the property, any role if empty
+	ReadRoles []string `json:"x-read-roles"`
+	// WriteRoles are the only roles that can set the property, any role if empty
+	WriteRoles []string `json:"x-write-roles"`
+	// Format of the property, `file` properties can only be set by uploading a file
+	Format string `json:"format"`
+}
+
+// restricted returns true if the policy restricts access in any way
+func (p *FieldPermission) restricted() bool {
+	return p.ReadOnly || p.WriteOnce || p.Hidden || len(p.ReadRoles) > 0 || len(p.WriteRoles) > 0 || p.isFile()
+}
+
+// isFile returns true if the property references an attached file
+func (p *FieldPermission) isFile() bool {
+	return p.Format == FormatFile
+}
+
+// CanRead returns true if the role is allowed to see the property
+func (p *FieldPermission) CanRead(role string) bool {
+	if p.Hidden {
+		return false
+	}
+	return len(p.ReadRoles) == 0 || containsRole(p.ReadRoles, role)
+}
+
+// CanWrite returns true if the role is allowed to set the property
+func (p *FieldPermission) CanWrite(role string) bool {
+	if p.ReadOnly {
+		return false
+	}
+	return len(p.WriteRoles) == 0 || containsRole(p.WriteRoles, role)
+}
+
+// writeError returns the validation error for a field the role is not allowed to set
+func (p *FieldPermission) writeError(field string, value interface{}, format string) *ValidationError {
+	keyword := "x-write-roles"
+	if p.ReadOnly {
+		keyword = "readOnly"
+	} else if p.isFile() {
+		keyword = "format"
+		format = "'%s' is a file and can only be set through the document files"
+	} else if p.WriteOnce {
+		keyword = "x-write-once"
+	}
+
+	return &ValidationError{
+		Path:    JSONPointer([]string{field}),
+		Keyword: keyword,
+		Actual:  value,
+		Message: fmt.Sprintf(format, field),
+	}
+}
+
+// validate verifies the roles of the policy are known roles
+func (p *FieldPermission) validate(field string) error {
+	for _, roles := range [][]string{p.ReadRoles, p.WriteRoles} {
+		for _, role := range roles {
+			if !validFieldRole(role) {
+				return fmt.Errorf("invalid role '%s' for property '%s'", role, field)
+			}
+		}
+	}
+	return nil
+}
+
+// FieldPermissions maps resource property names to their access policy. Only properties with a restricted policy are
+// included.
+type FieldPermissions map[string]*FieldPermission
+
+// CanRead returns true if the role is allowed to see the field
+func (fp FieldPermissions) CanRead(field, role string) bool {
+	if perm, ok := fp[field]; ok {
+		return perm.CanRead(role)
+	}
+	return true
+}
+
+// CanWrite returns true if the role is allowed to set the field. `existing` is the current document, if any.
+func (fp FieldPermissions) CanWrite(field, role string, existing map[string]interface{}) bool {
+	perm, ok := fp[field]
+	if !ok {
+		return true
+	}
+	if _, hadValue := existing[field]; perm.WriteOnce && hadValue {
+		return false
+	}
+	return perm.CanWrite(role)
+}
+
+// Strip removes the fields of the document that the role is not allowed to see
+func (fp FieldPermissions) Strip(doc map[string]interface{}, role string) {
+	for field, perm := range fp {
+		if !perm.CanRead(role) {
+			delete(doc, field)
+		}
+	}
+}
+
+// CheckCreate returns an error if the new object contains a field the role is not allowed to set
+func (fp FieldPermissions) CheckCreate(obj ResourceObject, role string) error {
+	errs := ValidationErrors{}
+	for field, perm := range fp {
+		if value, ok := obj[field]; ok && (!perm.CanWrite(role) || perm.isFile()) {
+			errs = append(errs, perm.writeError(field, value, "'%s' cannot be set"))
+		}
+	}
+	if len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
+
+// ApplyUpdate checks the updated object against the existing document. An error is returned if the object changes a
+// field the role is not allowed to set. Fields the role is not allowed to set which are missing from the object are
+// copied from the existing document, so a full update does not erase data the requester could not see or change.
+func (fp FieldPermissions) ApplyUpdate(obj ResourceObject, existing map[string]interface{}, role string) error {
+	errs := ValidationErrors{}
+	for field, perm := range fp {
+		oldValue, hadValue := existing[field]
+		locked := !perm.CanWrite(role) || perm.isFile() || (perm.WriteOnce && hadValue)
+		if !locked {
+			continue
+		}
+
+		newValue, setValue := obj[field]
+		if !setValue {
+			if hadValue {
+				obj[field] = oldValue
+			}
+			continue
+		}
+
+		if !hadValue || !reflect.DeepEqual(newValue, oldValue) {
+			errs = append(errs, perm.writeError(field, newValue, "'%s' cannot be changed"))
+		}
+	}
+	if len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
+
+// GetFieldPermissions returns the access policies of the definition's schema properties
+func (def *ResourceDefinition) GetFieldPermissions() (FieldPermissions, error) {
+	schema := struct {
+		Properties map[string]*FieldPermission `json:"properties"`
+	}{}
+	if err := json.Unmarshal([]byte(def.Schema), &schema); err != nil {
+		return nil, err
+	}
+
+	permissions := FieldPermissions{}
+	for field, perm := range schema.Properties {
+		if perm != nil && perm.restricted() {
+			permissions[field] = perm
+		}
+	}
+
+	return permissions, nil
+}
+
+func containsRole(roles []string, role string) bool {
+	for _, r := range roles {
+		if r == role {
+			return true
+		}
+	}
+	return false
+}
+
+func validFieldRole(role string) bool {
+	if role == auth.RoleAnon {
+		return true
+	}
+	for _, r := range auth.ValidRoles {
+		if r == role {
+			return true
+		}
+	}
+	return false
+}
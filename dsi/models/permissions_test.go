@@ -0,0 +1,68 @@
+package models
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const permissionsSchema = `{
+	"type": "object",
+	"properties": {
+		"name": {"type": "string"},
+		"status": {"type": "string", "readOnly": true},
+		"owner": {"type": "string", "x-write-once": true},
+		"secret": {"type": "string", "x-hidden": true},
+		"notes": {"type": "string", "x-read-roles": ["admin"], "x-write-roles": ["admin"]},
+		"photo": {"type": "string", "format": "file"}
+	}
+}`
+
+func TestFieldPermissions(t *testing.T) {
+	def := &ResourceDefinition{Schema: permissionsSchema}
+	permissions, err := def.GetFieldPermissions()
+	assert.Nil(t, err)
+	assert.Len(t, permissions, 5)
+
+	doc := map[string]interface{}{"name": "a", "status": "new", "owner": "x", "secret": "s", "notes": "n"}
+	permissions.Strip(doc, "user")
+	assert.Equal(t, map[string]interface{}{"name": "a", "status": "new", "owner": "x"}, doc)
+
+	tables := []struct {
+		name     string
+		role     string
+		obj      ResourceObject
+		existing map[string]interface{}
+		isErr    bool
+	}{
+		{"create unrestricted", "user", ResourceObject{"name": "a", "owner": "x"}, nil, false},
+		{"create read only", "admin", ResourceObject{"status": "done"}, nil, true},
+		{"create role restricted", "user", ResourceObject{"notes": "n"}, nil, true},
+		{"create role allowed", "admin", ResourceObject{"notes": "n"}, nil, false},
+		{"update write once unchanged", "user", ResourceObject{"owner": "x"}, map[string]interface{}{"owner": "x"}, false},
+		{"update write once changed", "user", ResourceObject{"owner": "y"}, map[string]interface{}{"owner": "x"}, true},
+		{"update write once unset", "user", ResourceObject{"owner": "y"}, map[string]interface{}{}, false},
+		{"update read only changed", "admin", ResourceObject{"status": "done"}, map[string]interface{}{"status": "new"}, true},
+		{"create file", "admin", ResourceObject{"photo": "x"}, nil, true},
+		{"update file unchanged", "user", ResourceObject{"photo": "x"}, map[string]interface{}{"photo": "x"}, false},
+		{"update file changed", "admin", ResourceObject{"photo": "y"}, map[string]interface{}{"photo": "x"}, true},
+	}
+
+	for _, tt := range tables {
+		t.Run(tt.name, func(t *testing.T) {
+			var err error
+			if tt.existing == nil {
+				err = permissions.CheckCreate(tt.obj, tt.role)
+			} else {
+				err = permissions.ApplyUpdate(tt.obj, tt.existing, tt.role)
+			}
+			assert.Equal(t, tt.isErr, err != nil)
+		})
+	}
+
+	// fields the requester can not set are carried over from the existing document
+	obj := ResourceObject{"name": "b"}
+	err = permissions.ApplyUpdate(obj, map[string]interface{}{"status": "new", "notes": "n"}, "user")
+	assert.Nil(t, err)
+	assert.Equal(t, ResourceObject{"name": "b", "status": "new", "notes": "n"}, obj)
+}
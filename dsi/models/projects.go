@@ -40,5 +40,6 @@ type ProjectDetail struct {
 	Authn            bool       `json:"authn"`
 	UserRegistration bool       `json:"user_registration"`
 	Requests         int        `json:"requests"`
+	Storage          int        `json:"storage"` // Storage is the tier storage limit, in megabytes
 	Hooks            []*WebHook `json:"hooks"`
 }
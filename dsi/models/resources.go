@@ -4,7 +4,6 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
-	"strings"
 	"time"
 
 	"github.com/go-openapi/spec"
@@ -16,10 +15,18 @@ import (
 // ResourceObject is a custom type which wraps a map[string]interface
 type ResourceObject map[string]interface{}
 
-// Validate validates that the object matches the schema
+// Validate validates that the object matches the schema. Validation failures are returned as `ValidationErrors`,
+// any other error means the schema of the definition could not be read.
 func (obj *ResourceObject) Validate(definition *ResourceDefinition) error {
-	if err := dsi.ContainsReservedField(*obj); err != nil {
-		return err
+	for key := range *obj {
+		if dsi.ReservedField(key) {
+			return ValidationErrors{{
+				Path:    JSONPointer([]string{key}),
+				Keyword: "reserved",
+				Actual:  (*obj)[key],
+				Message: fmt.Sprintf("'%s' is a reserved field", key),
+			}}
+		}
 	}
 
 	schema := new(spec.Schema)
@@ -37,13 +44,11 @@ func (obj *ResourceObject) Validate(definition *ResourceDefinition) error {
 	// validate data against schema
 	res := validate.NewSchemaValidator(schema, nil, "", strfmt.Default).Validate(data)
 	if res.HasErrors() {
-		errs := []string{}
-		for _, e := range res.Errors {
-			errs = append(errs, e.Error())
-		}
-		return errors.New(strings.Join(errs, ","))
+		return newValidationErrors(res.Errors, schema, data)
 	}
-	return nil
+
+	// formats which are not strings are validated separately
+	return obj.validateGeoPoints(definition)
 }
 
 // JSONSchemaObject is a simplified representation of the root schema
@@ -71,6 +76,7 @@ type ResourceDefinition struct {
 	Read          bool      `json:"read"`
 	Update        bool      `json:"update"`
 	Delete        bool      `json:"delete"`
+	Upsert        bool      `json:"upsert"`  // Upsert allows documents to be created by PUT with a client supplied ID
 	Created       time.Time `json:"created"` // Created is the timestamp the resource was created
 	Schema        string    `json:"schema"`  // Properties is the string representation of the JSON schema properties
 }
@@ -110,6 +116,7 @@ func (def *ResourceDefinition) MarshalJSON() ([]byte, error) {
 		Read          bool             `json:"read"`
 		Update        bool             `json:"update"`
 		Delete        bool             `json:"delete"`
+		Upsert        bool             `json:"upsert"`
 		Created       time.Time        `json:"created"` // Created is the timestamp the resource was created
 		Schema        JSONSchemaObject `json:"schema"`  // Properties is the string representation of the JSON schema properties
 	}{
@@ -123,6 +130,7 @@ func (def *ResourceDefinition) MarshalJSON() ([]byte, error) {
 		Read:          def.Read,
 		Update:        def.Update,
 		Delete:        def.Delete,
+		Upsert:        def.Upsert,
 		Created:       def.Created,
 		Schema:        schema,
 	})
@@ -141,6 +149,7 @@ func (def *ResourceDefinition) UnmarshalJSON(b []byte) error {
 		Read          bool            `json:"read"`
 		Update        bool            `json:"update"`
 		Delete        bool            `json:"delete"`
+		Upsert        bool            `json:"upsert"`
 	}{}
 
 	err := json.Unmarshal(b, &payload)
@@ -159,6 +168,7 @@ func (def *ResourceDefinition) UnmarshalJSON(b []byte) error {
 	def.Read = payload.Read
 	def.Update = payload.Update
 	def.Delete = payload.Delete
+	def.Upsert = payload.Upsert
 
 	return nil
 }
@@ -177,6 +187,8 @@ func (def *ResourceDefinition) Validate() error {
 		return errors.New("resource schema cannot be empty")
 	} else if !dsi.ValidPathFormat.MatchString(def.PathName) {
 		return errors.New("invalid path name: only alphanumeric, dashes, and underscores allowed")
+	} else if dsi.ReservedPathName(def.PathName) {
+		return fmt.Errorf("'%s' is a reserved path name", def.PathName)
 	}
 
 	objectSchema := JSONSchemaObject{}
@@ -193,6 +205,24 @@ func (def *ResourceDefinition) Validate() error {
 	schema := new(spec.Schema)
 
 	err = json.Unmarshal([]byte(def.Schema), schema)
+	if err != nil {
+		return err
+	}
+
+	// validate field level access policies
+	permissions, err := def.GetFieldPermissions()
+	if err != nil {
+		return err
+	}
+	for field, perm := range permissions {
+		if err := perm.validate(field); err != nil {
+			return err
+		}
+	}
+
+	if err := def.validateFileFields(); err != nil {
+		return err
+	}
 
-	return err
+	return def.validateGeoFields()
 }
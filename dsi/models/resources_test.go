@@ -0,0 +1,21 @@
+package models
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestResourceDefinitionReservedPathName(t *testing.T) {
+	def := &ResourceDefinition{Title: "Dogs", PathName: "dogs", Schema: `{"type": "object", "properties": {}}`}
+	assert.Nil(t, def.Validate())
+
+	def.PathName = "_changes"
+	assert.NotNil(t, def.Validate())
+
+	// paths of the documents of a resource can be resource path names
+	for _, name := range []string{"_stream", "_validate"} {
+		def.PathName = name
+		assert.Nil(t, def.Validate(), name)
+	}
+}
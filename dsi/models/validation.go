@@ -0,0 +1,317 @@
+package models
+
+import (
+	"strconv"
+	"strings"
+
+	oaErrors "github.com/go-openapi/errors"
+	"github.com/go-openapi/spec"
+	"github.com/go-openapi/strfmt"
+	"github.com/go-openapi/validate"
+)
+
+// ValidationError is a single validation failure of a resource object
+type ValidationError struct {
+	Path     string      `json:"path"`               // Path is the JSON Pointer (RFC 6901) to the invalid value
+	Keyword  string      `json:"keyword"`            // Keyword is the JSON Schema keyword that failed
+	Expected interface{} `json:"expected,omitempty"` // Expected is the value of the keyword in the schema
+	Actual   interface{} `json:"actual,omitempty"`   // Actual is the invalid value
+	Message  string      `json:"message"`
+}
+
+func (e *ValidationError) Error() string {
+	return e.Message
+}
+
+// ValidationErrors is the list of validation failures of a resource object
+type ValidationErrors []*ValidationError
+
+func (e ValidationErrors) Error() string {
+	messages := make([]string, len(e))
+	for i, err := range e {
+		messages[i] = err.Message
+	}
+	return strings.Join(messages, "; ")
+}
+
+// AsValidationErrors returns the error as `ValidationErrors`. Errors which are not validation failures are returned
+// as a single `ValidationError` with only the message set.
+func AsValidationErrors(err error) ValidationErrors {
+	switch e := err.(type) {
+	case nil:
+		return nil
+	case ValidationErrors:
+		return e
+	case *ValidationError:
+		return ValidationErrors{e}
+	default:
+		return ValidationErrors{{Message: err.Error()}}
+	}
+}
+
+// keywords maps the go-openapi validation error codes to their JSON Schema keyword
+var keywords = map[int32]string{
+	oaErrors.InvalidTypeCode:           "type",
+	oaErrors.RequiredFailCode:          "required",
+	oaErrors.TooLongFailCode:           "maxLength",
+	oaErrors.TooShortFailCode:          "minLength",
+	oaErrors.PatternFailCode:           "pattern",
+	oaErrors.EnumFailCode:              "enum",
+	oaErrors.MultipleOfFailCode:        "multipleOf",
+	oaErrors.MaxFailCode:               "maximum",
+	oaErrors.MinFailCode:               "minimum",
+	oaErrors.UniqueFailCode:            "uniqueItems",
+	oaErrors.MaxItemsFailCode:          "maxItems",
+	oaErrors.MinItemsFailCode:          "minItems",
+	oaErrors.NoAdditionalItemsCode:     "additionalItems",
+	oaErrors.TooFewPropertiesCode:      "minProperties",
+	oaErrors.TooManyPropertiesCode:     "maxProperties",
+	oaErrors.UnallowedPropertyCode:     "additionalProperties",
+	oaErrors.FailedAllPatternPropsCode: "patternProperties",
+}
+
+// newValidationErrors translates the go-openapi validation result errors of `data` against `schema`
+func newValidationErrors(errs []error, schema *spec.Schema, data interface{}) ValidationErrors {
+	return translateValidationErrors(errs, schema, data, map[string]bool{})
+}
+
+// translateValidationErrors translates the errors, `resolved` holds the errors of array items already reported
+func translateValidationErrors(errs []error, schema *spec.Schema, data interface{}, resolved map[string]bool) ValidationErrors {
+	result := make(ValidationErrors, 0, len(errs))
+	for _, err := range errs {
+		switch e := err.(type) {
+		case *oaErrors.CompositeError:
+			result = append(result, translateValidationErrors(e.Errors, schema, data, resolved)...)
+		case *oaErrors.Validation:
+			for _, segments := range resolveItemIndexes(e, schema, data, resolved) {
+				result = append(result, newValidationError(e, schema, data, segments))
+			}
+		default:
+			result = append(result, &ValidationError{Message: err.Error()})
+		}
+	}
+	return result
+}
+
+func newValidationError(e *oaErrors.Validation, schema *spec.Schema, data interface{}, segments []string) *ValidationError {
+	keyword := keywords[e.Code()]
+
+	// the name of a forbidden property is the value of the error
+	if e.Code() == oaErrors.UnallowedPropertyCode || e.Code() == oaErrors.FailedAllPatternPropsCode {
+		if key, ok := e.Value.(string); ok {
+			segments = append(segments, key)
+		}
+	}
+
+	sub := schemaAt(schema, segments)
+	actual, _ := valueAt(data, segments)
+
+	var expected interface{}
+	switch keyword {
+	case "type":
+		if sub != nil && len(sub.Type) > 0 {
+			expected = strings.Join(sub.Type, ",")
+		}
+		// format failures are reported as type failures with the format name
+		if sub != nil && sub.Format != "" && sub.Type.Contains("string") {
+			if _, isString := actual.(string); isString {
+				keyword = "format"
+				expected = sub.Format
+			}
+		}
+	case "enum":
+		expected = e.Values
+	case "required":
+		actual = nil
+	case "additionalProperties":
+		expected = false
+	default:
+		expected = schemaKeyword(sub, keyword)
+	}
+
+	return &ValidationError{
+		Path:     JSONPointer(segments),
+		Keyword:  keyword,
+		Expected: expected,
+		Actual:   actual,
+		Message:  strings.TrimPrefix(strings.Replace(e.Error(), " in body", "", 1), "."),
+	}
+}
+
+// schemaKeyword returns the value of the validation keyword for the schema
+func schemaKeyword(s *spec.Schema, keyword string) interface{} {
+	if s == nil {
+		return nil
+	}
+
+	switch keyword {
+	case "maxLength":
+		return derefInt(s.MaxLength)
+	case "minLength":
+		return derefInt(s.MinLength)
+	case "pattern":
+		return s.Pattern
+	case "multipleOf":
+		return derefFloat(s.MultipleOf)
+	case "maximum":
+		return derefFloat(s.Maximum)
+	case "minimum":
+		return derefFloat(s.Minimum)
+	case "uniqueItems":
+		return s.UniqueItems
+	case "maxItems":
+		return derefInt(s.MaxItems)
+	case "minItems":
+		return derefInt(s.MinItems)
+	case "maxProperties":
+		return derefInt(s.MaxProperties)
+	case "minProperties":
+		return derefInt(s.MinProperties)
+	}
+	return nil
+}
+
+// splitValidationName splits the dotted property name used by go-openapi
+func splitValidationName(name string) []string {
+	name = strings.Trim(name, ".")
+	if name == "" {
+		return []string{}
+	}
+	return strings.Split(name, ".")
+}
+
+// resolveItemIndexes adds the array indexes which go-openapi leaves out of the names of array item properties, i.e.
+// `dogs.age` is resolved to `dogs.1.age` by validating each element of `dogs`. go-openapi reports the same error of
+// several elements once, so the error is resolved to every invalid element which has not already been reported.
+func resolveItemIndexes(e *oaErrors.Validation, schema *spec.Schema, data interface{}, resolved map[string]bool) [][]string {
+	segments := splitValidationName(e.Name)
+	candidates := itemCandidates(schema, data, segments, e.Code())
+	if len(candidates) == 0 {
+		return [][]string{segments}
+	}
+
+	paths := [][]string{}
+	for _, candidate := range candidates {
+		key := e.Error() + JSONPointer(candidate)
+		if !resolved[key] {
+			resolved[key] = true
+			paths = append(paths, candidate)
+		}
+	}
+	return paths
+}
+
+// itemCandidates returns the paths along the segments with an error of the code, trying every element of arrays which
+// are not indexed by the segments
+func itemCandidates(schema *spec.Schema, data interface{}, segments []string, code int32) [][]string {
+	current := data
+	for k, segment := range segments {
+		switch value := current.(type) {
+		case map[string]interface{}:
+			current = value[segment]
+		case []interface{}:
+			if i, err := strconv.Atoi(segment); err == nil {
+				if i < 0 || i >= len(value) {
+					return nil
+				}
+				current = value[i]
+				continue
+			}
+
+			sub := schemaAt(schema, segments[:k])
+			if sub == nil || sub.Items == nil || sub.Items.Schema == nil {
+				return nil
+			}
+			items, rest := sub.Items.Schema, segments[k:]
+
+			candidates := [][]string{}
+			for i, element := range value {
+				res := validate.NewSchemaValidator(items, nil, "", strfmt.Default).Validate(element)
+				if !hasValidationError(res.Errors, rest, code) {
+					continue
+				}
+				for _, candidate := range itemCandidates(items, element, rest, code) {
+					path := append(append([]string{}, segments[:k]...), strconv.Itoa(i))
+					candidates = append(candidates, append(path, candidate...))
+				}
+			}
+			return candidates
+		default:
+			return [][]string{segments}
+		}
+	}
+	return [][]string{segments}
+}
+
+// hasValidationError returns true if the errors include an error of the code at the segments
+func hasValidationError(errs []error, segments []string, code int32) bool {
+	name := strings.Join(segments, ".")
+	for _, err := range errs {
+		switch e := err.(type) {
+		case *oaErrors.CompositeError:
+			if hasValidationError(e.Errors, segments, code) {
+				return true
+			}
+		case *oaErrors.Validation:
+			if e.Code() == code && strings.Trim(e.Name, ".") == name {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// schemaAt returns the sub schema of the property path, or nil if the path is not defined by the schema
+func schemaAt(schema *spec.Schema, segments []string) *spec.Schema {
+	current := schema
+	for _, segment := range segments {
+		if current == nil {
+			return nil
+		}
+		if prop, ok := current.Properties[segment]; ok {
+			current = &prop
+		} else if current.Items != nil && current.Items.Schema != nil {
+			current = current.Items.Schema
+		} else {
+			return nil
+		}
+	}
+	return current
+}
+
+// valueAt returns the value of the data at the property path, segments of arrays are indexes
+func valueAt(data interface{}, segments []string) (interface{}, bool) {
+	current := data
+	for _, segment := range segments {
+		switch value := current.(type) {
+		case map[string]interface{}:
+			var ok bool
+			if current, ok = value[segment]; !ok {
+				return nil, false
+			}
+		case []interface{}:
+			i, err := strconv.Atoi(segment)
+			if err != nil || i < 0 || i >= len(value) {
+				return nil, false
+			}
+			current = value[i]
+		default:
+			return nil, false
+		}
+	}
+	return current, true
+}
+
+func derefInt(i *int64) interface{} {
+	if i == nil {
+		return nil
+	}
+	return *i
+}
+
+func derefFloat(f *float64) interface{} {
+	if f == nil {
+		return nil
+	}
+	return *f
+}
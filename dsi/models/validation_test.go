@@ -0,0 +1,55 @@
+package models
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const validationSchema = `{
+	"type": "object",
+	"required": ["name"],
+	"additionalProperties": false,
+	"properties": {
+		"name": {"type": "string", "maxLength": 5},
+		"email": {"type": "string", "format": "email"},
+		"address": {
+			"type": "object",
+			"properties": {
+				"zip": {"type": "integer", "maximum": 99999}
+			}
+		}
+	}
+}`
+
+func TestValidationErrors(t *testing.T) {
+	def := &ResourceDefinition{Schema: validationSchema}
+
+	tables := []struct {
+		name     string
+		obj      ResourceObject
+		path     string
+		keyword  string
+		expected interface{}
+	}{
+		{"required", ResourceObject{}, "/name", "required", nil},
+		{"max length", ResourceObject{"name": "abcdefg"}, "/name", "maxLength", int64(5)},
+		{"format", ResourceObject{"name": "a", "email": "nope"}, "/email", "format", "email"},
+		{"nested maximum", ResourceObject{"name": "a", "address": map[string]interface{}{"zip": 100000}}, "/address/zip", "maximum", float64(99999)},
+		{"additional property", ResourceObject{"name": "a", "a/b": 1}, "/a~1b", "additionalProperties", false},
+		{"reserved", ResourceObject{"name": "a", "_metadata": 1}, "/_metadata", "reserved", nil},
+	}
+
+	for _, tt := range tables {
+		t.Run(tt.name, func(t *testing.T) {
+			errs := AsValidationErrors(tt.obj.Validate(def))
+			if assert.Len(t, errs, 1) {
+				assert.Equal(t, tt.path, errs[0].Path)
+				assert.Equal(t, tt.keyword, errs[0].Keyword)
+				assert.Equal(t, tt.expected, errs[0].Expected)
+			}
+		})
+	}
+
+	assert.Nil(t, (&ResourceObject{"name": "a"}).Validate(def))
+}
@@ -0,0 +1,203 @@
+package postgres
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/lib/pq"
+	"github.com/machinable/machinable/dsi/models"
+)
+
+// channelChanges is the channel the `notify_change` triggers of resource documents and JSON trees notify on
+const channelChanges = "project_changes"
+
+// ListenChanges listens for the changes notified by the `notify_change` triggers, calling `fn` with each change. The
+// data of changes too large to notify is read from the table, so it may include later writes. Changes notified while
+// the listener reconnects are missed.
+func (d *Database) ListenChanges(fn func(change []byte)) error {
+	listener := pq.NewListener(d.connStr, 10*time.Second, time.Minute, func(event pq.ListenerEventType, err error) {
+		if err != nil {
+			log.Println(err)
+		}
+	})
+	defer listener.Close()
+
+	if err := listener.Listen(channelChanges); err != nil {
+		return err
+	}
+
+	for notification := range listener.Notify {
+		// nil notifications are sent after reconnecting
+		if notification == nil {
+			continue
+		}
+
+		change, err := d.completeChange([]byte(notification.Extra))
+		if err != nil {
+			log.Println(err)
+			continue
+		}
+		fn(change)
+	}
+
+	return errors.New("change listener closed")
+}
+
+// completeChange reads the data of a truncated change from the table
+func (d *Database) completeChange(payload []byte) ([]byte, error) {
+	change := map[string]json.RawMessage{}
+	if err := json.Unmarshal(payload, &change); err != nil {
+		return nil, err
+	}
+	if _, truncated := change["truncated"]; !truncated {
+		return payload, nil
+	}
+	delete(change, "truncated")
+
+	var entity, action, projectID, entityKey, documentID string
+	json.Unmarshal(change["entity"], &entity)
+	json.Unmarshal(change["action"], &action)
+	json.Unmarshal(change["project_id"], &projectID)
+	json.Unmarshal(change["entity_key"], &entityKey)
+	json.Unmarshal(change["document_id"], &documentID)
+
+	if action != "delete" {
+		var data []byte
+		var err error
+		if entity == "resource" {
+			doc, dsiErr := d.GetDefDocument(projectID, entityKey, documentID, map[string]interface{}{})
+			if dsiErr != nil {
+				return nil, dsiErr
+			}
+			data, err = json.Marshal(doc)
+		} else {
+			data, err = d.GetJSONKey(projectID, entityKey)
+		}
+		if err != nil {
+			return nil, err
+		}
+		change["data"] = data
+	}
+
+	return json.Marshal(change)
+}
+
+const tableProjectChanges = "project_changes"
+
+// ListChanges lists the changes of the scopes after the `since` change, in order
+func (d *Database) ListChanges(projectID string, since int64, limit int64, scopes []*models.ChangeScope) ([]*models.ProjectChange, error) {
+	changes := make([]*models.ProjectChange, 0)
+	if len(scopes) == 0 {
+		return changes, nil
+	}
+
+	args := []interface{}{projectID, since}
+	index := 3
+
+	scopeString := make([]string, 0, len(scopes))
+	for _, scope := range scopes {
+		clause := fmt.Sprintf("(entity=$%d AND entity_key=$%d", index, index+1)
+		args = append(args, scope.Entity, scope.EntityKey)
+		index += 2
+		if scope.Creator != "" {
+			clause += fmt.Sprintf(" AND creator=$%d", index)
+			args = append(args, scope.Creator)
+			index++
+		}
+		scopeString = append(scopeString, clause+")")
+	}
+	args = append(args, limit)
+
+	rows, err := d.db.Query(
+		fmt.Sprintf(
+			"SELECT id, entity, entity_key, document_id, action, creator, data, created FROM %s WHERE project_id=$1 AND id>$2 AND (%s) ORDER BY id LIMIT $%d",
+			tableProjectChanges,
+			strings.Join(scopeString, " OR "),
+			index,
+		),
+		args...,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		change := models.ProjectChange{}
+		var documentID, creator sql.NullString
+		var data []byte
+		err = rows.Scan(
+			&change.Seq,
+			&change.Entity,
+			&change.EntityKey,
+			&documentID,
+			&change.Action,
+			&creator,
+			&data,
+			&change.Created,
+		)
+		if err != nil {
+			return nil, err
+		}
+		change.DocumentID = documentID.String
+		change.Creator = creator.String
+		change.Data = data
+
+		changes = append(changes, &change)
+	}
+
+	return changes, rows.Err()
+}
+
+// GetChangeHorizon returns the latest tombstone of the project removed by compaction, 0 if none were
+func (d *Database) GetChangeHorizon(projectID string) (int64, error) {
+	var horizon int64
+	err := d.db.QueryRow(
+		"SELECT id FROM project_change_compactions WHERE project_id=$1",
+		projectID,
+	).Scan(&horizon)
+	if err == sql.ErrNoRows {
+		return 0, nil
+	}
+
+	return horizon, err
+}
+
+// CompactChanges removes the changes older than `retention` which have been superseded by a later change of the same
+// document or root key, and the tombstones older than `retention`, raising the horizon of their projects
+func (d *Database) CompactChanges(retention time.Duration) error {
+	tx, err := d.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec(
+		fmt.Sprintf(
+			"DELETE FROM %[1]s AS c WHERE c.created < NOW() - $1::int * interval '1 second' AND EXISTS (SELECT 1 FROM %[1]s AS l WHERE l.project_id=c.project_id AND l.entity=c.entity AND l.entity_key=c.entity_key AND l.document_id IS NOT DISTINCT FROM c.document_id AND l.id > c.id)",
+			tableProjectChanges,
+		),
+		int(retention/time.Second),
+	)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(
+		fmt.Sprintf(
+			"WITH removed AS (DELETE FROM %s WHERE created < NOW() - $1::int * interval '1 second' AND action='delete' RETURNING project_id, id) INSERT INTO project_change_compactions (project_id, id) SELECT project_id, MAX(id) FROM removed GROUP BY project_id ON CONFLICT (project_id) DO UPDATE SET id=GREATEST(project_change_compactions.id, EXCLUDED.id)",
+			tableProjectChanges,
+		),
+		int(retention/time.Second),
+	)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
@@ -26,6 +26,9 @@ func (p *Database) TranslateError(err error) *models.TranslatedError {
 			return models.NewTranslatedError(http.StatusBadRequest, errors.New("key already exists"))
 		case "22023":
 			return models.NewTranslatedError(http.StatusBadRequest, errors.New("key already exists"))
+		case "22P02":
+			// invalid json data, or a path key which is not an index of an array
+			return models.NewTranslatedError(http.StatusBadRequest, errors.New(strings.TrimPrefix(err.Error(), "pq: ")))
 		default:
 			fmt.Println(err)
 			fmt.Println(err.Code)
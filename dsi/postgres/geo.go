@@ -0,0 +1,53 @@
+package postgres
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/machinable/machinable/dsi/models"
+)
+
+// geoFilterToQuery appends the clauses of the geo filter on the geopoint `field` of the document data. If the filter
+// has a `Near` point, the great-circle (haversine) distance expression to the point is returned, in meters.
+func geoFilterToQuery(field string, geo *models.GeoFilter, filterString *[]string, args *[]interface{}, index *int) string {
+	point := fmt.Sprintf("data->'%s'", strings.Replace(field, "'", "''", -1))
+	// the coordinates are only cast if they are numbers, CASE guarantees the order of evaluation
+	lat := fmt.Sprintf("(CASE WHEN jsonb_typeof(%s->'lat')='number' THEN (%s->>'lat')::float8 END)", point, point)
+	lon := fmt.Sprintf("(CASE WHEN jsonb_typeof(%s->'lon')='number' THEN (%s->>'lon')::float8 END)", point, point)
+
+	// documents without a valid point never match
+	*filterString = append(*filterString, fmt.Sprintf("%s IS NOT NULL AND %s IS NOT NULL", lat, lon))
+
+	distance := ""
+	if geo.Near != nil {
+		*args = append(*args, geo.Near.Lat, geo.Near.Lon)
+		latParam, lonParam := *index, *index+1
+		*index += 2
+
+		distance = fmt.Sprintf(
+			"(%f * 2 * asin(least(1, sqrt(power(sin(radians(%s - $%d::float8) / 2), 2) + cos(radians($%d::float8)) * cos(radians(%s)) * power(sin(radians(%s - $%d::float8) / 2), 2)))))",
+			models.EarthRadius, lat, latParam, latParam, lat, lon, lonParam,
+		)
+
+		if geo.Within > 0 {
+			*args = append(*args, geo.Within)
+			*filterString = append(*filterString, fmt.Sprintf("%s<=$%d::float8", distance, *index))
+			*index++
+		}
+	}
+
+	if geo.Box != nil {
+		*args = append(*args, geo.Box.Min.Lat, geo.Box.Max.Lat, geo.Box.Min.Lon, geo.Box.Max.Lon)
+		*filterString = append(*filterString, fmt.Sprintf("%s BETWEEN $%d::float8 AND $%d::float8", lat, *index, *index+1))
+
+		// boxes crossing the antimeridian wrap around
+		lonOp := "AND"
+		if geo.Box.Min.Lon > geo.Box.Max.Lon {
+			lonOp = "OR"
+		}
+		*filterString = append(*filterString, fmt.Sprintf("(%s>=$%d::float8 %s %s<=$%d::float8)", lon, *index+2, lonOp, lon, *index+3))
+		*index += 4
+	}
+
+	return distance
+}
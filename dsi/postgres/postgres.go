@@ -12,9 +12,17 @@ import (
 	_ "github.com/lib/pq"
 )
 
+// queryer is implemented by both `*sql.DB` and `*sql.Tx`, so queries can be shared inside and outside of transactions
+type queryer interface {
+	Exec(query string, args ...interface{}) (sql.Result, error)
+	Query(query string, args ...interface{}) (*sql.Rows, error)
+	QueryRow(query string, args ...interface{}) *sql.Row
+}
+
 // Database is a wrapper for the PostgreSQL connection
 type Database struct {
-	db *sql.DB
+	db      *sql.DB
+	connStr string
 }
 
 // New creates and returns a pointer to a new instance of `Database`
@@ -26,7 +34,8 @@ func New(user, password, host, database string) (*Database, error) {
 	}
 
 	return &Database{
-		db: db,
+		db:      db,
+		connStr: connStr,
 	}, nil
 }
 
@@ -0,0 +1,262 @@
+package postgres
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+
+	dsiErrors "github.com/machinable/machinable/dsi/errors"
+	"github.com/machinable/machinable/dsi/models"
+)
+
+const tableProjectFiles = "project_files"
+
+const fileFields = "id, project_id, resource_path, document_id, field, name, content_type, size, created"
+
+type scanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanFile(row scanner) (*models.File, error) {
+	file := models.File{}
+	err := row.Scan(
+		&file.ID,
+		&file.ProjectID,
+		&file.ResourcePath,
+		&file.DocumentID,
+		&file.Field,
+		&file.Name,
+		&file.ContentType,
+		&file.Size,
+		&file.Created,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return &file, nil
+}
+
+// deleteDefDocumentFile deletes the file of the document field, returning nil if the field has no file
+func (d *Database) deleteDefDocumentFile(q queryer, projectID, path, documentID, field string) (*models.File, error) {
+	file, err := scanFile(q.QueryRow(
+		fmt.Sprintf(
+			"DELETE FROM %s WHERE project_id=$1 AND resource_path=$2 AND document_id=$3 AND field=$4 RETURNING %s",
+			tableProjectFiles,
+			fileFields,
+		),
+		projectID,
+		path,
+		documentID,
+		field,
+	))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	return file, err
+}
+
+// AttachDefDocumentFile saves the file metadata and sets the field of the document to the file ID, replacing the
+// previous file of the field. The replaced file is returned so its contents can be removed from storage.
+func (d *Database) AttachDefDocumentFile(projectID, path, documentID string, file *models.File) (*models.File, *dsiErrors.DatastoreError) {
+	tx, err := d.db.Begin()
+	if err != nil {
+		return nil, dsiErrors.New(dsiErrors.UnknownError, err)
+	}
+	defer tx.Rollback()
+
+	res, err := tx.Exec(
+		fmt.Sprintf(
+			"UPDATE %s SET data=jsonb_set(data, ARRAY[$1]::text[], to_jsonb($2::text)) WHERE project_id=$3 AND resource_path=$4 AND id=$5",
+			tableProjectResourceObjects,
+		),
+		file.Field,
+		file.ID,
+		projectID,
+		path,
+		documentID,
+	)
+	if err != nil {
+		return nil, dsiErrors.New(dsiErrors.UnknownError, err)
+	}
+	if count, _ := res.RowsAffected(); count == 0 {
+		return nil, dsiErrors.New(dsiErrors.NotFound, fmt.Errorf("document not found"))
+	}
+
+	replaced, err := d.deleteDefDocumentFile(tx, projectID, path, documentID, file.Field)
+	if err != nil {
+		return nil, dsiErrors.New(dsiErrors.UnknownError, err)
+	}
+
+	file.ProjectID = projectID
+	file.ResourcePath = path
+	file.DocumentID = documentID
+	file.Created = time.Now()
+
+	_, err = tx.Exec(
+		fmt.Sprintf(
+			"INSERT INTO %s (%s) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)",
+			tableProjectFiles,
+			fileFields,
+		),
+		file.ID,
+		file.ProjectID,
+		file.ResourcePath,
+		file.DocumentID,
+		file.Field,
+		file.Name,
+		file.ContentType,
+		file.Size,
+		file.Created,
+	)
+	if err != nil {
+		return nil, dsiErrors.New(dsiErrors.UnknownError, err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, dsiErrors.New(dsiErrors.UnknownError, err)
+	}
+
+	return replaced, nil
+}
+
+// DetachDefDocumentFile deletes the file metadata of the field and removes the field from the document
+func (d *Database) DetachDefDocumentFile(projectID, path, documentID, field string) (*models.File, *dsiErrors.DatastoreError) {
+	tx, err := d.db.Begin()
+	if err != nil {
+		return nil, dsiErrors.New(dsiErrors.UnknownError, err)
+	}
+	defer tx.Rollback()
+
+	file, err := d.deleteDefDocumentFile(tx, projectID, path, documentID, field)
+	if err != nil {
+		return nil, dsiErrors.New(dsiErrors.UnknownError, err)
+	}
+	if file == nil {
+		return nil, dsiErrors.New(dsiErrors.NotFound, fmt.Errorf("file not found"))
+	}
+
+	_, err = tx.Exec(
+		fmt.Sprintf(
+			"UPDATE %s SET data=data - $1 WHERE project_id=$2 AND resource_path=$3 AND id=$4",
+			tableProjectResourceObjects,
+		),
+		field,
+		projectID,
+		path,
+		documentID,
+	)
+	if err != nil {
+		return nil, dsiErrors.New(dsiErrors.UnknownError, err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, dsiErrors.New(dsiErrors.UnknownError, err)
+	}
+
+	return file, nil
+}
+
+// GetDefDocumentFile retrieves the file metadata of the document field
+func (d *Database) GetDefDocumentFile(projectID, path, documentID, field string) (*models.File, *dsiErrors.DatastoreError) {
+	file, err := scanFile(d.db.QueryRow(
+		fmt.Sprintf(
+			"SELECT %s FROM %s WHERE project_id=$1 AND resource_path=$2 AND document_id=$3 AND field=$4",
+			fileFields,
+			tableProjectFiles,
+		),
+		projectID,
+		path,
+		documentID,
+		field,
+	))
+	if err == sql.ErrNoRows {
+		return nil, dsiErrors.New(dsiErrors.NotFound, fmt.Errorf("file not found"))
+	} else if err != nil {
+		return nil, dsiErrors.New(dsiErrors.UnknownError, err)
+	}
+
+	return file, nil
+}
+
+// ListDefDocumentFiles retrieves the metadata of all files of the document
+func (d *Database) ListDefDocumentFiles(projectID, path, documentID string) ([]*models.File, *dsiErrors.DatastoreError) {
+	rows, err := d.db.Query(
+		fmt.Sprintf(
+			"SELECT %s FROM %s WHERE project_id=$1 AND resource_path=$2 AND document_id=$3 ORDER BY field",
+			fileFields,
+			tableProjectFiles,
+		),
+		projectID,
+		path,
+		documentID,
+	)
+	if err != nil {
+		return nil, dsiErrors.New(dsiErrors.UnknownError, err)
+	}
+	defer rows.Close()
+
+	files := make([]*models.File, 0)
+	for rows.Next() {
+		file, err := scanFile(rows)
+		if err != nil {
+			return nil, dsiErrors.New(dsiErrors.UnknownError, err)
+		}
+		files = append(files, file)
+	}
+
+	return files, nil
+}
+
+// DropDefDocumentFiles deletes the metadata of all files of the document
+func (d *Database) DropDefDocumentFiles(projectID, path, documentID string) *dsiErrors.DatastoreError {
+	_, err := d.db.Exec(
+		fmt.Sprintf(
+			"DELETE FROM %s WHERE project_id=$1 AND resource_path=$2 AND document_id=$3",
+			tableProjectFiles,
+		),
+		projectID,
+		path,
+		documentID,
+	)
+
+	return dsiErrors.New(dsiErrors.UnknownError, err)
+}
+
+// GetFileStats returns the total size and count of the files of a project
+func (d *Database) GetFileStats(projectID string) (*models.Stats, *dsiErrors.DatastoreError) {
+	stats := models.Stats{}
+	err := d.db.QueryRow(
+		fmt.Sprintf(
+			"SELECT COALESCE(sum(size), 0), count(*) FROM %s WHERE project_id=$1",
+			tableProjectFiles,
+		),
+		projectID,
+	).Scan(
+		&stats.Size,
+		&stats.Count,
+	)
+	if err != nil {
+		return nil, dsiErrors.New(dsiErrors.UnknownError, err)
+	}
+
+	return &stats, nil
+}
+
+// GetProjectStorageSize returns the size in bytes of all resource documents and files of a project
+func (d *Database) GetProjectStorageSize(projectID string) (int64, *dsiErrors.DatastoreError) {
+	var size int64
+	err := d.db.QueryRow(
+		fmt.Sprintf(
+			"SELECT (SELECT COALESCE(sum(pg_column_size(%s)), 0) FROM %s WHERE project_id=$1) + (SELECT COALESCE(sum(size), 0) FROM %s WHERE project_id=$1)",
+			tableProjectResourceObjects,
+			tableProjectResourceObjects,
+			tableProjectFiles,
+		),
+		projectID,
+	).Scan(&size)
+	if err != nil {
+		return 0, dsiErrors.New(dsiErrors.UnknownError, err)
+	}
+
+	return size, nil
+}
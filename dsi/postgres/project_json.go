@@ -1,6 +1,8 @@
 package postgres
 
 import (
+	"database/sql"
+	"encoding/json"
 	"fmt"
 	"strings"
 
@@ -14,9 +16,10 @@ const tableProjectJSON = "project_json"
 // GetRootKey retrieves a single root key by the key name
 func (d *Database) GetRootKey(projectID, rootKey string) (*models.RootKey, error) {
 	newKey := models.RootKey{}
+	var schema, rules []byte
 	err := d.db.QueryRow(
 		fmt.Sprintf(
-			"SELECT id, project_id, root_key, \"create\", \"read\", \"update\", \"delete\" FROM %s WHERE project_id=$1 and root_key=$2",
+			"SELECT id, project_id, root_key, \"create\", \"read\", \"update\", \"delete\", schema, rules FROM %s WHERE project_id=$1 and root_key=$2",
 			tableProjectJSON,
 		),
 		projectID,
@@ -29,16 +32,22 @@ func (d *Database) GetRootKey(projectID, rootKey string) (*models.RootKey, error
 		&newKey.Read,
 		&newKey.Update,
 		&newKey.Delete,
+		&schema,
+		&rules,
 	)
+	if err != nil {
+		return &newKey, err
+	}
+	newKey.Schema = schema
 
-	return &newKey, err
+	return &newKey, scanRules(&newKey, rules)
 }
 
-// ListRootKeys lists all root keys with associated metadata, does not include jsonb
+// ListRootKeys lists all root keys with associated metadata and schemas, does not include the tree
 func (d *Database) ListRootKeys(projectID string) ([]*models.RootKey, error) {
 	rows, err := d.db.Query(
 		fmt.Sprintf(
-			"SELECT id, project_id, root_key, \"create\", \"read\", \"update\", \"delete\" FROM %s WHERE project_id=$1",
+			"SELECT id, project_id, root_key, \"create\", \"read\", \"update\", \"delete\", schema, rules FROM %s WHERE project_id=$1",
 			tableProjectJSON,
 		),
 		projectID,
@@ -51,6 +60,7 @@ func (d *Database) ListRootKeys(projectID string) ([]*models.RootKey, error) {
 	rootKeys := make([]*models.RootKey, 0)
 	for rows.Next() {
 		rootKey := models.RootKey{}
+		var schema, rules []byte
 		err = rows.Scan(
 			&rootKey.ID,
 			&rootKey.ProjectID,
@@ -59,10 +69,16 @@ func (d *Database) ListRootKeys(projectID string) ([]*models.RootKey, error) {
 			&rootKey.Read,
 			&rootKey.Update,
 			&rootKey.Delete,
+			&schema,
+			&rules,
 		)
 		if err != nil {
 			return nil, err
 		}
+		rootKey.Schema = schema
+		if err := scanRules(&rootKey, rules); err != nil {
+			return nil, err
+		}
 
 		rootKeys = append(rootKeys, &rootKey)
 	}
@@ -97,19 +113,46 @@ func (d *Database) CreateRootKey(projectID, rootKey string, data []byte) error {
 func (d *Database) UpdateRootKey(projectID string, rootKey *models.RootKey) error {
 	_, err := d.db.Exec(
 		fmt.Sprintf(
-			"UPDATE %s set \"create\"=$1, \"read\"=$2, \"update\"=$3, \"delete\"=$4 WHERE project_id=$5 and root_key=$6",
+			"UPDATE %s set \"create\"=$1, \"read\"=$2, \"update\"=$3, \"delete\"=$4, schema=$5, rules=$6 WHERE project_id=$7 and root_key=$8",
 			tableProjectJSON,
 		),
 		rootKey.Create,
 		rootKey.Read,
 		rootKey.Update,
 		rootKey.Delete,
+		schemaValue(rootKey),
+		rulesValue(rootKey),
 		projectID,
 		rootKey.Key,
 	)
 	return err
 }
 
+// schemaValue binds the schema of the root key, root keys without a schema are NULL
+func schemaValue(rootKey *models.RootKey) interface{} {
+	if !rootKey.HasSchema() {
+		return nil
+	}
+	return string(rootKey.Schema)
+}
+
+// rulesValue binds the rules of the root key, root keys without rules are NULL
+func rulesValue(rootKey *models.RootKey) interface{} {
+	if len(rootKey.Rules) == 0 {
+		return nil
+	}
+	b, _ := json.Marshal(rootKey.Rules)
+	return string(b)
+}
+
+// scanRules unmarshals the rules column of the root key
+func scanRules(rootKey *models.RootKey, rules []byte) error {
+	if len(rules) == 0 {
+		return nil
+	}
+	return json.Unmarshal(rules, &rootKey.Rules)
+}
+
 //DeleteRootKey permanently deletes an entire rootkey's tree
 func (d *Database) DeleteRootKey(projectID, rootKey string) error {
 	_, err := d.db.Exec(
@@ -123,82 +166,297 @@ func (d *Database) DeleteRootKey(projectID, rootKey string) error {
 	return err
 }
 
+// textArray binds the keys as a `text[]` parameter, no keys is the empty path rather than NULL
+func textArray(keys []string) interface{} {
+	if keys == nil {
+		keys = []string{}
+	}
+	return pq.Array(keys)
+}
+
+// appendPath returns the path of the parent of the keys if the last key is the `-` append token
+func appendPath(keys []string) ([]string, bool) {
+	if len(keys) == 0 || keys[len(keys)-1] != models.JSONPointerAppend {
+		return nil, false
+	}
+	return keys[:len(keys)-1], true
+}
+
+// jsonbWrite returns the expression to write $1 at the $2 path with the jsonb function `fn`. If the last key is the
+// `-` append token, $1 is appended to the array at the $3 parent path instead, objects still get a `-` key.
+func jsonbWrite(fn string, keys []string) (string, []interface{}) {
+	parent, ok := appendPath(keys)
+	if !ok {
+		return fmt.Sprintf("%s(data, $2::text[], $1)", fn), []interface{}{textArray(keys)}
+	}
+
+	return fmt.Sprintf(
+		"CASE WHEN jsonb_typeof(data #> $3::text[]) = 'array' THEN jsonb_insert(data, $3::text[] || '{-1}'::text[], $1, true) ELSE %s(data, $2::text[], $1) END",
+		fn,
+	), []interface{}{textArray(keys), textArray(parent)}
+}
+
 // GetJSONKey retrieves the object at the key path
 func (d *Database) GetJSONKey(projectID, rootKey string, keys ...string) ([]byte, error) {
 	byt := []byte{}
 
-	// escape?
-	keysFormat := strings.Join(keys, ",")
 	err := d.db.QueryRow(
 		fmt.Sprintf(
-			"SELECT data#>'{%s}' as data FROM %s WHERE project_id=$1 and root_key=$2",
-			keysFormat,
+			"SELECT data#>$3::text[] as data FROM %s WHERE project_id=$1 and root_key=$2",
 			tableProjectJSON,
 		),
 		projectID,
 		rootKey,
+		textArray(keys),
 	).Scan(&byt)
 
 	return byt, err
 }
 
+// updateJSONTree runs the update of a root key tree, scanning the `returning` expressions into `dest`. If the root key
+// has a validator, the update runs in a transaction which is only committed if the resulting tree is valid.
+func (d *Database) updateJSONTree(validate models.JSONValidator, query string, args []interface{}, returning []string, dest ...interface{}) error {
+	if validate == nil {
+		if len(returning) == 0 {
+			_, err := d.db.Exec(query, args...)
+			return err
+		}
+		return d.db.QueryRow(query+" RETURNING "+strings.Join(returning, ", "), args...).Scan(dest...)
+	}
+
+	tx, err := d.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var tree []byte
+	err = tx.QueryRow(
+		query+" RETURNING "+strings.Join(append([]string{"data"}, returning...), ", "),
+		args...,
+	).Scan(append([]interface{}{&tree}, dest...)...)
+	if err != nil {
+		return err
+	}
+
+	if err := validate(tree); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
 // CreateJSONKey saves the data at the provided key path. Fails if the key already exists.
-func (d *Database) CreateJSONKey(projectID, rootKey string, data []byte, keys ...string) error {
-	// escape?
-	keysFormat := strings.Join(keys, ",")
-	_, err := d.db.Exec(
+func (d *Database) CreateJSONKey(projectID, rootKey string, data []byte, validate models.JSONValidator, keys ...string) error {
+	write, pathArgs := jsonbWrite("jsonb_insert", keys)
+	args := append([]interface{}{data}, pathArgs...)
+	args = append(args, projectID, rootKey)
+
+	return d.updateJSONTree(
+		validate,
 		fmt.Sprintf(
-			"UPDATE %s set data=jsonb_insert(data, '{%s}', $1) WHERE project_id=$2 and root_key=$3",
+			"UPDATE %s set data=%s WHERE project_id=$%d and root_key=$%d",
 			tableProjectJSON,
-			keysFormat,
+			write,
+			len(args)-1,
+			len(args),
 		),
-		data,
-		projectID,
-		rootKey,
+		args,
+		nil,
 	)
-	return err
 }
 
 // UpdateJSONKey updates the data at the key path. Creates a new key if it does not already exist.
-func (d *Database) UpdateJSONKey(projectID, rootKey string, data []byte, keys ...string) error {
-	// escape?
-	keysFormat := strings.Join(keys, ",")
-	qstr := "UPDATE %s set data=jsonb_set(data, '{%s}', $1) WHERE project_id=$2 and root_key=$3"
-	query := fmt.Sprintf(
-		qstr,
-		tableProjectJSON,
-		keysFormat,
-	)
-
-	if keysFormat == "" {
-		qstr = "UPDATE %s set data=$1 WHERE project_id=$2 and root_key=$3"
-		query = fmt.Sprintf(
-			qstr,
-			tableProjectJSON,
+func (d *Database) UpdateJSONKey(projectID, rootKey string, data []byte, validate models.JSONValidator, keys ...string) error {
+	if len(keys) == 0 {
+		return d.updateJSONTree(
+			validate,
+			fmt.Sprintf(
+				"UPDATE %s set data=$1 WHERE project_id=$2 and root_key=$3",
+				tableProjectJSON,
+			),
+			[]interface{}{data, projectID, rootKey},
+			nil,
 		)
 	}
 
-	_, err := d.db.Exec(
-		query,
-		data,
-		projectID,
-		rootKey,
+	write, pathArgs := jsonbWrite("jsonb_set", keys)
+	args := append([]interface{}{data}, pathArgs...)
+	args = append(args, projectID, rootKey)
+
+	return d.updateJSONTree(
+		validate,
+		fmt.Sprintf(
+			"UPDATE %s set data=%s WHERE project_id=$%d and root_key=$%d",
+			tableProjectJSON,
+			write,
+			len(args)-1,
+			len(args),
+		),
+		args,
+		nil,
 	)
-	return err
 }
 
 // DeleteJSONKey permanently removes the data at the key path.
-func (d *Database) DeleteJSONKey(projectID, rootKey string, keys ...string) error {
-	// escape?
-	keysFormat := strings.Join(keys, ",")
-	_, err := d.db.Exec(
+func (d *Database) DeleteJSONKey(projectID, rootKey string, validate models.JSONValidator, keys ...string) error {
+	return d.updateJSONTree(
+		validate,
 		fmt.Sprintf(
-			"UPDATE %s SET data=data #- '{%s}' WHERE project_id=$1 and root_key=$2",
+			"UPDATE %s SET data=data #- $3::text[] WHERE project_id=$1 and root_key=$2",
 			tableProjectJSON,
-			keysFormat,
 		),
-		projectID,
-		rootKey,
+		[]interface{}{projectID, rootKey, textArray(keys)},
+		nil,
 	)
-	return err
+}
+
+// jsonOperationExpressions returns the expression of the new value at the $2 path and the condition the current value
+// must meet for each operation. $1 is the operation value and $5 the expected value.
+var jsonOperationExpressions = map[string][2]string{
+	models.JSONOpIncrement: {
+		"to_jsonb(COALESCE((data #>> $2::text[])::numeric, 0) + $1::numeric)",
+		"COALESCE(jsonb_typeof(data #> $2::text[]), 'null') IN ('number', 'null')",
+	},
+	models.JSONOpDecrement: {
+		"to_jsonb(COALESCE((data #>> $2::text[])::numeric, 0) - $1::numeric)",
+		"COALESCE(jsonb_typeof(data #> $2::text[]), 'null') IN ('number', 'null')",
+	},
+	models.JSONOpAppend: {
+		"COALESCE(NULLIF(data #> $2::text[], 'null'::jsonb), '[]'::jsonb) || jsonb_build_array($1::jsonb)",
+		"COALESCE(jsonb_typeof(data #> $2::text[]), 'null') IN ('array', 'null')",
+	},
+	models.JSONOpRemove: {
+		"(SELECT COALESCE(jsonb_agg(e.value ORDER BY e.position), '[]'::jsonb) FROM jsonb_array_elements(data #> $2::text[]) WITH ORDINALITY AS e(value, position) WHERE e.value <> $1::jsonb)",
+		"jsonb_typeof(data #> $2::text[]) = 'array'",
+	},
+	models.JSONOpAddToSet: {
+		"CASE WHEN EXISTS(SELECT 1 FROM jsonb_array_elements(COALESCE(NULLIF(data #> $2::text[], 'null'::jsonb), '[]'::jsonb)) AS e(value) WHERE e.value = $1::jsonb) THEN data #> $2::text[] " +
+			"ELSE COALESCE(NULLIF(data #> $2::text[], 'null'::jsonb), '[]'::jsonb) || jsonb_build_array($1::jsonb) END",
+		"COALESCE(jsonb_typeof(data #> $2::text[]), 'null') IN ('array', 'null')",
+	},
+	models.JSONOpCompareAndSwap: {
+		"$1::jsonb",
+		"COALESCE(data #> $2::text[], 'null'::jsonb) = $5::jsonb",
+	},
+}
+
+// ApplyJSONOperation atomically applies the operation to the value at the key path in a single statement, returning
+// the new value. `models.ErrJSONOperationConflict` is returned if the current value does not allow the operation.
+func (d *Database) ApplyJSONOperation(projectID, rootKey string, op *models.JSONOperation, validate models.JSONValidator, keys ...string) ([]byte, error) {
+	expressions, ok := jsonOperationExpressions[op.Op]
+	if !ok {
+		return nil, fmt.Errorf("unsupported operation '%s'", op.Op)
+	}
+
+	args := []interface{}{string(op.Value), textArray(keys), projectID, rootKey}
+	if op.Op == models.JSONOpCompareAndSwap {
+		args = append(args, string(op.Expected))
+	}
+
+	var byt []byte
+	err := d.updateJSONTree(
+		validate,
+		fmt.Sprintf(
+			"UPDATE %s SET data=jsonb_set(data, $2::text[], %s) WHERE project_id=$3 and root_key=$4 AND %s",
+			tableProjectJSON,
+			expressions[0],
+			expressions[1],
+		),
+		args,
+		[]string{"data #> $2::text[]"},
+		&byt,
+	)
+	if err == sql.ErrNoRows {
+		return nil, models.ErrJSONOperationConflict
+	} else if err != nil {
+		return nil, err
+	}
+
+	// the parent of the path does not exist, so nothing was set
+	if byt == nil {
+		return nil, sql.ErrNoRows
+	}
+
+	return byt, nil
+}
+
+// jsonNodeQuery selects the value at the $3 key path as `t.node`
+const jsonNodeQuery = "(SELECT data #> $3::text[] AS node FROM %s WHERE project_id=$1 and root_key=$2) t"
+
+// QueryJSONKey reads the children of the object at the key path as described by the query. Ordered children are
+// returned in order, other values are returned as they are.
+func (d *Database) QueryJSONKey(projectID, rootKey string, query *models.JSONQuery, keys ...string) ([]byte, error) {
+	args := []interface{}{projectID, rootKey, textArray(keys)}
+
+	var selection string
+	if query.Shallow {
+		selection = "CASE jsonb_typeof(t.node) " +
+			"WHEN 'object' THEN (SELECT COALESCE(jsonb_object_agg(k, true), '{}'::jsonb) FROM jsonb_object_keys(t.node) k) " +
+			"WHEN 'array' THEN (SELECT COALESCE(jsonb_object_agg((i - 1)::text, true), '{}'::jsonb) FROM generate_series(1, jsonb_array_length(t.node)) i) " +
+			"ELSE t.node END"
+	} else {
+		// the ordered value of each child, as jsonb
+		order := "to_jsonb(e.key)"
+		switch query.OrderBy {
+		case models.JSONOrderByKey:
+		case models.JSONOrderByValue:
+			order = "e.value"
+		default:
+			args = append(args, textArray(query.ChildPath()))
+			order = fmt.Sprintf("e.value #> $%d::text[]", len(args))
+		}
+
+		conditions := []string{}
+		if len(query.StartAt) > 0 {
+			args = append(args, string(query.StartAt))
+			conditions = append(conditions, fmt.Sprintf("%s >= $%d::jsonb", order, len(args)))
+		}
+		if len(query.EndAt) > 0 {
+			args = append(args, string(query.EndAt))
+			conditions = append(conditions, fmt.Sprintf("%s <= $%d::jsonb", order, len(args)))
+		}
+		where := ""
+		if len(conditions) > 0 {
+			where = "WHERE " + strings.Join(conditions, " AND ")
+		}
+
+		// the last children are selected in reverse, the aggregate always orders ascending
+		direction := "ASC NULLS FIRST"
+		keyDirection := "ASC"
+		var limit interface{}
+		if query.LimitToFirst > 0 {
+			limit = query.LimitToFirst
+		} else if query.LimitToLast > 0 {
+			limit = query.LimitToLast
+			direction = "DESC NULLS LAST"
+			keyDirection = "DESC"
+		}
+		args = append(args, limit)
+
+		selection = fmt.Sprintf(
+			"CASE WHEN jsonb_typeof(t.node) = 'object' THEN ("+
+				"SELECT COALESCE(json_object_agg(c.key, c.value ORDER BY c.sort_value ASC NULLS FIRST, c.key ASC), '{}'::json) FROM ("+
+				"SELECT e.key, e.value, %s AS sort_value FROM jsonb_each(t.node) e %s ORDER BY sort_value %s, e.key %s LIMIT $%d"+
+				") c"+
+				") ELSE t.node::json END",
+			order,
+			where,
+			direction,
+			keyDirection,
+			len(args),
+		)
+	}
+
+	byt := []byte{}
+	err := d.db.QueryRow(
+		fmt.Sprintf(
+			"SELECT %s AS data FROM "+jsonNodeQuery,
+			selection,
+			tableProjectJSON,
+		),
+		args...,
+	).Scan(&byt)
+
+	return byt, err
 }
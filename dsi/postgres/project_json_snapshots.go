@@ -0,0 +1,179 @@
+package postgres
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/machinable/machinable/dsi/models"
+)
+
+const tableProjectJSONSnapshots = "project_json_snapshots"
+
+// snapshotSettings builds the settings of a snapshot from the columns of the root key
+const snapshotSettings = "jsonb_build_object('create', \"create\", 'read', \"read\", 'update', \"update\", 'delete', \"delete\", 'schema', schema, 'rules', rules)"
+
+// CreateJSONSnapshot copies the tree and settings of the root key. Snapshots with a `ttl` expire after it, and if `keep`
+// is greater than 0, only the latest `keep` snapshots of the reason are kept for the root key. Expired snapshots of the
+// project are removed.
+func (d *Database) CreateJSONSnapshot(projectID, rootKey, reason string, ttl time.Duration, keep int) (*models.JSONSnapshot, error) {
+	tx, err := d.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec(
+		fmt.Sprintf(
+			"DELETE FROM %s WHERE project_id=$1 AND expires < NOW()",
+			tableProjectJSONSnapshots,
+		),
+		projectID,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	snapshot := &models.JSONSnapshot{ProjectID: projectID, RootKey: rootKey, Reason: reason}
+	var size sql.NullInt64
+	err = tx.QueryRow(
+		fmt.Sprintf(
+			"INSERT INTO %s (project_id, root_key, reason, settings, data, expires, created) SELECT project_id, root_key, $3, %s, data, NOW() + NULLIF($4::int, 0) * interval '1 second', NOW() FROM %s WHERE project_id=$1 and root_key=$2 RETURNING id, expires, created, octet_length(data::text)",
+			tableProjectJSONSnapshots,
+			snapshotSettings,
+			tableProjectJSON,
+		),
+		projectID,
+		rootKey,
+		reason,
+		int(ttl/time.Second),
+	).Scan(&snapshot.ID, &snapshot.Expires, &snapshot.Created, &size)
+	if err != nil {
+		return nil, err
+	}
+	snapshot.Size = int(size.Int64)
+
+	if keep > 0 {
+		_, err = tx.Exec(
+			fmt.Sprintf(
+				"DELETE FROM %[1]s WHERE project_id=$1 AND root_key=$2 AND reason=$3 AND id NOT IN (SELECT id FROM %[1]s WHERE project_id=$1 AND root_key=$2 AND reason=$3 ORDER BY created DESC LIMIT $4)",
+				tableProjectJSONSnapshots,
+			),
+			projectID,
+			rootKey,
+			reason,
+			keep,
+		)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return snapshot, tx.Commit()
+}
+
+// ListJSONSnapshots lists the snapshots of the root key which have not expired, latest first. Does not include the trees.
+func (d *Database) ListJSONSnapshots(projectID, rootKey string) ([]*models.JSONSnapshot, error) {
+	rows, err := d.db.Query(
+		fmt.Sprintf(
+			"SELECT id, project_id, root_key, reason, octet_length(data::text), expires, created FROM %s WHERE project_id=$1 AND root_key=$2 AND (expires IS NULL OR expires > NOW()) ORDER BY created DESC",
+			tableProjectJSONSnapshots,
+		),
+		projectID,
+		rootKey,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	snapshots := make([]*models.JSONSnapshot, 0)
+	for rows.Next() {
+		snapshot := models.JSONSnapshot{}
+		var size sql.NullInt64
+		err = rows.Scan(
+			&snapshot.ID,
+			&snapshot.ProjectID,
+			&snapshot.RootKey,
+			&snapshot.Reason,
+			&size,
+			&snapshot.Expires,
+			&snapshot.Created,
+		)
+		if err != nil {
+			return nil, err
+		}
+		snapshot.Size = int(size.Int64)
+
+		snapshots = append(snapshots, &snapshot)
+	}
+
+	return snapshots, rows.Err()
+}
+
+// GetJSONSnapshot retrieves a snapshot of the root key which has not expired, including its tree and settings
+func (d *Database) GetJSONSnapshot(projectID, rootKey, snapshotID string) (*models.JSONSnapshot, error) {
+	snapshot := models.JSONSnapshot{}
+	var size sql.NullInt64
+	var settings, data []byte
+	err := d.db.QueryRow(
+		fmt.Sprintf(
+			"SELECT id, project_id, root_key, reason, octet_length(data::text), expires, created, settings, data FROM %s WHERE project_id=$1 AND root_key=$2 AND id=$3 AND (expires IS NULL OR expires > NOW())",
+			tableProjectJSONSnapshots,
+		),
+		projectID,
+		rootKey,
+		snapshotID,
+	).Scan(
+		&snapshot.ID,
+		&snapshot.ProjectID,
+		&snapshot.RootKey,
+		&snapshot.Reason,
+		&size,
+		&snapshot.Expires,
+		&snapshot.Created,
+		&settings,
+		&data,
+	)
+	if err != nil {
+		return nil, err
+	}
+	snapshot.Size = int(size.Int64)
+	snapshot.Data = data
+	if snapshot.Data == nil {
+		snapshot.Data = json.RawMessage("null")
+	}
+
+	if len(settings) > 0 {
+		snapshot.Settings = &models.RootKey{}
+		if err := json.Unmarshal(settings, snapshot.Settings); err != nil {
+			return nil, err
+		}
+		snapshot.Settings.ProjectID = projectID
+		snapshot.Settings.Key = rootKey
+	}
+
+	return &snapshot, nil
+}
+
+// DeleteJSONSnapshot permanently removes a snapshot of the root key
+func (d *Database) DeleteJSONSnapshot(projectID, rootKey, snapshotID string) error {
+	result, err := d.db.Exec(
+		fmt.Sprintf(
+			"DELETE FROM %s WHERE project_id=$1 AND root_key=$2 AND id=$3",
+			tableProjectJSONSnapshots,
+		),
+		projectID,
+		rootKey,
+		snapshotID,
+	)
+	if err != nil {
+		return err
+	}
+
+	if n, err := result.RowsAffected(); err == nil && n == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
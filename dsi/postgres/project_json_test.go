@@ -0,0 +1,162 @@
+package postgres
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// schemaColumns returns the columns of a table of the application schema in `sql/create.sql`
+func schemaColumns(t *testing.T, table string) []string {
+	schema, err := ioutil.ReadFile("../../sql/create.sql")
+	if err != nil {
+		t.Fatal(err)
+	}
+	definition := regexp.MustCompile(`(?s)CREATE TABLE ` + table + `\s*\((.*?)\n\);`).FindSubmatch(schema)
+	if definition == nil {
+		t.Fatalf("table %s is not in the schema", table)
+	}
+
+	columns := []string{}
+	for _, line := range strings.Split(string(definition[1]), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) < 2 || strings.HasPrefix(fields[0], "--") || strings.ToUpper(fields[0]) == fields[0] {
+			continue
+		}
+		columns = append(columns, strings.Trim(fields[0], `"`))
+	}
+	return columns
+}
+
+// tableDriver is a `database/sql` driver over an in memory table with the columns of the application schema. SELECT
+// statements fail on columns the table does not have, like they would in Postgres, and return the matching rows with
+// the selected columns.
+type tableDriver struct {
+	columns []string
+	rows    []map[string]driver.Value
+}
+
+var selectPattern = regexp.MustCompile(`^SELECT (.*?) FROM \S+ WHERE (.*)$`)
+
+func (d *tableDriver) Open(name string) (driver.Conn, error) { return d, nil }
+func (d *tableDriver) Prepare(query string) (driver.Stmt, error) {
+	return &tableStmt{driver: d, query: query}, nil
+}
+func (d *tableDriver) Close() error { return nil }
+func (d *tableDriver) Begin() (driver.Tx, error) {
+	return nil, fmt.Errorf("transactions are not supported")
+}
+
+type tableStmt struct {
+	driver *tableDriver
+	query  string
+}
+
+func (s *tableStmt) Close() error  { return nil }
+func (s *tableStmt) NumInput() int { return -1 }
+
+func (s *tableStmt) Exec(args []driver.Value) (driver.Result, error) {
+	return nil, fmt.Errorf("unexpected statement %s", s.query)
+}
+
+func (s *tableStmt) Query(args []driver.Value) (driver.Rows, error) {
+	statement := selectPattern.FindStringSubmatch(s.query)
+	if statement == nil {
+		return nil, fmt.Errorf("unexpected query %s", s.query)
+	}
+
+	selected := []string{}
+	for _, column := range strings.Split(statement[1], ",") {
+		column = strings.Trim(strings.TrimSpace(column), `"`)
+		known := false
+		for _, c := range s.driver.columns {
+			known = known || c == column
+		}
+		if !known {
+			return nil, fmt.Errorf("column \"%s\" does not exist", column)
+		}
+		selected = append(selected, column)
+	}
+
+	rows := &tableRows{columns: selected}
+	for _, row := range s.driver.rows {
+		match := true
+		for _, condition := range conditionPattern.FindAllStringSubmatch(statement[2], -1) {
+			i, _ := strconv.Atoi(condition[2])
+			match = match && row[condition[1]] == args[i-1]
+		}
+		if !match {
+			continue
+		}
+		values := make([]driver.Value, len(selected))
+		for i, column := range selected {
+			values[i] = row[column]
+		}
+		rows.values = append(rows.values, values)
+	}
+	return rows, nil
+}
+
+type tableRows struct {
+	columns []string
+	values  [][]driver.Value
+}
+
+func (r *tableRows) Columns() []string { return r.columns }
+func (r *tableRows) Close() error      { return nil }
+
+func (r *tableRows) Next(dest []driver.Value) error {
+	if len(r.values) == 0 {
+		return io.EOF
+	}
+	copy(dest, r.values[0])
+	r.values = r.values[1:]
+	return nil
+}
+
+func TestRootKeyColumns(t *testing.T) {
+	keys := &tableDriver{
+		columns: schemaColumns(t, "project_json_real"),
+		rows: []map[string]driver.Value{{
+			"id":         "key",
+			"project_id": "project",
+			"root_key":   "settings",
+			"create":     true,
+			"read":       true,
+			"update":     false,
+			"delete":     false,
+			"data":       []byte(`{"theme": "dark"}`),
+			"schema":     []byte(`{"type": "object"}`),
+			"rules":      []byte(`[{"path": "theme", "read": "true"}]`),
+		}},
+	}
+	sql.Register("rootkeys", keys)
+	db, err := sql.Open("rootkeys", "")
+	assert.Nil(t, err)
+	d := &Database{db: db}
+
+	key, err := d.GetRootKey("project", "settings")
+	if assert.Nil(t, err) {
+		assert.Equal(t, "settings", key.Key)
+		assert.True(t, key.Create)
+		assert.JSONEq(t, `{"type": "object"}`, string(key.Schema))
+		assert.Len(t, key.Rules, 1)
+	}
+
+	_, err = d.GetRootKey("project", "missing")
+	assert.Equal(t, sql.ErrNoRows, err)
+
+	list, err := d.ListRootKeys("project")
+	if assert.Nil(t, err) && assert.Len(t, list, 1) {
+		assert.Equal(t, "settings", list[0].Key)
+		assert.Len(t, list[0].Rules, 1)
+	}
+}
@@ -9,6 +9,7 @@ import (
 	"strings"
 	"time"
 
+	"github.com/machinable/machinable/dsi"
 	dsiErrors "github.com/machinable/machinable/dsi/errors"
 	"github.com/machinable/machinable/dsi/models"
 )
@@ -30,7 +31,7 @@ var objectFilterTranslation = map[string]string{
 func (d *Database) AddDefinition(projectID string, definition *models.ResourceDefinition) (string, *dsiErrors.DatastoreError) {
 	err := d.db.QueryRow(
 		fmt.Sprintf(
-			"INSERT INTO %s (project_id, name, path_name, parallel_read, parallel_write, \"create\", \"read\", \"update\", \"delete\", schema, created) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11) RETURNING id",
+			"INSERT INTO %s (project_id, name, path_name, parallel_read, parallel_write, \"create\", \"read\", \"update\", \"delete\", upsert, schema, created) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12) RETURNING id",
 			tableProjectResourceDefinitions,
 		),
 		projectID,
@@ -42,6 +43,7 @@ func (d *Database) AddDefinition(projectID string, definition *models.ResourceDe
 		definition.Read,
 		definition.Update,
 		definition.Delete,
+		definition.Upsert,
 		definition.Schema,
 		time.Now(),
 	).Scan(&definition.ID)
@@ -53,7 +55,7 @@ func (d *Database) AddDefinition(projectID string, definition *models.ResourceDe
 func (d *Database) UpdateDefinition(projectID, definitionID string, definition *models.ResourceDefinition) *dsiErrors.DatastoreError {
 	_, err := d.db.Exec(
 		fmt.Sprintf(
-			"UPDATE %s SET parallel_read=$1, parallel_write=$2, \"create\"=$3, \"read\"=$4, \"update\"=$5, \"delete\"=$6 WHERE id=$7",
+			"UPDATE %s SET parallel_read=$1, parallel_write=$2, \"create\"=$3, \"read\"=$4, \"update\"=$5, \"delete\"=$6, upsert=$7 WHERE id=$8",
 			tableProjectResourceDefinitions,
 		),
 		definition.ParallelRead,
@@ -62,6 +64,7 @@ func (d *Database) UpdateDefinition(projectID, definitionID string, definition *
 		definition.Read,
 		definition.Update,
 		definition.Delete,
+		definition.Upsert,
 		definitionID,
 	)
 
@@ -72,7 +75,7 @@ func (d *Database) UpdateDefinition(projectID, definitionID string, definition *
 func (d *Database) ListDefinitions(projectID string) ([]*models.ResourceDefinition, *dsiErrors.DatastoreError) {
 	rows, err := d.db.Query(
 		fmt.Sprintf(
-			"SELECT id, project_id, name, path_name, parallel_read, parallel_write, \"create\", \"read\", \"update\", \"delete\", schema, created FROM %s WHERE project_id=$1",
+			"SELECT id, project_id, name, path_name, parallel_read, parallel_write, \"create\", \"read\", \"update\", \"delete\", upsert, schema, created FROM %s WHERE project_id=$1",
 			tableProjectResourceDefinitions,
 		),
 		projectID,
@@ -96,6 +99,7 @@ func (d *Database) ListDefinitions(projectID string) ([]*models.ResourceDefiniti
 			&def.Read,
 			&def.Update,
 			&def.Delete,
+			&def.Upsert,
 			&def.Schema,
 			&def.Created,
 		)
@@ -114,7 +118,7 @@ func (d *Database) GetDefinition(projectID, definitionID string) (*models.Resour
 	def := models.ResourceDefinition{}
 	err := d.db.QueryRow(
 		fmt.Sprintf(
-			"SELECT id, project_id, name, path_name, parallel_read, parallel_write, \"create\", \"read\", \"update\", \"delete\", schema, created FROM %s WHERE id=$1",
+			"SELECT id, project_id, name, path_name, parallel_read, parallel_write, \"create\", \"read\", \"update\", \"delete\", upsert, schema, created FROM %s WHERE id=$1",
 			tableProjectResourceDefinitions,
 		),
 		definitionID,
@@ -129,6 +133,7 @@ func (d *Database) GetDefinition(projectID, definitionID string) (*models.Resour
 		&def.Read,
 		&def.Update,
 		&def.Delete,
+		&def.Upsert,
 		&def.Schema,
 		&def.Created,
 	)
@@ -166,7 +171,7 @@ func (d *Database) GetDefinitionByPathName(projectID, pathName string) (*models.
 	def := models.ResourceDefinition{}
 	err := d.db.QueryRow(
 		fmt.Sprintf(
-			"SELECT id, project_id, name, path_name, parallel_read, parallel_write, \"create\", \"read\", \"update\", \"delete\", schema, created FROM %s WHERE project_id=$1 AND path_name=$2",
+			"SELECT id, project_id, name, path_name, parallel_read, parallel_write, \"create\", \"read\", \"update\", \"delete\", upsert, schema, created FROM %s WHERE project_id=$1 AND path_name=$2",
 			tableProjectResourceDefinitions,
 		),
 		projectID,
@@ -182,6 +187,7 @@ func (d *Database) GetDefinitionByPathName(projectID, pathName string) (*models.
 		&def.Read,
 		&def.Update,
 		&def.Delete,
+		&def.Upsert,
 		&def.Schema,
 		&def.Created,
 	)
@@ -241,68 +247,144 @@ func (d *Database) DropProjectResources(projectID string) *dsiErrors.DatastoreEr
 /* PROJECT RESOURCE DOCUMENTS */
 /******************************/
 
-// AddDefDocument creates a new document for the existing resource, specified by the path.
+// AddDefDocument creates a new document for the existing resource, specified by the path. The fields are expected to
+// have been validated against the resource schema.
 func (d *Database) AddDefDocument(projectID, pathName string, fields models.ResourceObject, metadata *models.MetaData) (string, *dsiErrors.DatastoreError) {
-	var id string
-	var creatorID interface{}
-
-	if metadata.CreatorType == models.CreatorAPIKey || metadata.CreatorType == models.CreatorUser {
-		creatorID = metadata.Creator
+	data, der := json.Marshal(fields)
+	if der != nil {
+		return "", dsiErrors.New(dsiErrors.UnknownError, der)
 	}
 
-	// Get field definitions for this resource
-	// TODO: we already have the definition which is loaded earlier... do the schema validation at the HTTP layer
-	resourceDefinition, defErr := d.GetDefinitionByPathName(projectID, pathName)
-	if defErr != nil {
-		return "", dsiErrors.New(dsiErrors.NotFound, fmt.Errorf("resource does not exist"))
-	}
+	id, err := d.insertDefDocument(d.db, projectID, pathName, "", data, metadata)
 
-	// validate schema
-	schemaErr := fields.Validate(resourceDefinition)
-	if schemaErr != nil {
-		return "", dsiErrors.New(dsiErrors.BadParameter, schemaErr)
+	return id, dsiErrors.New(dsiErrors.UnknownError, err)
+}
+
+// UpdateDefDocument updates an existing document if it exists
+func (d *Database) UpdateDefDocument(projectID, pathName, documentID string, updatedFields models.ResourceObject, filter map[string]interface{}) (*models.ResourceObject, *dsiErrors.DatastoreError) {
+	data, der := json.Marshal(updatedFields)
+	if der != nil {
+		return nil, dsiErrors.New(dsiErrors.UnknownError, der)
 	}
 
+	meta, err := d.updateDefDocument(d.db, projectID, pathName, documentID, data, filter)
+
+	updatedFields["id"] = documentID
+	updatedFields["_meta"] = meta
+
+	return &updatedFields, dsiErrors.New(dsiErrors.UnknownError, err)
+}
+
+// UpsertDefDocument updates an existing document, or creates the document with the provided ID if it does not exist.
+// The returned bool is true if the document was created. Documents are not created without `metadata`, for requesters
+// who can only update documents, and NotFound is returned instead.
+func (d *Database) UpsertDefDocument(projectID, pathName, documentID string, fields models.ResourceObject, metadata *models.MetaData, filter map[string]interface{}) (*models.ResourceObject, bool, *dsiErrors.DatastoreError) {
 	data, der := json.Marshal(fields)
 	if der != nil {
-		return "", dsiErrors.New(dsiErrors.UnknownError, der)
+		return nil, false, dsiErrors.New(dsiErrors.UnknownError, der)
 	}
 
-	err := d.db.QueryRow(
+	tx, err := d.db.Begin()
+	if err != nil {
+		return nil, false, dsiErrors.New(dsiErrors.UnknownError, err)
+	}
+	defer tx.Rollback()
+
+	// the partitioned tables do not enforce unique ids, so serialize writers of the same document id
+	if _, err := tx.Exec("SELECT pg_advisory_xact_lock(hashtext($1))", documentID); err != nil {
+		return nil, false, dsiErrors.New(dsiErrors.UnknownError, err)
+	}
+
+	// ids are unique within the project, not only within the resource
+	var existingPath string
+	err = tx.QueryRow(
 		fmt.Sprintf(
-			"INSERT INTO %s (project_id, resource_path, creator_type, creator, created, data) VALUES ($1, $2, $3, $4, $5, $6) RETURNING id",
+			"SELECT resource_path FROM %s WHERE project_id=$1 AND id=$2 LIMIT 1",
 			tableProjectResourceObjects,
 		),
+		projectID,
+		documentID,
+	).Scan(&existingPath)
+	if err != nil && err != sql.ErrNoRows {
+		return nil, false, dsiErrors.New(dsiErrors.UnknownError, err)
+	}
+
+	exists := err == nil
+	if exists && existingPath != pathName {
+		// the id belongs to a document of another resource
+		return nil, false, dsiErrors.New(dsiErrors.BadParameter, errors.New("id already exists"))
+	}
+
+	if exists {
+		meta, err := d.updateDefDocument(tx, projectID, pathName, documentID, data, filter)
+		if err == sql.ErrNoRows {
+			// the document exists, but the requester does not have access to it
+			return nil, false, dsiErrors.New(dsiErrors.NotFound, errors.New("not found"))
+		} else if err != nil {
+			return nil, false, dsiErrors.New(dsiErrors.UnknownError, err)
+		}
+
+		fields["id"] = documentID
+		fields["_meta"] = meta
+	} else if metadata == nil {
+		return nil, false, dsiErrors.New(dsiErrors.NotFound, errors.New("not found"))
+	} else {
+		_, err := d.insertDefDocument(tx, projectID, pathName, documentID, data, metadata)
+		if err != nil {
+			return nil, false, dsiErrors.New(dsiErrors.UnknownError, err)
+		}
+
+		fields["id"] = documentID
+		fields["_metadata"] = metadata
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, false, dsiErrors.New(dsiErrors.UnknownError, err)
+	}
+
+	return &fields, !exists, nil
+}
+
+// insertDefDocument inserts the document data, generating a new ID if `documentID` is empty
+func (d *Database) insertDefDocument(q queryer, projectID, pathName, documentID string, data []byte, metadata *models.MetaData) (string, error) {
+	var creatorID interface{}
+	if metadata.CreatorType == models.CreatorAPIKey || metadata.CreatorType == models.CreatorUser {
+		creatorID = metadata.Creator
+	}
+
+	columns := "project_id, resource_path, creator_type, creator, created, data"
+	values := "$1, $2, $3, $4, $5, $6"
+	args := []interface{}{
 		projectID,
 		pathName,
 		metadata.CreatorType,
 		creatorID,
 		time.Now(),
 		data,
-	).Scan(&id)
-
-	return id, dsiErrors.New(dsiErrors.UnknownError, err)
-}
-
-// UpdateDefDocument updates an existing document if it exists
-func (d *Database) UpdateDefDocument(projectID, pathName, documentID string, updatedFields models.ResourceObject, filter map[string]interface{}) (*models.ResourceObject, *dsiErrors.DatastoreError) {
-	// Get field definitions for this resource
-	resourceDefinition, defErr := d.GetDefinitionByPathName(projectID, pathName)
-	if defErr != nil {
-		return nil, dsiErrors.New(dsiErrors.NotFound, fmt.Errorf("resource does not exist"))
 	}
 
-	// validate schema
-	schemaErr := updatedFields.Validate(resourceDefinition)
-	if schemaErr != nil {
-		return nil, dsiErrors.New(dsiErrors.BadParameter, schemaErr)
+	if documentID != "" {
+		columns += ", id"
+		values += ", $7"
+		args = append(args, documentID)
 	}
 
-	data, der := json.Marshal(updatedFields)
-	if der != nil {
-		return nil, dsiErrors.New(dsiErrors.UnknownError, der)
-	}
+	var id string
+	err := q.QueryRow(
+		fmt.Sprintf(
+			"INSERT INTO %s (%s) VALUES (%s) RETURNING id",
+			tableProjectResourceObjects,
+			columns,
+			values,
+		),
+		args...,
+	).Scan(&id)
+
+	return id, err
+}
 
+// updateDefDocument replaces the data of the document of the resource matching the auth filters
+func (d *Database) updateDefDocument(q queryer, projectID, pathName, documentID string, data []byte, filter map[string]interface{}) (*models.MetaData, error) {
 	// translate filters
 	translatedFilters := make(map[string]interface{})
 	for key, value := range filter {
@@ -328,6 +410,11 @@ func (d *Database) UpdateDefDocument(projectID, pathName, documentID string, upd
 	filterString = append(filterString, fmt.Sprintf("project_id=$%d", index))
 	index++
 
+	// resource path
+	args = append(args, pathName)
+	filterString = append(filterString, fmt.Sprintf("resource_path=$%d", index))
+	index++
+
 	// object id
 	args = append(args, documentID)
 	filterString = append(filterString, fmt.Sprintf("id=$%d", index))
@@ -339,7 +426,7 @@ func (d *Database) UpdateDefDocument(projectID, pathName, documentID string, upd
 	// filters
 	filterErr := d.mapToQuery(translatedFilters, validFields, &filterString, &args, &index)
 	if filterErr != nil {
-		return nil, dsiErrors.New(dsiErrors.UnknownError, filterErr)
+		return nil, filterErr
 	}
 
 	query := fmt.Sprintf(
@@ -352,7 +439,7 @@ func (d *Database) UpdateDefDocument(projectID, pathName, documentID string, upd
 	var created time.Time
 
 	meta := &models.MetaData{}
-	err := d.db.QueryRow(
+	err := q.QueryRow(
 		query,
 		args...,
 	).Scan(
@@ -363,17 +450,35 @@ func (d *Database) UpdateDefDocument(projectID, pathName, documentID string, upd
 	meta.Creator = creatorID.String
 	meta.Created = created.Unix()
 
-	updatedFields["id"] = documentID
-	updatedFields["_meta"] = meta
-
-	return &updatedFields, dsiErrors.New(dsiErrors.UnknownError, err)
+	return meta, err
 }
 
 // ListDefDocuments retrieves all definition documents for the give project and path
 func (d *Database) ListDefDocuments(projectID, pathName string, limit, offset int64, filter map[string]interface{}, sort map[string]int) ([]map[string]interface{}, *dsiErrors.DatastoreError) {
+	objects := make([]map[string]interface{}, 0)
+	err := d.EachDefDocument(projectID, pathName, limit, offset, filter, sort, func(obj map[string]interface{}) error {
+		objects = append(objects, obj)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return objects, nil
+}
+
+// EachDefDocument retrieves definition documents for the given project and path, calling `fn` for each document as
+// it is read from the database. Iteration stops at the first error returned by `fn`.
+func (d *Database) EachDefDocument(projectID, pathName string, limit, offset int64, filter map[string]interface{}, sort map[string]int, fn func(map[string]interface{}) error) *dsiErrors.DatastoreError {
 	// translate filters
 	translatedFilters := make(map[string]interface{})
+	var geoField string
+	var geo *models.GeoFilter
 	for key, value := range filter {
+		if g, ok := value.(*models.GeoFilter); ok {
+			geoField, geo = key, g
+			continue
+		}
 		if translated, ok := objectFilterTranslation[key]; ok {
 			if _, ok := filter[translated]; !ok {
 				translatedFilters[translated] = value
@@ -410,7 +515,13 @@ func (d *Database) ListDefDocuments(projectID, pathName string, limit, offset in
 	// filters
 	filterErr := d.mapToQuery(translatedFilters, validFields, &filterString, &args, &index)
 	if filterErr != nil {
-		return nil, dsiErrors.New(dsiErrors.UnknownError, filterErr)
+		return dsiErrors.New(dsiErrors.UnknownError, filterErr)
+	}
+
+	// geo filters, the distance can be selected and sorted on if a `near` point is set
+	distance := ""
+	if geo != nil {
+		distance = geoFilterToQuery(geoField, geo, &filterString, &args, &index)
 	}
 
 	// sort
@@ -432,7 +543,12 @@ func (d *Database) ListDefDocuments(projectID, pathName string, limit, offset in
 		// translate key from metadata or to JSONB
 		realKey := key
 
-		if translated, ok := objectFilterTranslation[key]; ok {
+		if key == dsi.DistanceKey {
+			if distance == "" {
+				return dsiErrors.New(dsiErrors.BadParameter, errors.New("sorting by distance requires a near point"))
+			}
+			realKey = "distance"
+		} else if translated, ok := objectFilterTranslation[key]; ok {
 			realKey = translated
 		} else {
 			// this is a data key, translate key to JSONB filter
@@ -457,6 +573,9 @@ func (d *Database) ListDefDocuments(projectID, pathName string, limit, offset in
 	}
 
 	queryFields := "id, creator, creator_type, created, data"
+	if distance != "" {
+		queryFields += fmt.Sprintf(", %s AS distance", distance)
+	}
 	orderBy := ""
 	if len(sortString) > 0 {
 		orderBy = fmt.Sprintf(" ORDER BY %s", strings.Join(sortString, ", "))
@@ -477,46 +596,57 @@ func (d *Database) ListDefDocuments(projectID, pathName string, limit, offset in
 	)
 
 	if err != nil {
-		return nil, dsiErrors.New(dsiErrors.UnknownError, err)
+		return dsiErrors.New(dsiErrors.UnknownError, err)
 	}
 	defer rows.Close()
 
-	objects := make([]map[string]interface{}, 0)
 	for rows.Next() {
 		var id, creatorType string
 		var creatorID sql.NullString
 		var created time.Time
+		var dist sql.NullFloat64
 		obj := make(map[string]interface{})
 		byt := make([]byte, 0)
 
-		err = rows.Scan(
+		dest := []interface{}{
 			&id,
 			&creatorID,
 			&creatorType,
 			&created,
 			&byt,
-		)
+		}
+		if distance != "" {
+			dest = append(dest, &dist)
+		}
+
+		err = rows.Scan(dest...)
 
 		if err != nil {
-			return nil, dsiErrors.New(dsiErrors.UnknownError, err)
+			return dsiErrors.New(dsiErrors.UnknownError, err)
 		}
 
 		err = json.Unmarshal(byt, &obj)
 		if err != nil {
-			return nil, dsiErrors.New(dsiErrors.UnknownError, err)
+			return dsiErrors.New(dsiErrors.UnknownError, err)
 		}
 
-		obj["_metadata"] = models.MetaData{
+		meta := models.MetaData{
 			Created:     created.Unix(),
 			Creator:     creatorID.String,
 			CreatorType: creatorType,
 		}
+		if dist.Valid {
+			meta.Distance = &dist.Float64
+		}
+		obj["_metadata"] = meta
 		obj["id"] = id
 
-		objects = append(objects, obj)
+		if err = fn(obj); err != nil {
+			return dsiErrors.New(dsiErrors.UnknownError, err)
+		}
 	}
 
-	return objects, dsiErrors.New(dsiErrors.UnknownError, rows.Err())
+	return dsiErrors.New(dsiErrors.UnknownError, rows.Err())
 }
 
 // GetDefDocument retrieves a single document
@@ -606,7 +736,13 @@ func (d *Database) GetDefDocument(projectID, path, documentID string, filter map
 func (d *Database) CountDefDocuments(projectID, pathName string, filter map[string]interface{}) (int64, *dsiErrors.DatastoreError) {
 	// translate filters
 	translatedFilters := make(map[string]interface{})
+	var geoField string
+	var geo *models.GeoFilter
 	for key, value := range filter {
+		if g, ok := value.(*models.GeoFilter); ok {
+			geoField, geo = key, g
+			continue
+		}
 		if translated, ok := objectFilterTranslation[key]; ok {
 			if _, ok := filter[translated]; !ok {
 				translatedFilters[translated] = value
@@ -644,6 +780,10 @@ func (d *Database) CountDefDocuments(projectID, pathName string, filter map[stri
 		return 0, dsiErrors.New(dsiErrors.UnknownError, filterErr)
 	}
 
+	if geo != nil {
+		geoFilterToQuery(geoField, geo, &filterString, &args, &index)
+	}
+
 	queryFields := "count(id)"
 
 	query := fmt.Sprintf(
@@ -722,27 +862,37 @@ func (d *Database) DeleteDefDocument(projectID, path, documentID string, filter
 
 // DropDefDocuments drops documents for a resource
 func (d *Database) DropDefDocuments(projectID, path string) *dsiErrors.DatastoreError {
-	_, err := d.db.Exec(
-		fmt.Sprintf(
-			"DELETE FROM %s WHERE resource_path=$1 AND project_id=$2",
-			tableProjectResourceObjects,
-		),
-		path,
-		projectID,
-	)
+	for _, table := range []string{tableProjectResourceObjects, tableProjectFiles} {
+		_, err := d.db.Exec(
+			fmt.Sprintf(
+				"DELETE FROM %s WHERE resource_path=$1 AND project_id=$2",
+				table,
+			),
+			path,
+			projectID,
+		)
+		if err != nil {
+			return dsiErrors.New(dsiErrors.UnknownError, err)
+		}
+	}
 
-	return dsiErrors.New(dsiErrors.UnknownError, err)
+	return nil
 }
 
 // DropProjectDefDocuments drops the entire collection of documents for a project
 func (d *Database) DropProjectDefDocuments(projectID string) *dsiErrors.DatastoreError {
-	_, err := d.db.Exec(
-		fmt.Sprintf(
-			"DELETE FROM %s WHERE project_id=$1",
-			tableProjectResourceObjects,
-		),
-		projectID,
-	)
+	for _, table := range []string{tableProjectResourceObjects, tableProjectFiles} {
+		_, err := d.db.Exec(
+			fmt.Sprintf(
+				"DELETE FROM %s WHERE project_id=$1",
+				table,
+			),
+			projectID,
+		)
+		if err != nil {
+			return dsiErrors.New(dsiErrors.UnknownError, err)
+		}
+	}
 
-	return dsiErrors.New(dsiErrors.UnknownError, err)
+	return nil
 }
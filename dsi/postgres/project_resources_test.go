@@ -0,0 +1,163 @@
+package postgres
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/machinable/machinable/dsi/models"
+	"github.com/stretchr/testify/assert"
+)
+
+// documentsDriver is a `database/sql` driver over an in memory table of resource documents. It understands the
+// statements of `UpsertDefDocument`, matching rows on the `column=$n` conditions of their WHERE clause. Like the
+// partitions of the table, it does not enforce unique ids.
+type documentsDriver struct {
+	rows []map[string]driver.Value
+}
+
+var conditionPattern = regexp.MustCompile(`(\w+)=\$(\d+)`)
+
+func (d *documentsDriver) Open(name string) (driver.Conn, error) { return d, nil }
+func (d *documentsDriver) Prepare(query string) (driver.Stmt, error) {
+	return &documentsStmt{driver: d, query: query}, nil
+}
+func (d *documentsDriver) Close() error              { return nil }
+func (d *documentsDriver) Begin() (driver.Tx, error) { return d, nil }
+func (d *documentsDriver) Commit() error             { return nil }
+func (d *documentsDriver) Rollback() error           { return nil }
+
+// matches returns the rows which match every condition of the WHERE clause of the query
+func (d *documentsDriver) matches(query string, args []driver.Value) []map[string]driver.Value {
+	where := query[strings.Index(query, " WHERE ")+len(" WHERE "):]
+	matched := []map[string]driver.Value{}
+	for _, row := range d.rows {
+		match := true
+		for _, condition := range conditionPattern.FindAllStringSubmatch(where, -1) {
+			i, _ := strconv.Atoi(condition[2])
+			if row[condition[1]] != args[i-1] {
+				match = false
+			}
+		}
+		if match {
+			matched = append(matched, row)
+		}
+	}
+	return matched
+}
+
+type documentsStmt struct {
+	driver *documentsDriver
+	query  string
+}
+
+func (s *documentsStmt) Close() error  { return nil }
+func (s *documentsStmt) NumInput() int { return -1 }
+
+func (s *documentsStmt) Exec(args []driver.Value) (driver.Result, error) {
+	return driver.RowsAffected(0), nil
+}
+
+func (s *documentsStmt) Query(args []driver.Value) (driver.Rows, error) {
+	switch {
+	case strings.HasPrefix(s.query, "SELECT resource_path"):
+		rows := &documentsRows{columns: []string{"resource_path"}}
+		for _, row := range s.driver.matches(s.query, args) {
+			rows.values = append(rows.values, []driver.Value{row["resource_path"]})
+		}
+		return rows, nil
+	case strings.HasPrefix(s.query, "INSERT"):
+		columns := strings.Split(s.query[strings.Index(s.query, "(")+1:strings.Index(s.query, ")")], ", ")
+		row := map[string]driver.Value{}
+		for i, column := range columns {
+			row[column] = args[i]
+		}
+		s.driver.rows = append(s.driver.rows, row)
+		return &documentsRows{columns: []string{"id"}, values: [][]driver.Value{{row["id"]}}}, nil
+	case strings.HasPrefix(s.query, "UPDATE"):
+		rows := &documentsRows{columns: []string{"creator_type", "creator", "created"}}
+		for _, row := range s.driver.matches(s.query, args) {
+			row["data"] = args[0]
+			rows.values = append(rows.values, []driver.Value{row["creator_type"], row["creator"], row["created"]})
+		}
+		return rows, nil
+	}
+	return nil, errors.New("unexpected query " + s.query)
+}
+
+type documentsRows struct {
+	columns []string
+	values  [][]driver.Value
+}
+
+func (r *documentsRows) Columns() []string { return r.columns }
+func (r *documentsRows) Close() error      { return nil }
+
+func (r *documentsRows) Next(dest []driver.Value) error {
+	if len(r.values) == 0 {
+		return io.EOF
+	}
+	copy(dest, r.values[0])
+	r.values = r.values[1:]
+	return nil
+}
+
+func TestUpsertDefDocumentOtherResource(t *testing.T) {
+	docs := &documentsDriver{rows: []map[string]driver.Value{{
+		"id":            "rex",
+		"project_id":    "project",
+		"resource_path": "dogs",
+		"creator_type":  "user",
+		"creator":       nil,
+		"created":       time.Now(),
+		"data":          []byte(`{"name": "rex"}`),
+	}}}
+	sql.Register("documents", docs)
+	db, err := sql.Open("documents", "")
+	assert.Nil(t, err)
+	d := &Database{db: db}
+	meta := models.NewMetaData("", "anonymous")
+
+	// the id of a document of another resource can not be upserted
+	_, created, dsiErr := d.UpsertDefDocument("project", "cats", "rex", models.ResourceObject{"name": "tom"}, meta, map[string]interface{}{})
+	if assert.NotNil(t, dsiErr) {
+		assert.Equal(t, 400, dsiErr.Code())
+	}
+	assert.False(t, created)
+	assert.Equal(t, []byte(`{"name": "rex"}`), docs.rows[0]["data"])
+	assert.Len(t, docs.rows, 1)
+
+	// and can not be updated
+	_, dsiErr = d.UpdateDefDocument("project", "cats", "rex", models.ResourceObject{"name": "tom"}, map[string]interface{}{})
+	assert.NotNil(t, dsiErr)
+	assert.Equal(t, []byte(`{"name": "rex"}`), docs.rows[0]["data"])
+
+	// documents of the resource are upserted
+	_, created, dsiErr = d.UpsertDefDocument("project", "dogs", "rex", models.ResourceObject{"name": "max"}, meta, map[string]interface{}{})
+	assert.Nil(t, dsiErr)
+	assert.False(t, created)
+	assert.JSONEq(t, `{"name": "max"}`, string(docs.rows[0]["data"].([]byte)))
+
+	// requesters who can not create documents only update them
+	_, created, dsiErr = d.UpsertDefDocument("project", "cats", "tom", models.ResourceObject{"name": "tom"}, nil, map[string]interface{}{})
+	if assert.NotNil(t, dsiErr) {
+		assert.Equal(t, 404, dsiErr.Code())
+	}
+	assert.False(t, created)
+	assert.Len(t, docs.rows, 1)
+
+	_, created, dsiErr = d.UpsertDefDocument("project", "cats", "tom", models.ResourceObject{"name": "tom"}, meta, map[string]interface{}{})
+	assert.Nil(t, dsiErr)
+	assert.True(t, created)
+	assert.Len(t, docs.rows, 2)
+
+	_, created, dsiErr = d.UpsertDefDocument("project", "cats", "tom", models.ResourceObject{"name": "kit"}, nil, map[string]interface{}{})
+	assert.Nil(t, dsiErr)
+	assert.False(t, created)
+}
@@ -0,0 +1,141 @@
+package postgres
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/machinable/machinable/dsi/errors"
+	"github.com/machinable/machinable/dsi/models"
+)
+
+const tableProjectWebhookFailures = "project_webhook_failures"
+
+// AddFailure saves a web hook delivery which failed every attempt
+func (d *Database) AddFailure(failure *models.HookFailure) *errors.DatastoreError {
+	attempts, err := json.Marshal(failure.Attempts)
+	if err != nil {
+		return errors.New(errors.UnknownError, err)
+	}
+
+	payload := []byte(failure.Payload)
+	if len(payload) == 0 {
+		payload = []byte("null")
+	}
+
+	_, err = d.db.Exec(
+		fmt.Sprintf(
+			"INSERT INTO %s (project_id, webhook_id, delivery_id, event, entity_key, payload, attempts, created) VALUES ($1, $2, $3, NULLIF($4, '')::hook_type, $5, $6, $7, $8)",
+			tableProjectWebhookFailures,
+		),
+		failure.ProjectID,
+		failure.WebHookID,
+		failure.DeliveryID,
+		failure.Event,
+		failure.EntityKey,
+		payload,
+		attempts,
+		time.Now(),
+	)
+
+	return errors.New(errors.UnknownError, err)
+}
+
+// ListFailures lists the failed deliveries of a web hook, oldest first
+func (d *Database) ListFailures(projectID, hookID string) ([]*models.HookFailure, *errors.DatastoreError) {
+	rows, err := d.db.Query(
+		fmt.Sprintf(
+			"SELECT id, project_id, webhook_id, delivery_id, COALESCE(event::text, ''), entity_key, payload, attempts, created FROM %s WHERE project_id=$1 AND webhook_id=$2 ORDER BY created ASC",
+			tableProjectWebhookFailures,
+		),
+		projectID,
+		hookID,
+	)
+	if err != nil {
+		return nil, errors.New(errors.UnknownError, err)
+	}
+	defer rows.Close()
+
+	failures := make([]*models.HookFailure, 0)
+	for rows.Next() {
+		failure, err := scanFailure(rows)
+		if err != nil {
+			return nil, errors.New(errors.UnknownError, err)
+		}
+
+		failures = append(failures, failure)
+	}
+
+	return failures, nil
+}
+
+// GetFailure retrieves a single failed delivery of a web hook
+func (d *Database) GetFailure(projectID, hookID, failureID string) (*models.HookFailure, *errors.DatastoreError) {
+	row := d.db.QueryRow(
+		fmt.Sprintf(
+			"SELECT id, project_id, webhook_id, delivery_id, COALESCE(event::text, ''), entity_key, payload, attempts, created FROM %s WHERE project_id=$1 AND webhook_id=$2 AND id=$3",
+			tableProjectWebhookFailures,
+		),
+		projectID,
+		hookID,
+		failureID,
+	)
+
+	failure, err := scanFailure(row)
+	if err == sql.ErrNoRows {
+		return nil, errors.New(errors.NotFound, fmt.Errorf("failed delivery not found"))
+	}
+
+	return failure, errors.New(errors.UnknownError, err)
+}
+
+// DeleteFailure permanently removes a failed delivery of a web hook
+func (d *Database) DeleteFailure(projectID, hookID, failureID string) *errors.DatastoreError {
+	res, err := d.db.Exec(
+		fmt.Sprintf(
+			"DELETE FROM %s WHERE id=$1 AND webhook_id=$2 AND project_id=$3",
+			tableProjectWebhookFailures,
+		),
+		failureID,
+		hookID,
+		projectID,
+	)
+	if err != nil {
+		return errors.New(errors.UnknownError, err)
+	}
+	if count, _ := res.RowsAffected(); count == 0 {
+		return errors.New(errors.NotFound, fmt.Errorf("failed delivery not found"))
+	}
+
+	return nil
+}
+
+// scanFailure scans a failed delivery from a row of `ListFailures` or `GetFailure`
+func scanFailure(row scanner) (*models.HookFailure, error) {
+	failure := &models.HookFailure{}
+	var entityKey sql.NullString
+	var payload, attempts []byte
+	err := row.Scan(
+		&failure.ID,
+		&failure.ProjectID,
+		&failure.WebHookID,
+		&failure.DeliveryID,
+		&failure.Event,
+		&entityKey,
+		&payload,
+		&attempts,
+		&failure.Created,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	failure.EntityKey = entityKey.String
+	failure.Payload = payload
+	if err := json.Unmarshal(attempts, &failure.Attempts); err != nil {
+		return nil, err
+	}
+
+	return failure, nil
+}
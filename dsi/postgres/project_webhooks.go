@@ -1,9 +1,13 @@
 package postgres
 
 import (
+	"database/sql"
+	"database/sql/driver"
+	"encoding/json"
 	"fmt"
 	"time"
 
+	"github.com/lib/pq"
 	"github.com/machinable/machinable/dsi/errors"
 	"github.com/machinable/machinable/dsi/models"
 )
@@ -13,9 +17,18 @@ const tableProjectWebHooks = "project_webhooks"
 
 // AddResult creates a new webhook result
 func (d *Database) AddResult(result *models.HookResult) *errors.DatastoreError {
-	_, err := d.db.Exec(
+	requestHeaders, err := json.Marshal(result.RequestHeaders)
+	if err != nil {
+		return errors.New(errors.UnknownError, err)
+	}
+	responseHeaders, err := json.Marshal(result.ResponseHeaders)
+	if err != nil {
+		return errors.New(errors.UnknownError, err)
+	}
+
+	_, err = d.db.Exec(
 		fmt.Sprintf(
-			"INSERT INTO %s (project_id, webhook_id, status_code, response_time, error_message, created) VALUES ($1, $2, $3, $4, $5, $6)",
+			"INSERT INTO %s (project_id, webhook_id, status_code, response_time, error_message, request_headers, request_body, response_headers, response_body, created) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)",
 			tableProjectWebhookResults,
 		),
 		result.ProjectID,
@@ -23,6 +36,10 @@ func (d *Database) AddResult(result *models.HookResult) *errors.DatastoreError {
 		result.StatusCode,
 		result.ResponseTime,
 		result.ErrorMessage,
+		requestHeaders,
+		result.RequestBody,
+		responseHeaders,
+		result.ResponseBody,
 		time.Now(),
 	)
 
@@ -33,7 +50,7 @@ func (d *Database) AddResult(result *models.HookResult) *errors.DatastoreError {
 func (d *Database) ListResults(projectID, hookID string) ([]*models.HookResult, *errors.DatastoreError) {
 	rows, err := d.db.Query(
 		fmt.Sprintf(
-			"SELECT project_id, webhook_id, status_code, response_time, error_message, created FROM %s WHERE project_id=$1 AND webhook_id=$2 AND created >= now()-'1 hour'::interval ORDER BY created DESC",
+			"SELECT project_id, webhook_id, status_code, response_time, error_message, request_headers, request_body, response_headers, response_body, created FROM %s WHERE project_id=$1 AND webhook_id=$2 AND created >= now()-'1 hour'::interval ORDER BY created DESC",
 			tableProjectWebhookResults,
 		),
 		projectID,
@@ -47,18 +64,30 @@ func (d *Database) ListResults(projectID, hookID string) ([]*models.HookResult,
 	results := make([]*models.HookResult, 0)
 	for rows.Next() {
 		result := models.HookResult{}
+		var requestHeaders, responseHeaders []byte
+		var requestBody, responseBody sql.NullString
 		err = rows.Scan(
 			&result.ProjectID,
 			&result.WebHookID,
 			&result.StatusCode,
 			&result.ResponseTime,
 			&result.ErrorMessage,
+			&requestHeaders,
+			&requestBody,
+			&responseHeaders,
+			&responseBody,
 			&result.Created,
 		)
 		if err != nil {
 			return nil, errors.New(errors.UnknownError, err)
 		}
 
+		// results recorded before requests and responses were kept have neither
+		json.Unmarshal(requestHeaders, &result.RequestHeaders)
+		json.Unmarshal(responseHeaders, &result.ResponseHeaders)
+		result.RequestBody = requestBody.String
+		result.ResponseBody = responseBody.String
+
 		results = append(results, &result)
 	}
 
@@ -69,7 +98,7 @@ func (d *Database) ListResults(projectID, hookID string) ([]*models.HookResult,
 func (d *Database) AddHook(projectID string, hook *models.WebHook) *errors.DatastoreError {
 	_, err := d.db.Exec(
 		fmt.Sprintf(
-			"INSERT INTO %s (project_id, label, isenabled, entity, entity_id, hook_event, headers, hook_url) VALUES ($1, $2, $3, $4, $5, $6, $7, $8)",
+			"INSERT INTO %s (project_id, label, isenabled, entity, entity_id, path, hook_events, filter, headers, hook_url, secret) VALUES ($1, $2, $3, $4, NULLIF($5, '')::uuid, $6, $7, $8, $9, $10, $11)",
 			tableProjectWebHooks,
 		),
 		projectID,
@@ -77,9 +106,12 @@ func (d *Database) AddHook(projectID string, hook *models.WebHook) *errors.Datas
 		hook.IsEnabled,
 		hook.Entity,
 		hook.EntityID,
-		hook.HookEvent,
+		hook.Path,
+		pq.Array(hook.HookEvents),
+		hookFilter{&hook.Filter},
 		hook.Headers,
 		hook.HookURL,
+		hook.Secret,
 	)
 
 	return errors.New(errors.UnknownError, err)
@@ -89,7 +121,7 @@ func (d *Database) AddHook(projectID string, hook *models.WebHook) *errors.Datas
 func (d *Database) ListHooks(projectID string) ([]*models.WebHook, *errors.DatastoreError) {
 	rows, err := d.db.Query(
 		fmt.Sprintf(
-			"SELECT id, project_id, label, isenabled, entity, entity_id, hook_event, headers, hook_url FROM %s WHERE project_id=$1",
+			"SELECT id, project_id, label, isenabled, entity, COALESCE(entity_id::text, ''), path, hook_events, filter, headers, hook_url FROM %s WHERE project_id=$1",
 			tableProjectWebHooks,
 		),
 		projectID,
@@ -109,7 +141,10 @@ func (d *Database) ListHooks(projectID string) ([]*models.WebHook, *errors.Datas
 			&hook.IsEnabled,
 			&hook.Entity,
 			&hook.EntityID,
-			&hook.HookEvent,
+			&hook.Path,
+			pq.Array(&hook.HookEvents),
+			hookFilter{&hook.Filter},
+			hookFilter{&hook.Filter},
 			&hook.Headers,
 			&hook.HookURL,
 		)
@@ -128,7 +163,7 @@ func (d *Database) GetHook(projectID, hookID string) (*models.WebHook, *errors.D
 	hook := models.WebHook{}
 	err := d.db.QueryRow(
 		fmt.Sprintf(
-			"SELECT id, project_id, label, isenabled, entity, entity_id, hook_event, headers, hook_url FROM %s WHERE project_id=$1 AND id=$2",
+			"SELECT id, project_id, label, isenabled, entity, COALESCE(entity_id::text, ''), path, hook_events, filter, headers, hook_url FROM %s WHERE project_id=$1 AND id=$2",
 			tableProjectWebHooks,
 		),
 		projectID,
@@ -140,7 +175,9 @@ func (d *Database) GetHook(projectID, hookID string) (*models.WebHook, *errors.D
 		&hook.IsEnabled,
 		&hook.Entity,
 		&hook.EntityID,
-		&hook.HookEvent,
+		&hook.Path,
+		pq.Array(&hook.HookEvents),
+		hookFilter{&hook.Filter},
 		&hook.Headers,
 		&hook.HookURL,
 	)
@@ -152,14 +189,16 @@ func (d *Database) GetHook(projectID, hookID string) (*models.WebHook, *errors.D
 func (d *Database) UpdateHook(projectID, hookID string, hook *models.WebHook) *errors.DatastoreError {
 	_, err := d.db.Exec(
 		fmt.Sprintf(
-			"UPDATE %s SET label=$1, isenabled=$2, entity=$3, entity_id=$4, hook_event=$5, headers=$6, hook_url=$7 WHERE id=$8 and project_id=$9",
+			"UPDATE %s SET label=$1, isenabled=$2, entity=$3, entity_id=NULLIF($4, '')::uuid, path=$5, hook_events=$6, filter=$7, headers=$8, hook_url=$9 WHERE id=$10 and project_id=$11",
 			tableProjectWebHooks,
 		),
 		hook.Label,
 		hook.IsEnabled,
 		hook.Entity,
 		hook.EntityID,
-		hook.HookEvent,
+		hook.Path,
+		pq.Array(hook.HookEvents),
+		hookFilter{&hook.Filter},
 		hook.Headers,
 		hook.HookURL,
 		hook.ID,
@@ -181,3 +220,65 @@ func (d *Database) DeleteHook(projectID, hookID string) *errors.DatastoreError {
 	)
 	return errors.New(errors.UnknownError, err)
 }
+
+// GetHookSecret retrieves the signing secret of a WebHook by project and hook ID
+func (d *Database) GetHookSecret(projectID, hookID string) (string, *errors.DatastoreError) {
+	secret := ""
+	err := d.db.QueryRow(
+		fmt.Sprintf(
+			"SELECT secret FROM %s WHERE project_id=$1 AND id=$2",
+			tableProjectWebHooks,
+		),
+		projectID,
+		hookID,
+	).Scan(&secret)
+	if err == sql.ErrNoRows {
+		return "", errors.New(errors.NotFound, fmt.Errorf("hook not found"))
+	}
+
+	return secret, errors.New(errors.UnknownError, err)
+}
+
+// UpdateHookSecret replaces the signing secret of a WebHook by project and hook ID
+func (d *Database) UpdateHookSecret(projectID, hookID, secret string) *errors.DatastoreError {
+	res, err := d.db.Exec(
+		fmt.Sprintf(
+			"UPDATE %s SET secret=$1 WHERE id=$2 and project_id=$3",
+			tableProjectWebHooks,
+		),
+		secret,
+		hookID,
+		projectID,
+	)
+	if err != nil {
+		return errors.New(errors.UnknownError, err)
+	}
+	if count, _ := res.RowsAffected(); count == 0 {
+		return errors.New(errors.NotFound, fmt.Errorf("hook not found"))
+	}
+
+	return nil
+}
+
+// hookFilter reads and writes the filter of a hook as JSONB, NULL if the hook has no filter
+type hookFilter struct {
+	filter *models.Filters
+}
+
+// Value implements `driver.Valuer`
+func (f hookFilter) Value() (driver.Value, error) {
+	if len(*f.filter) == 0 {
+		return nil, nil
+	}
+	return json.Marshal(*f.filter)
+}
+
+// Scan implements `sql.Scanner`
+func (f hookFilter) Scan(src interface{}) error {
+	*f.filter = nil
+	b, ok := src.([]byte)
+	if !ok || len(b) == 0 {
+		return nil
+	}
+	return json.Unmarshal(b, f.filter)
+}
@@ -138,7 +138,7 @@ func (d *Database) GetProjectDetailBySlug(slug string) (*models.ProjectDetail, e
 
 	err := d.db.QueryRow(
 		fmt.Sprintf(
-			"SELECT id, user_id, slug, name, description, icon, user_registration, created, requests FROM %s WHERE slug=$1",
+			"SELECT id, user_id, slug, name, description, icon, user_registration, created, requests, storage FROM %s WHERE slug=$1",
 			tableAppProjectLimits,
 		),
 		slug,
@@ -152,6 +152,7 @@ func (d *Database) GetProjectDetailBySlug(slug string) (*models.ProjectDetail, e
 		&project.UserRegistration,
 		&project.Created,
 		&project.Requests,
+		&project.Storage,
 	)
 	if err != nil {
 		return nil, err
@@ -41,3 +41,21 @@ func (d *Database) ListTiers() ([]*models.Tier, error) {
 
 	return tiers, rows.Err()
 }
+
+// UpdateTier updates the name, cost and limits of the tier
+func (d *Database) UpdateTier(tier *models.Tier) error {
+	_, err := d.db.Exec(
+		fmt.Sprintf(
+			"UPDATE %s SET name=$1, cost=$2, requests=$3, projects=$4, storage=$5 WHERE id=$6",
+			tableAppTiers,
+		),
+		tier.Name,
+		tier.Cost,
+		tier.Requests,
+		tier.Projects,
+		tier.Storage,
+		tier.ID,
+	)
+
+	return err
+}
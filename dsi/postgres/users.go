@@ -96,3 +96,17 @@ func (d *Database) ActivateUser(userID string, active bool) error {
 
 	return err
 }
+
+// UpdateUserTier changes the tier of the user
+func (d *Database) UpdateUserTier(userID, tierID string) error {
+	_, err := d.db.Exec(
+		fmt.Sprintf(
+			"UPDATE %s SET tier_id=$1 WHERE id=$2",
+			tableAppUsers,
+		),
+		tierID,
+		userID,
+	)
+
+	return err
+}
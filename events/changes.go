@@ -0,0 +1,139 @@
+package events
+
+import (
+	"encoding/json"
+	"sync"
+	"time"
+)
+
+// ChannelChanges is the redis pub/sub channel changes are published on, to be streamed by every instance
+const ChannelChanges = "change_channel"
+
+// DefaultReplaySize is the number of recent changes kept for each project to resume streams with `Last-Event-ID`
+const DefaultReplaySize = 256
+
+// subscriptionBuffer is the number of changes a subscriber can fall behind before it is closed
+const subscriptionBuffer = 64
+
+// Change is a create, edit or delete of a resource document or a JSON tree path, streamed to subscribers
+type Change struct {
+	// ID increases with every change of the project
+	ID         int64           `json:"id"`
+	ProjectID  string          `json:"project_id"`
+	Entity     string          `json:"entity"` // resource, json
+	EntityKey  string          `json:"entity_key"`
+	Action     string          `json:"action"` // create, edit, delete
+	DocumentID string          `json:"document_id,omitempty"`
+	Keys       []string        `json:"keys,omitempty"`
+	Creator    string          `json:"creator,omitempty"`
+	Data       json.RawMessage `json:"data,omitempty"`
+	Created    time.Time       `json:"created"`
+}
+
+// Subscription receives the changes of a project which match its filter on `C`. `C` is closed if the subscriber falls
+// behind, the subscriber can then resume from the last change it received.
+type Subscription struct {
+	C         chan *Change
+	projectID string
+	filter    func(*Change) bool
+	broker    *Broker
+}
+
+// Close unsubscribes from the broker
+func (s *Subscription) Close() {
+	s.broker.unsubscribe(s)
+}
+
+// projectChanges are the recent changes and subscriptions of a project
+type projectChanges struct {
+	recent        []*Change
+	subscriptions map[*Subscription]bool
+}
+
+// Broker fans out the changes of each project to the subscriptions of this instance, keeping a bounded buffer of
+// recent changes to replay
+type Broker struct {
+	mu         sync.Mutex
+	replaySize int
+	projects   map[string]*projectChanges
+}
+
+// NewBroker creates and returns a new instance of `Broker` which keeps `replaySize` changes of each project
+func NewBroker(replaySize int) *Broker {
+	return &Broker{
+		replaySize: replaySize,
+		projects:   map[string]*projectChanges{},
+	}
+}
+
+func (b *Broker) project(projectID string) *projectChanges {
+	p, ok := b.projects[projectID]
+	if !ok {
+		p = &projectChanges{subscriptions: map[*Subscription]bool{}}
+		b.projects[projectID] = p
+	}
+	return p
+}
+
+// Publish buffers the change and sends it to the matching subscriptions of its project
+func (b *Broker) Publish(change *Change) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	p := b.project(change.ProjectID)
+	p.recent = append(p.recent, change)
+	if len(p.recent) > b.replaySize {
+		p.recent = p.recent[len(p.recent)-b.replaySize:]
+	}
+
+	for s := range p.subscriptions {
+		if !s.filter(change) {
+			continue
+		}
+		select {
+		case s.C <- change:
+		default:
+			// slow subscribers are dropped rather than blocking every other subscriber
+			delete(p.subscriptions, s)
+			close(s.C)
+		}
+	}
+}
+
+// Subscribe subscribes to the changes of the project which match the filter. The buffered changes after `lastID` are
+// returned to be replayed first, a `lastID` of 0 replays nothing.
+func (b *Broker) Subscribe(projectID string, lastID int64, filter func(*Change) bool) (*Subscription, []*Change) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	p := b.project(projectID)
+	replay := []*Change{}
+	if lastID > 0 {
+		for _, change := range p.recent {
+			if change.ID > lastID && filter(change) {
+				replay = append(replay, change)
+			}
+		}
+	}
+
+	s := &Subscription{
+		C:         make(chan *Change, subscriptionBuffer),
+		projectID: projectID,
+		filter:    filter,
+		broker:    b,
+	}
+	p.subscriptions[s] = true
+
+	return s, replay
+}
+
+func (b *Broker) unsubscribe(s *Subscription) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	p := b.project(s.projectID)
+	if p.subscriptions[s] {
+		delete(p.subscriptions, s)
+		close(s.C)
+	}
+}
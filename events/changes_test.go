@@ -0,0 +1,54 @@
+package events
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBrokerReplay(t *testing.T) {
+	broker := NewBroker(3)
+	dogs := func(change *Change) bool { return change.EntityKey == "dogs" }
+
+	for i := int64(1); i <= 5; i++ {
+		key := "dogs"
+		if i == 4 {
+			key = "cats"
+		}
+		broker.Publish(&Change{ID: i, ProjectID: "project", EntityKey: key})
+	}
+
+	sub, replay := broker.Subscribe("project", 0, dogs)
+	assert.Empty(t, replay, "new streams do not replay")
+	sub.Close()
+
+	sub, replay = broker.Subscribe("project", 2, dogs)
+	defer sub.Close()
+	assert.Len(t, replay, 2)
+	assert.Equal(t, int64(3), replay[0].ID)
+	assert.Equal(t, int64(5), replay[1].ID)
+
+	broker.Publish(&Change{ID: 6, ProjectID: "project", EntityKey: "cats"})
+	broker.Publish(&Change{ID: 7, ProjectID: "project", EntityKey: "dogs"})
+	broker.Publish(&Change{ID: 8, ProjectID: "other", EntityKey: "dogs"})
+	assert.Equal(t, int64(7), (<-sub.C).ID)
+	assert.Len(t, sub.C, 0)
+}
+
+func TestBrokerSlowSubscriber(t *testing.T) {
+	broker := NewBroker(DefaultReplaySize)
+	sub, _ := broker.Subscribe("project", 0, func(*Change) bool { return true })
+
+	for i := int64(1); i <= subscriptionBuffer+1; i++ {
+		broker.Publish(&Change{ID: i, ProjectID: "project"})
+	}
+
+	received := 0
+	for range sub.C {
+		received++
+	}
+	assert.Equal(t, subscriptionBuffer, received, "the subscription is closed once it falls behind")
+
+	// closing a dropped subscription is safe
+	sub.Close()
+}
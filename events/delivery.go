@@ -0,0 +1,330 @@
+package events
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-redis/redis"
+	"github.com/machinable/machinable/dsi/models"
+	"github.com/machinable/machinable/signing"
+)
+
+const (
+	// QueueHookPending is the redis sorted set of hook events waiting for a retry or being delivered, scored by the
+	// time (unix seconds) they are due back on `QueueHooks`
+	QueueHookPending = "hook_pending_queue"
+)
+
+// hookRetryBase is the delay before the first retry, doubled for every following retry
+const hookRetryBase = 30 * time.Second
+
+// hookRetryMax is the longest delay between two attempts
+const hookRetryMax = time.Hour
+
+// hookLeaseGrace is how long past its timeout a delivery is leased to a worker, before it is handed to another
+const hookLeaseGrace = 30 * time.Second
+
+// hookRequeueInterval is how often pending hook events are checked for being due
+const hookRequeueInterval = time.Second
+
+// hookRequeueBatch is the number of due hook events moved back to the queue at once
+const hookRequeueBatch = 100
+
+// hookPollInterval is how often an empty queue is checked for hook events
+const hookPollInterval = 250 * time.Millisecond
+
+// hookResponseLimit is the number of bytes read from the response of a receiver
+const hookResponseLimit = 64 << 10
+
+// hookBodyLimit is the number of bytes of the request and response bodies kept in a result
+const hookBodyLimit = 4 << 10
+
+// requeueDue atomically moves the due members of the pending set (KEYS[1]) to the tail of the queue (KEYS[2]), so
+// every instance can run it
+var requeueDue = redis.NewScript(`
+local due = redis.call('ZRANGEBYSCORE', KEYS[1], '-inf', ARGV[1], 'LIMIT', 0, ARGV[2])
+for _, member in ipairs(due) do
+	redis.call('ZREM', KEYS[1], member)
+	redis.call('RPUSH', KEYS[2], member)
+end
+return #due
+`)
+
+// leaseNext atomically pops the head of the queue (KEYS[1]) and leases it in the pending set (KEYS[2]) until ARGV[1],
+// so a worker which stops right after the pop does not lose the hook event
+var leaseNext = redis.NewScript(`
+local member = redis.call('LPOP', KEYS[1])
+if member then
+	redis.call('ZADD', KEYS[2], ARGV[1], member)
+end
+return member
+`)
+
+// DeliveryConfig configures the delivery of web hooks
+type DeliveryConfig struct {
+	// Timeout is how long a receiver has to respond to a delivery
+	Timeout time.Duration
+	// MaxAttempts is the number of attempts of a delivery before it is given up
+	MaxAttempts int
+}
+
+// ProcessHooks delivers the hook events of the redis queue, recording the result of every attempt. Failed attempts are
+// retried with exponential backoff until the maximum number of attempts, after which the delivery is kept as a failure
+// of the hook. Any number of workers can run on any number of instances. Hook events are leased to the worker delivering
+// them, and handed to another worker if it stops before the attempt is recorded, so receivers can get an event more
+// than once. This function should be run as a goroutine.
+func (p *Processor) ProcessHooks(config DeliveryConfig) error {
+	client := &http.Client{Timeout: config.Timeout}
+	lease := config.Timeout + hookLeaseGrace
+
+	for {
+		// endlessly read from queue, leasing the hook event in the same step
+		result, err := leaseNext.Run(p.cache, []string{QueueHooks, QueueHookPending}, dueScore(lease)).Result()
+		if err == redis.Nil {
+			time.Sleep(hookPollInterval)
+			continue
+		}
+
+		// exit on a read error
+		if err != nil {
+			log.Println(err)
+			return err
+		}
+		member, _ := result.(string)
+
+		hookEvent := &HookEvent{}
+		if err := json.Unmarshal([]byte(member), hookEvent); err != nil || hookEvent.Hook == nil {
+			log.Println("invalid hook event", err)
+			p.cache.ZRem(QueueHookPending, member)
+			continue
+		}
+		if hookEvent.Attempt < 1 {
+			hookEvent.Attempt = 1
+		}
+
+		// deliveries are signed with the current secret, so retries use a rotated secret
+		var hookResult *models.HookResult
+		secret, dsiErr := p.store.GetHookSecret(hookEvent.Hook.ProjectID, hookEvent.Hook.ID)
+		if dsiErr != nil {
+			hookResult = failedResult(hookEvent.Hook, dsiErr)
+		} else {
+			hookResult = Deliver(client, hookEvent, secret)
+		}
+		if err := p.store.AddResult(hookResult); err != nil {
+			log.Println(err)
+		}
+
+		if !hookResult.Succeeded() && hookEvent.Attempt < config.MaxAttempts {
+			retry := *hookEvent
+			retry.Attempt++
+			retry.Attempts = append(retry.Attempts, hookResult)
+			b, err := json.Marshal(&retry)
+			if err == nil {
+				_, err = p.cache.TxPipelined(func(pipe redis.Pipeliner) error {
+					pipe.ZRem(QueueHookPending, member)
+					pipe.ZAdd(QueueHookPending, redis.Z{Score: dueScore(Backoff(hookEvent.Attempt)), Member: b})
+					return nil
+				})
+			}
+			if err != nil {
+				log.Println(err)
+			}
+			continue
+		}
+
+		// deliveries which failed every attempt are kept until they are replayed or discarded
+		if !hookResult.Succeeded() {
+			if err := p.store.AddFailure(failure(hookEvent, hookResult)); err != nil {
+				log.Println(err)
+			}
+		}
+		if err := p.cache.ZRem(QueueHookPending, member).Err(); err != nil {
+			log.Println(err)
+		}
+	}
+}
+
+// QueueHook queues a hook event for delivery
+func (p *Processor) QueueHook(hookEvent *HookEvent) error {
+	b, err := json.Marshal(hookEvent)
+	if err != nil {
+		return err
+	}
+	return p.cache.RPush(QueueHooks, b).Err()
+}
+
+// ReplayFailure queues a failed delivery again, with the same delivery ID, as the first attempt of a new delivery to the
+// current URL and headers of the hook
+func (p *Processor) ReplayFailure(hook *models.WebHook, failure *models.HookFailure) error {
+	return p.QueueHook(&HookEvent{
+		ID:        failure.DeliveryID,
+		Attempt:   1,
+		Hook:      hook,
+		Event:     failure.Event,
+		EntityKey: failure.EntityKey,
+		Payload:   failure.Payload,
+	})
+}
+
+// ProcessHookRetries moves hook events which are due for a retry, or whose lease expired, back to the queue. This
+// function should be run as a goroutine.
+func (p *Processor) ProcessHookRetries() error {
+	for range time.Tick(hookRequeueInterval) {
+		now := strconv.FormatInt(time.Now().Unix(), 10)
+		if err := requeueDue.Run(p.cache, []string{QueueHookPending, QueueHooks}, now, hookRequeueBatch).Err(); err != nil {
+			log.Println(err)
+		}
+	}
+	return nil
+}
+
+// Deliver posts the payload of the hook event to the hook URL, with the headers of the hook, and returns the result of
+// the attempt. The request is signed with the secret, unless it is empty.
+func Deliver(client *http.Client, hookEvent *HookEvent, secret string) *models.HookResult {
+	hook := hookEvent.Hook
+
+	body, err := json.Marshal(hookEvent.Payload)
+	if err != nil {
+		return failedResult(hook, err)
+	}
+
+	req, err := http.NewRequest(http.MethodPost, hook.HookURL, bytes.NewReader(body))
+	if err != nil {
+		return failedResult(hook, err)
+	}
+	for key, value := range hookHeaders(hook) {
+		req.Header.Set(key, value)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "Machinable-Hooks")
+	req.Header.Set("X-Machinable-Delivery", hookEvent.ID)
+	req.Header.Set("X-Machinable-Attempt", strconv.Itoa(hookEvent.Attempt))
+	req.Header.Set("X-Machinable-Event", hookEvent.Event)
+	req.Header.Set("X-Machinable-Entity-Key", hookEvent.EntityKey)
+	if hookEvent.Test {
+		req.Header.Set("X-Machinable-Test", "true")
+	}
+	if secret != "" {
+		signing.SetHeaders(req.Header, secret, body)
+	}
+
+	start := time.Now()
+	resp, err := client.Do(req)
+	if err != nil {
+		hookResult := failedResult(hook, err)
+		hookResult.ResponseTime = int64(time.Since(start) / time.Millisecond)
+		hookResult.RequestHeaders = req.Header
+		hookResult.RequestBody = truncateBody(body)
+		return hookResult
+	}
+	defer resp.Body.Close()
+	// read the rest of the body so the connection is reused
+	respBody, _ := ioutil.ReadAll(io.LimitReader(resp.Body, hookResponseLimit))
+
+	hookResult := &models.HookResult{
+		WebHookID:       hook.ID,
+		ProjectID:       hook.ProjectID,
+		StatusCode:      resp.StatusCode,
+		ResponseTime:    int64(time.Since(start) / time.Millisecond),
+		RequestHeaders:  req.Header,
+		RequestBody:     truncateBody(body),
+		ResponseHeaders: resp.Header,
+		ResponseBody:    truncateBody(respBody),
+		Created:         time.Now(),
+	}
+	if !hookResult.Succeeded() {
+		hookResult.ErrorMessage = fmt.Sprintf("unexpected status code %d", resp.StatusCode)
+	}
+	return hookResult
+}
+
+// truncateBody returns the first `hookBodyLimit` bytes of the body as text which can be stored
+func truncateBody(body []byte) string {
+	truncated := len(body) > hookBodyLimit
+	if truncated {
+		body = body[:hookBodyLimit]
+	}
+
+	text := strings.ToValidUTF8(strings.Replace(string(body), "\x00", "", -1), "\uFFFD")
+	if truncated {
+		text += "...(truncated)"
+	}
+	return text
+}
+
+// failedResult returns the result of an attempt which failed without a response
+func failedResult(hook *models.WebHook, err error) *models.HookResult {
+	return &models.HookResult{
+		WebHookID:    hook.ID,
+		ProjectID:    hook.ProjectID,
+		StatusCode:   -1,
+		ErrorMessage: err.Error(),
+		Created:      time.Now(),
+	}
+}
+
+// failure returns the failed delivery of the hook event, with the result of its last attempt
+func failure(hookEvent *HookEvent, last *models.HookResult) *models.HookFailure {
+	payload, _ := json.Marshal(hookEvent.Payload)
+	return &models.HookFailure{
+		ProjectID:  hookEvent.Hook.ProjectID,
+		WebHookID:  hookEvent.Hook.ID,
+		DeliveryID: hookEvent.ID,
+		Event:      hookEvent.Event,
+		EntityKey:  hookEvent.EntityKey,
+		Payload:    payload,
+		Attempts:   append(hookEvent.Attempts, last),
+	}
+}
+
+// hookHeaders returns the headers of the hook, which are stored as a list of `{"key": ..., "value": ...}` objects.
+// Objects without a `key` are read as header names to values.
+func hookHeaders(hook *models.WebHook) map[string]string {
+	headers := map[string]string{}
+	list := []map[string]string{}
+	if len(hook.Headers) == 0 || json.Unmarshal(hook.Headers, &list) != nil {
+		return headers
+	}
+
+	for _, header := range list {
+		if key, ok := header["key"]; ok {
+			if key != "" {
+				headers[key] = header["value"]
+			}
+			continue
+		}
+		for key, value := range header {
+			headers[key] = value
+		}
+	}
+	return headers
+}
+
+// Backoff returns the delay before the retry of a failed attempt, doubling from `hookRetryBase` up to `hookRetryMax`,
+// with up to half of it randomized so retries of many deliveries spread out
+func Backoff(attempt int) time.Duration {
+	if attempt < 1 {
+		attempt = 1
+	}
+	delay := hookRetryMax
+	if attempt < 20 {
+		if d := hookRetryBase << uint(attempt-1); d < delay {
+			delay = d
+		}
+	}
+	return delay/2 + time.Duration(rand.Int63n(int64(delay/2)+1))
+}
+
+// dueScore returns the pending set score of a hook event due after the delay
+func dueScore(delay time.Duration) float64 {
+	return float64(time.Now().Add(delay).Unix())
+}
@@ -0,0 +1,124 @@
+package events
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/machinable/machinable/dsi/models"
+	"github.com/machinable/machinable/signing"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDeliver(t *testing.T) {
+	status := http.StatusOK
+	var received *http.Request
+	var body []byte
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received = r
+		body, _ = ioutil.ReadAll(r.Body)
+		w.Header().Set("X-Receiver", "pets")
+		w.WriteHeader(status)
+		w.Write([]byte("thanks"))
+	}))
+	defer server.Close()
+
+	hookEvent := &HookEvent{
+		ID:      "delivery",
+		Attempt: 2,
+		Hook: &models.WebHook{
+			ID:        "hook",
+			ProjectID: "project",
+			Headers:   []byte(`[{"key": "Authorization", "value": "Bearer secret"}, {"X-Team": "pets"}, {"key": "", "value": "skipped"}]`),
+			HookURL:   server.URL,
+		},
+		Payload: map[string]interface{}{"name": "rex"},
+	}
+
+	result := Deliver(server.Client(), hookEvent, "whsec_test")
+	assert.True(t, result.Succeeded())
+	assert.Equal(t, "hook", result.WebHookID)
+	assert.Equal(t, "project", result.ProjectID)
+	assert.Empty(t, result.ErrorMessage)
+	assert.Equal(t, "Bearer secret", received.Header.Get("Authorization"))
+	assert.Equal(t, "pets", received.Header.Get("X-Team"))
+	assert.Equal(t, "application/json", received.Header.Get("Content-Type"))
+	assert.Equal(t, "delivery", received.Header.Get("X-Machinable-Delivery"))
+	assert.Equal(t, "2", received.Header.Get("X-Machinable-Attempt"))
+	assert.Nil(t, signing.Verify("whsec_test", received.Header, body, signing.DefaultTolerance))
+	assert.Empty(t, received.Header.Get("X-Machinable-Test"))
+	assert.Equal(t, string(body), result.RequestBody)
+	assert.Equal(t, "Bearer secret", result.RequestHeaders.Get("Authorization"))
+	assert.Equal(t, "thanks", result.ResponseBody)
+	assert.Equal(t, "pets", result.ResponseHeaders.Get("X-Receiver"))
+
+	payload := map[string]interface{}{}
+	assert.Nil(t, json.Unmarshal(body, &payload))
+	assert.Equal(t, "rex", payload["name"])
+
+	status = http.StatusServiceUnavailable
+	result = Deliver(server.Client(), hookEvent, "")
+	assert.False(t, result.Succeeded())
+	assert.Equal(t, http.StatusServiceUnavailable, result.StatusCode)
+	assert.NotEmpty(t, result.ErrorMessage)
+
+	hookEvent.Hook.HookURL = "http://127.0.0.1:1"
+	result = Deliver(server.Client(), hookEvent, "")
+	assert.Equal(t, -1, result.StatusCode)
+	assert.NotEmpty(t, result.ErrorMessage)
+}
+
+func TestBackoff(t *testing.T) {
+	tables := []struct {
+		attempt int
+		max     time.Duration
+	}{
+		{0, hookRetryBase},
+		{1, hookRetryBase},
+		{2, 2 * hookRetryBase},
+		{4, 8 * hookRetryBase},
+		{10, hookRetryMax},
+		{100, hookRetryMax},
+	}
+
+	for _, tt := range tables {
+		for i := 0; i < 10; i++ {
+			delay := Backoff(tt.attempt)
+			assert.True(t, delay >= tt.max/2 && delay <= tt.max, tt.attempt)
+		}
+	}
+}
+
+func TestFailure(t *testing.T) {
+	hookEvent := &HookEvent{
+		ID:        "delivery",
+		Attempt:   2,
+		Hook:      &models.WebHook{ID: "hook", ProjectID: "project"},
+		EntityKey: "dogs",
+		Payload:   map[string]interface{}{"name": "rex"},
+		Attempts:  []*models.HookResult{{StatusCode: 500}},
+	}
+
+	f := failure(hookEvent, &models.HookResult{StatusCode: -1, ErrorMessage: "timeout"})
+	assert.Equal(t, "project", f.ProjectID)
+	assert.Equal(t, "hook", f.WebHookID)
+	assert.Equal(t, "delivery", f.DeliveryID)
+	assert.Equal(t, "dogs", f.EntityKey)
+	assert.JSONEq(t, `{"name": "rex"}`, string(f.Payload))
+	if assert.Len(t, f.Attempts, 2) {
+		assert.Equal(t, 500, f.Attempts[0].StatusCode)
+		assert.Equal(t, "timeout", f.Attempts[1].ErrorMessage)
+	}
+}
+
+func TestTruncateBody(t *testing.T) {
+	assert.Equal(t, `{"name": "rex"}`, truncateBody([]byte(`{"name": "rex"}`)))
+	assert.Equal(t, "rex\uFFFD", truncateBody([]byte("r\x00ex\xff")))
+
+	long := truncateBody([]byte(strings.Repeat("a", hookBodyLimit+1)))
+	assert.Equal(t, strings.Repeat("a", hookBodyLimit)+"...(truncated)", long)
+}
@@ -1,6 +1,13 @@
 package events
 
-import "github.com/machinable/machinable/dsi/models"
+import (
+	"time"
+
+	"github.com/machinable/machinable/dsi/models"
+)
+
+// EnvelopeVersion is the version of the `Envelope` of web hook deliveries
+const EnvelopeVersion = "1"
 
 const (
 	// QueueHooks is the redis queue for web hooks
@@ -13,20 +20,65 @@ const (
 
 // Event defines the event(s) to be processed
 type Event struct {
+	// ID identifies the event, it is generated when the event is pushed if it is empty
+	ID        string                `json:"id"`
 	Project   *models.ProjectDetail `json:"project"`
 	Entity    string                `json:"entity"` // resource, json
 	EntityKey string                `json:"entity_key"`
 	EntityID  string                `json:"entity_id"`
 	Action    string                `json:"action"` // create, edit, delete
 	Keys      []string              `json:"keys"`
-	Payload   []byte                `json:"payload"`
+	// Data is the value written, as the datastore returned it, and nil for deletes
+	Data []byte `json:"data"`
+	// Previous is the value before the write, only set for edits and deletes the hooks of the project are subscribed to
+	Previous []byte `json:"previous,omitempty"`
+	// DocumentID and Creator identify the resource document, they are read from the data if it has them
+	DocumentID string `json:"document_id"`
+	Creator    string `json:"creator"`
+	// AuthType and AuthID identify the actor of the write
+	AuthType   string    `json:"auth_type"`
+	AuthID     string    `json:"auth_id"`
+	OccurredAt time.Time `json:"occurred_at"`
+	// SkipHooks is true if the requester disabled web hooks for the write, which is still published as a change
+	SkipHooks bool `json:"skip_hooks,omitempty"`
+}
+
+// Envelope is the payload of web hook deliveries. Receivers can dedupe events by `ID`, which is the same for every
+// delivery of the event, retries and replays included.
+type Envelope struct {
+	Version    string               `json:"version"`
+	ID         string               `json:"id"`
+	Type       string               `json:"type"` // <entity>.<action>, i.e. resource.edit
+	ProjectID  string               `json:"project_id"`
+	Entity     string               `json:"entity"`
+	Key        string               `json:"key"` // resource path name or JSON root key
+	DocumentID string               `json:"document_id,omitempty"`
+	Keys       []string             `json:"keys,omitempty"`
+	OccurredAt time.Time            `json:"occurred_at"`
+	Actor      Actor                `json:"actor"`
+	Data       interface{}          `json:"data"`
+	Previous   interface{}          `json:"previous,omitempty"`
+	Diff       []*models.JSONChange `json:"diff,omitempty"`
+}
+
+// Actor identifies who made the change of an event
+type Actor struct {
+	AuthType string `json:"authType"` // user, apikey, anonymous
+	AuthID   string `json:"authID"`
 }
 
-// HookEvent describes a single web hook event
+// HookEvent describes a single web hook event. Each event is a delivery, identified by `ID` across its attempts.
 type HookEvent struct {
+	ID        string          `json:"id"`
+	Attempt   int             `json:"attempt"`
 	Hook      *models.WebHook `json:"hook"`
+	Event     string          `json:"event"` // create, edit, delete
 	EntityKey string          `json:"entity_key"`
 	Payload   interface{}     `json:"payload"`
+	// Attempts are the results of the failed attempts so far
+	Attempts []*models.HookResult `json:"attempts,omitempty"`
+	// Test marks synthetic events sent to try a hook
+	Test bool `json:"test,omitempty"`
 }
 
 // Notification contains the information in the queue for an email notification
@@ -2,27 +2,109 @@ package events
 
 import (
 	"encoding/json"
+	"fmt"
 	"log"
+	"time"
 
 	"github.com/go-redis/redis"
 	"github.com/machinable/machinable/dsi/interfaces"
 	"github.com/machinable/machinable/dsi/models"
+	uuid "github.com/satori/go.uuid"
 )
 
-// Processor process and emits events for web hooks and websockets
+// Processor process and emits events for web hooks and streams
 type Processor struct {
-	cache redis.UniversalClient
-	store interfaces.ProjectHooksDatastore
+	cache   redis.UniversalClient
+	store   interfaces.ProjectHooksDatastore
+	changes *Broker
+	// notifier notifies the changes of every instance, if nil changes are published through redis by the instance
+	// which made them
+	notifier interfaces.ChangesDatastore
 }
 
-// NewProcessor creates and returns a new instance of `Processor` with the given redis client
-func NewProcessor(cache redis.UniversalClient, store interfaces.ProjectHooksDatastore) *Processor {
+// NewProcessor creates and returns a new instance of `Processor` with the given redis client. Changes are streamed from
+// the `notifier` if it is not nil.
+func NewProcessor(cache redis.UniversalClient, store interfaces.ProjectHooksDatastore, notifier interfaces.ChangesDatastore) *Processor {
 	return &Processor{
-		cache: cache,
-		store: store,
+		cache:    cache,
+		store:    store,
+		changes:  NewBroker(DefaultReplaySize),
+		notifier: notifier,
 	}
 }
 
+// Changes returns the broker of the changes streamed by this instance
+func (p *Processor) Changes() *Broker {
+	return p.changes
+}
+
+// ProcessChanges listens for the changes published by every instance, or notified by the datastore, and sends them to
+// the subscriptions of this instance. This function should be run as a goroutine.
+func (p *Processor) ProcessChanges() error {
+	if p.notifier != nil {
+		return p.notifier.ListenChanges(func(b []byte) {
+			change := &Change{}
+			if err := json.Unmarshal(b, change); err != nil {
+				log.Println(err)
+				return
+			}
+
+			p.changes.Publish(change)
+		})
+	}
+
+	pubsub := p.cache.Subscribe(ChannelChanges)
+	defer pubsub.Close()
+
+	for {
+		msg, err := pubsub.ReceiveMessage()
+
+		// exit on a read error
+		if err != nil {
+			log.Println(err)
+			return err
+		}
+
+		change := &Change{}
+		if err := json.Unmarshal([]byte(msg.Payload), change); err != nil {
+			log.Println(err)
+			continue
+		}
+
+		p.changes.Publish(change)
+	}
+}
+
+// publishChange publishes the event as a change to every instance. Change IDs are counted per project in redis, so
+// streams can resume on any instance.
+func (p *Processor) publishChange(e *Event) error {
+	id, err := p.cache.Incr(fmt.Sprintf("changes:%s", e.Project.ID)).Result()
+	if err != nil {
+		return err
+	}
+
+	change := &Change{
+		ID:         id,
+		ProjectID:  e.Project.ID,
+		Entity:     e.Entity,
+		EntityKey:  e.EntityKey,
+		Action:     e.Action,
+		DocumentID: e.DocumentID,
+		Keys:       e.Keys,
+		Creator:    e.Creator,
+		Created:    e.OccurredAt,
+	}
+	if json.Valid(e.Data) {
+		change.Data = e.Data
+	}
+
+	b, err := json.Marshal(change)
+	if err != nil {
+		return err
+	}
+	return p.cache.Publish(ChannelChanges, b).Err()
+}
+
 // ProcessResults listens for web hook results on the redis queue. This function should be run as a goroutine.
 func (p *Processor) ProcessResults() error {
 	for {
@@ -50,45 +132,119 @@ func (p *Processor) ProcessResults() error {
 	}
 }
 
+// NeedsPrevious returns true if a hook of the project is subscribed to the event, so its envelope includes the value
+// before the write
+func NeedsPrevious(project *models.ProjectDetail, action, entity, entityID string, keys []string) bool {
+	for _, hook := range project.Hooks {
+		if hook.Subscribes(action, entity, entityID, keys) {
+			return true
+		}
+	}
+	return false
+}
+
 // PushEvent processes and emits an event
 func (p *Processor) PushEvent(e *Event) error {
+	if e.ID == "" {
+		e.ID = uuid.NewV4().String()
+	}
+	if e.OccurredAt.IsZero() {
+		e.OccurredAt = time.Now()
+	}
+	identify(e)
+
+	var envelope *Envelope
 	hooks := e.Project.Hooks
+	if e.SkipHooks {
+		hooks = nil
+	}
 	for _, hook := range hooks {
-		// emit event to redis for the event action
-		if hook.HookEvent == e.Action &&
-			hook.Entity == e.Entity &&
-			hook.EntityID == e.EntityID &&
-			hook.IsEnabled == true {
-			hookEvent := &HookEvent{}
-
-			if hook.Entity == "json" {
-				var payload interface{}
-				json.Unmarshal(e.Payload, &payload)
-
-				container := map[string]interface{}{
-					"data": payload,
-					"keys": e.Keys,
-				}
-
-				hookEvent.Hook = hook
-				hookEvent.Payload = container
-			} else {
-				var payload interface{}
-				json.Unmarshal(e.Payload, &payload)
-				hookEvent.Hook = hook
-				hookEvent.Payload = payload
-			}
-			hookEvent.EntityKey = e.EntityKey
+		if !hook.Subscribes(e.Action, e.Entity, e.EntityID, e.Keys) {
+			continue
+		}
 
-			b, merr := json.Marshal(hookEvent)
-			if merr != nil {
-				log.Println(merr)
-				continue
-			}
-			if err := p.cache.RPush(QueueHooks, b).Err(); err != nil {
-				log.Println(err)
-			}
+		// the envelope is the same for every hook, only filtering it differs
+		if envelope == nil {
+			envelope = NewEnvelope(e)
+		}
+		if !models.MatchHookFilter(hook.Filter, envelope.Previous, envelope.Data, e.Action) {
+			continue
+		}
+
+		// emit event to redis for the hooks subscribed to the action of the entity, which pass their filter
+		hookEvent := &HookEvent{
+			ID:        uuid.NewV4().String(),
+			Attempt:   1,
+			Hook:      hook,
+			Event:     e.Action,
+			EntityKey: e.EntityKey,
+			Payload:   envelope,
+		}
+		if err := p.QueueHook(hookEvent); err != nil {
+			log.Println(err)
+		}
+	}
+
+	// changes notified by the datastore are not published again
+	if p.notifier == nil {
+		if err := p.publishChange(e); err != nil {
+			log.Println(err)
 		}
 	}
 	return nil
 }
+
+// NewEnvelope returns the envelope web hooks are delivered for the event. Edits with a previous value include the
+// changes from it.
+func NewEnvelope(e *Event) *Envelope {
+	envelope := &Envelope{
+		Version:    EnvelopeVersion,
+		ID:         e.ID,
+		Type:       fmt.Sprintf("%s.%s", e.Entity, e.Action),
+		Entity:     e.Entity,
+		Key:        e.EntityKey,
+		DocumentID: e.DocumentID,
+		Keys:       e.Keys,
+		OccurredAt: e.OccurredAt,
+		Actor:      Actor{AuthType: e.AuthType, AuthID: e.AuthID},
+	}
+	if e.Project != nil {
+		envelope.ProjectID = e.Project.ID
+	}
+
+	json.Unmarshal(e.Data, &envelope.Data)
+	if len(e.Previous) > 0 {
+		json.Unmarshal(e.Previous, &envelope.Previous)
+		if e.Action == models.HookEdit {
+			envelope.Diff = models.DiffJSON(envelope.Previous, envelope.Data)
+		}
+	}
+	return envelope
+}
+
+// identify sets the document ID and creator of resource events from their data, or the deleted document
+func identify(e *Event) {
+	if e.Entity != models.EndpointResource {
+		return
+	}
+
+	data := e.Data
+	if len(data) == 0 {
+		data = e.Previous
+	}
+	doc := struct {
+		ID       string `json:"id"`
+		Metadata struct {
+			Creator string `json:"creator"`
+		} `json:"_metadata"`
+	}{}
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return
+	}
+	if e.DocumentID == "" {
+		e.DocumentID = doc.ID
+	}
+	if e.Creator == "" {
+		e.Creator = doc.Metadata.Creator
+	}
+}
@@ -0,0 +1,124 @@
+package events
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/go-redis/redis"
+	"github.com/machinable/machinable/dsi/models"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewEnvelope(t *testing.T) {
+	occurred := time.Unix(1580753521, 0)
+	e := &Event{
+		ID:         "event",
+		Project:    &models.ProjectDetail{ID: "project"},
+		Entity:     models.EndpointResource,
+		EntityKey:  "orders",
+		Action:     models.HookEdit,
+		Data:       []byte(`{"id": "order", "status": "shipped", "_metadata": {"creator": "jane"}}`),
+		Previous:   []byte(`{"id": "order", "status": "packed", "_metadata": {"creator": "jane"}}`),
+		AuthType:   "apikey",
+		AuthID:     "key",
+		OccurredAt: occurred,
+	}
+	identify(e)
+	assert.Equal(t, "order", e.DocumentID)
+	assert.Equal(t, "jane", e.Creator)
+
+	envelope := NewEnvelope(e)
+	assert.Equal(t, EnvelopeVersion, envelope.Version)
+	assert.Equal(t, "event", envelope.ID)
+	assert.Equal(t, "resource.edit", envelope.Type)
+	assert.Equal(t, "project", envelope.ProjectID)
+	assert.Equal(t, "orders", envelope.Key)
+	assert.Equal(t, "order", envelope.DocumentID)
+	assert.Equal(t, occurred, envelope.OccurredAt)
+	assert.Equal(t, Actor{AuthType: "apikey", AuthID: "key"}, envelope.Actor)
+	assert.Equal(t, "shipped", envelope.Data.(map[string]interface{})["status"])
+	assert.Equal(t, "packed", envelope.Previous.(map[string]interface{})["status"])
+	if assert.Len(t, envelope.Diff, 1) {
+		assert.Equal(t, "/status", envelope.Diff[0].Path)
+		assert.Equal(t, "shipped", envelope.Diff[0].Value)
+		assert.Equal(t, "packed", envelope.Diff[0].Previous)
+	}
+
+	// deletes have no data, and their document is the previous value
+	e = &Event{
+		ID:         "event",
+		Entity:     models.EndpointResource,
+		Action:     models.HookDelete,
+		Previous:   []byte(`{"id": "order", "_metadata": {"creator": "jane"}}`),
+		OccurredAt: occurred,
+	}
+	identify(e)
+	assert.Equal(t, "order", e.DocumentID)
+
+	b, err := json.Marshal(NewEnvelope(e))
+	assert.Nil(t, err)
+	payload := map[string]interface{}{}
+	assert.Nil(t, json.Unmarshal(b, &payload))
+	assert.Nil(t, payload["data"])
+	assert.Contains(t, payload, "data")
+	assert.NotContains(t, payload, "diff")
+	assert.Equal(t, "order", payload["previous"].(map[string]interface{})["id"])
+
+	// JSON events carry the keys of the write
+	e = &Event{
+		ID:        "event",
+		Entity:    models.EndpointJSON,
+		EntityKey: "settings",
+		Action:    models.HookCreate,
+		Keys:      []string{"theme"},
+		Data:      []byte(`"dark"`),
+	}
+	identify(e)
+	assert.Empty(t, e.DocumentID)
+
+	envelope = NewEnvelope(e)
+	assert.Equal(t, "json.create", envelope.Type)
+	assert.Equal(t, []string{"theme"}, envelope.Keys)
+	assert.Equal(t, "dark", envelope.Data)
+	assert.Nil(t, envelope.Previous)
+	assert.Empty(t, envelope.Diff)
+}
+
+// recordingCache records the hook events queued and the changes published by a processor
+type recordingCache struct {
+	redis.UniversalClient
+	queued    []interface{}
+	published []interface{}
+}
+
+func (r *recordingCache) RPush(key string, values ...interface{}) *redis.IntCmd {
+	r.queued = append(r.queued, values...)
+	return redis.NewIntResult(int64(len(r.queued)), nil)
+}
+
+func (r *recordingCache) Incr(key string) *redis.IntCmd {
+	return redis.NewIntResult(int64(len(r.published)+1), nil)
+}
+
+func (r *recordingCache) Publish(channel string, message interface{}) *redis.IntCmd {
+	r.published = append(r.published, message)
+	return redis.NewIntResult(1, nil)
+}
+
+func TestPushEventSkipHooks(t *testing.T) {
+	project := &models.ProjectDetail{ID: "project", Hooks: []*models.WebHook{
+		{ID: "hook", IsEnabled: true, Entity: models.EndpointResource, HookEvents: []string{models.HookCreate}, Headers: []byte(`[]`)},
+	}}
+	cache := &recordingCache{}
+	p := NewProcessor(cache, nil, nil)
+
+	assert.Nil(t, p.PushEvent(&Event{Project: project, Entity: models.EndpointResource, EntityKey: "dogs", Action: models.HookCreate, Data: []byte(`{"id": "rex"}`)}))
+	assert.Len(t, cache.queued, 1)
+	assert.Len(t, cache.published, 1)
+
+	// writes which disable hooks are still published to streams
+	assert.Nil(t, p.PushEvent(&Event{Project: project, Entity: models.EndpointResource, EntityKey: "dogs", Action: models.HookCreate, Data: []byte(`{"id": "max"}`), SkipHooks: true}))
+	assert.Len(t, cache.queued, 1)
+	assert.Len(t, cache.published, 2)
+}
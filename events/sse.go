@@ -0,0 +1,65 @@
+package events
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-contrib/sse"
+	"github.com/gin-gonic/gin"
+)
+
+// keepAliveInterval is how often a comment is sent on idle streams, so proxies do not close them
+const keepAliveInterval = 15 * time.Second
+
+// ServeSSE streams the changes of the project which match the filter as Server-Sent Events, named by their action,
+// until the client disconnects. `render` can modify the change for the subscriber, i.e. removing fields it cannot read.
+// Streams resume after the `Last-Event-ID` header, or `lastEventId` query parameter, from the recent changes.
+func ServeSSE(c *gin.Context, broker *Broker, projectID string, filter func(*Change) bool, render func(*Change) *Change) {
+	lastEventID := c.GetHeader("Last-Event-ID")
+	if lastEventID == "" {
+		lastEventID = c.Query("lastEventId")
+	}
+	lastID, _ := strconv.ParseInt(lastEventID, 10, 64)
+
+	sub, replay := broker.Subscribe(projectID, lastID, filter)
+	defer sub.Close()
+
+	c.Header("Content-Type", sse.ContentType)
+	c.Header("Cache-Control", "no-cache")
+	c.Header("X-Accel-Buffering", "no")
+	c.Status(http.StatusOK)
+	c.Writer.Flush()
+
+	send := func(change *Change) {
+		c.Render(-1, sse.Event{
+			Id:    strconv.FormatInt(change.ID, 10),
+			Event: change.Action,
+			Data:  render(change),
+		})
+		c.Writer.Flush()
+	}
+
+	for _, change := range replay {
+		send(change)
+	}
+
+	keepAlive := time.NewTicker(keepAliveInterval)
+	defer keepAlive.Stop()
+
+	for {
+		select {
+		case change, ok := <-sub.C:
+			if !ok {
+				// the subscriber fell behind, clients reconnect with the `Last-Event-ID` of the last change
+				return
+			}
+			send(change)
+		case <-keepAlive.C:
+			c.Writer.WriteString(": keep-alive\n\n")
+			c.Writer.Flush()
+		case <-c.Request.Context().Done():
+			return
+		}
+	}
+}
@@ -7,15 +7,21 @@ import (
 	"net/http"
 	"os"
 	"strings"
+	"time"
 
 	"github.com/go-redis/redis"
-	"github.com/machinable/machinable/config"
+	appConfig "github.com/machinable/machinable/config"
+	dsiCache "github.com/machinable/machinable/dsi/cache"
+	"github.com/machinable/machinable/dsi/interfaces"
 	"github.com/machinable/machinable/dsi/postgres"
 	"github.com/machinable/machinable/events"
 	"github.com/machinable/machinable/management"
 	"github.com/machinable/machinable/projects"
 )
 
+// changeLogCompactionInterval is how often the change log is compacted
+const changeLogCompactionInterval = time.Hour
+
 // HostSwitch is used to switch routers based on sub domain
 type HostSwitch map[string]http.Handler
 
@@ -48,7 +54,7 @@ func main() {
 	configPath := os.Getenv("MACHINABLE_CONFIG_PATH")
 	file, _ := ioutil.ReadFile(configPath)
 
-	config := &config.AppConfig{}
+	config := &appConfig.AppConfig{}
 	json.Unmarshal([]byte(file), &config)
 
 	// secrets come from environment
@@ -83,8 +89,37 @@ func main() {
 		log.Fatal(pong, err)
 	}
 
+	// cache the project details and resource definitions read on every request
+	var store interfaces.Datastore = datastore
+	switch config.GetCacheBackend() {
+	case appConfig.CacheMemory:
+		store = dsiCache.New(datastore, dsiCache.NewMemory(config.GetCacheTTL()))
+	case appConfig.CacheRedis:
+		store = dsiCache.New(datastore, dsiCache.NewRedis(cache, config.GetCacheTTL()))
+	}
+
+	// changes are notified by postgres triggers, or published through redis by the instance which made them
+	var notifier interfaces.ChangesDatastore
+	if config.GetChangeBus() == appConfig.ChangeBusPostgres {
+		notifier = datastore
+	}
+
 	// create event processor
-	processor := events.NewProcessor(cache, datastore)
+	processor := events.NewProcessor(cache, store, notifier)
+
+	// deliver web hooks, retries and expired leases are moved back to the queue by every instance
+	delivery := events.DeliveryConfig{
+		Timeout:     config.GetHookTimeout(),
+		MaxAttempts: config.GetHookMaxAttempts(),
+	}
+	for i := 0; i < config.GetHookWorkers(); i++ {
+		go func() {
+			err := processor.ProcessHooks(delivery)
+			// fail out
+			log.Fatal(err)
+		}()
+	}
+	go processor.ProcessHookRetries()
 
 	// process web hook results
 	go func() {
@@ -93,13 +128,29 @@ func main() {
 		log.Fatal(err)
 	}()
 
+	// stream the changes of every instance
+	go func() {
+		err := processor.ProcessChanges()
+		// fail out
+		log.Fatal(err)
+	}()
+
+	// compact the change log, clients which have not synced within the retention start over
+	go func() {
+		for range time.Tick(changeLogCompactionInterval) {
+			if err := datastore.CompactChanges(config.GetChangeLogRetention()); err != nil {
+				log.Println(err)
+			}
+		}
+	}()
+
 	// switch routers based on subdomain
 	hostSwitch := make(HostSwitch)
 
 	// manage is for the management application api, i.e. project/team management
-	hostSwitch["manage"] = management.CreateRoutes(datastore, cache, config)
+	hostSwitch["manage"] = management.CreateRoutes(store, cache, config)
 	// all other subdomains will be treated as project names, and use the project routes
-	hostSwitch["*"] = projects.CreateRoutes(datastore, cache, processor, config)
+	hostSwitch["*"] = projects.CreateRoutes(store, cache, processor, config)
 
 	log.Fatal(http.ListenAndServe(":5001", hostSwitch))
 }
@@ -1,23 +1,27 @@
 package projects
 
 import (
+	"log"
 	"net/http"
 
 	"github.com/gin-gonic/gin"
 	"github.com/machinable/machinable/dsi/interfaces"
 	"github.com/machinable/machinable/dsi/models"
+	"github.com/machinable/machinable/storage"
 )
 
 // New returns a pointer to a new `Projects`
-func New(db interfaces.Datastore) *Projects {
+func New(db interfaces.Datastore, files storage.Backend) *Projects {
 	return &Projects{
 		store: db,
+		files: files,
 	}
 }
 
-// Projects contains the datastore and any HTTP handlers needed for application projects
+// Projects contains the datastore, file storage and any HTTP handlers needed for application projects
 type Projects struct {
 	store interfaces.Datastore
+	files storage.Backend
 }
 
 // UpdateProject updates the project settings, specifically the authn value
@@ -151,6 +155,9 @@ func (p *Projects) DeleteUserProject(c *gin.Context) {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "error deleting project resources"})
 		return
 	}
+	if err := p.files.DeleteAll(models.ProjectFilesPrefix(projectID)); err != nil {
+		log.Println("could not delete project files ", err.Error())
+	}
 	projectErr := p.store.DeleteProject(projectID)
 	if projectErr != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "error deleting project"})
@@ -5,11 +5,12 @@ import (
 	"github.com/machinable/machinable/config"
 	"github.com/machinable/machinable/dsi/interfaces"
 	"github.com/machinable/machinable/middleware"
+	"github.com/machinable/machinable/storage"
 )
 
 // SetRoutes sets all of the appropriate routes to handlers for projects
 func SetRoutes(engine *gin.Engine, datastore interfaces.Datastore, config *config.AppConfig) error {
-	handler := New(datastore)
+	handler := New(datastore, storage.NewLocal(config.GetFileStoragePath()))
 
 	// project endpoints
 	projects := engine.Group("/projects")
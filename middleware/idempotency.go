@@ -0,0 +1,144 @@
+package middleware
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-redis/redis"
+)
+
+// IdempotencyKeyHeader is the request header clients use to safely retry a POST
+const IdempotencyKeyHeader = "Idempotency-Key"
+
+// IdempotentReplayedHeader is set on responses which were replayed from the idempotency cache
+const IdempotentReplayedHeader = "Idempotent-Replayed"
+
+// idempotencyLockTime is how long a key is held while the original request is in progress
+const idempotencyLockTime = time.Minute
+
+// idempotentResponse is the cached response of a request with an `Idempotency-Key`
+type idempotentResponse struct {
+	Pending     bool   `json:"pending"`
+	Fingerprint string `json:"fingerprint"`
+	StatusCode  int    `json:"status_code"`
+	ContentType string `json:"content_type"`
+	Body        []byte `json:"body"`
+}
+
+// IdempotencyMiddleware caches the response of POST requests with an `Idempotency-Key` header per project, requester
+// and key, for the duration of `window`. Retries with the same key return the original response instead of repeating
+// the request, and requests with the same key but a different body are rejected. This middleware requires that the
+// `projectId` and the requester have been injected into the context.
+func IdempotencyMiddleware(cache redis.UniversalClient, window time.Duration) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		idempotencyKey := c.GetHeader(IdempotencyKeyHeader)
+		// dry runs have no effect to repeat
+		if c.Request.Method != "POST" || idempotencyKey == "" || DryRun(c) {
+			c.Next()
+			return
+		}
+
+		if len(idempotencyKey) > 255 {
+			respondWithError(http.StatusBadRequest, "idempotency key cannot be longer than 255 characters", c)
+			return
+		}
+
+		body, err := ioutil.ReadAll(c.Request.Body)
+		if err != nil {
+			respondWithError(http.StatusBadRequest, "error reading request body", c)
+			return
+		}
+		c.Request.Body = ioutil.NopCloser(bytes.NewBuffer(body))
+
+		// the same key can not be reused for a different request
+		sum := sha256.Sum256(append([]byte(c.Request.URL.Path+"\n"), body...))
+		fingerprint := hex.EncodeToString(sum[:])
+
+		cacheKey := fmt.Sprintf("idempotency:%s:%s:%s", c.GetString("projectId"), idempotencyRequester(c), idempotencyKey)
+
+		pending, _ := json.Marshal(&idempotentResponse{Pending: true, Fingerprint: fingerprint})
+		acquired, err := cache.SetNX(cacheKey, pending, idempotencyLockTime).Result()
+		if err != nil {
+			log.Println("could not read from cache ", err.Error())
+			// continue handler chain as to not disrupt user experience
+			c.Next()
+			return
+		}
+
+		if !acquired {
+			replayIdempotentResponse(c, cache, cacheKey, fingerprint)
+			return
+		}
+
+		// capture the response to cache it
+		lw := &logWriter{body: bytes.NewBufferString(""), ResponseWriter: c.Writer}
+		c.Writer = lw
+
+		c.Next()
+
+		statusCode := c.Writer.Status()
+		if statusCode >= http.StatusInternalServerError {
+			// server errors are not cached, so the client can retry
+			cache.Del(cacheKey)
+			return
+		}
+
+		response, _ := json.Marshal(&idempotentResponse{
+			Fingerprint: fingerprint,
+			StatusCode:  statusCode,
+			ContentType: c.Writer.Header().Get("Content-Type"),
+			Body:        lw.body.Bytes(),
+		})
+		if err := cache.Set(cacheKey, response, window).Err(); err != nil {
+			log.Println("could not write to cache ", err.Error())
+		}
+	}
+}
+
+// idempotencyRequester identifies the requester of an idempotent request, so requesters never receive the response of
+// another requester which used the same key. Anonymous requesters are identified by their IP address.
+func idempotencyRequester(c *gin.Context) string {
+	if authID := c.GetString("authID"); authID != "" {
+		return c.GetString("authType") + ":" + authID
+	}
+	return "anonymous:" + c.ClientIP()
+}
+
+// replayIdempotentResponse writes the cached response for the idempotency key
+func replayIdempotentResponse(c *gin.Context, cache redis.UniversalClient, cacheKey, fingerprint string) {
+	b, err := cache.Get(cacheKey).Bytes()
+	if err != nil {
+		respondWithError(http.StatusConflict, "a request with this idempotency key is in progress", c)
+		return
+	}
+
+	cached := &idempotentResponse{}
+	if err := json.Unmarshal(b, cached); err != nil {
+		respondWithError(http.StatusInternalServerError, "invalid idempotency cache entry", c)
+		return
+	}
+
+	if cached.Fingerprint != fingerprint {
+		respondWithError(http.StatusUnprocessableEntity, "idempotency key has already been used for a different request", c)
+		return
+	}
+
+	if cached.Pending {
+		respondWithError(http.StatusConflict, "a request with this idempotency key is in progress", c)
+		return
+	}
+
+	// replays do not trigger events
+	c.Set("idempotentReplay", true)
+	c.Header(IdempotentReplayedHeader, "true")
+	c.Data(cached.StatusCode, cached.ContentType, cached.Body)
+	c.Abort()
+}
@@ -0,0 +1,94 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-redis/redis"
+	"github.com/stretchr/testify/assert"
+)
+
+// memoryCache is an in memory cache of the commands used by the idempotency middleware
+type memoryCache struct {
+	redis.UniversalClient
+	values map[string]string
+}
+
+func (m *memoryCache) SetNX(key string, value interface{}, expiration time.Duration) *redis.BoolCmd {
+	if _, ok := m.values[key]; ok {
+		return redis.NewBoolResult(false, nil)
+	}
+	m.values[key] = string(value.([]byte))
+	return redis.NewBoolResult(true, nil)
+}
+
+func (m *memoryCache) Set(key string, value interface{}, expiration time.Duration) *redis.StatusCmd {
+	m.values[key] = string(value.([]byte))
+	return redis.NewStatusResult("OK", nil)
+}
+
+func (m *memoryCache) Get(key string) *redis.StringCmd {
+	value, ok := m.values[key]
+	if !ok {
+		return redis.NewStringResult("", redis.Nil)
+	}
+	return redis.NewStringResult(value, nil)
+}
+
+func (m *memoryCache) Del(keys ...string) *redis.IntCmd {
+	for _, key := range keys {
+		delete(m.values, key)
+	}
+	return redis.NewIntResult(int64(len(keys)), nil)
+}
+
+func TestIdempotencyMiddleware(t *testing.T) {
+	gin.SetMode(gin.ReleaseMode)
+	engine := gin.New()
+	created := 0
+	engine.POST("/api/:resourcePathName",
+		func(c *gin.Context) {
+			c.Set("projectId", "project")
+			c.Set("authType", "user")
+			c.Set("authID", c.GetHeader("X-User"))
+			c.Next()
+		},
+		IdempotencyMiddleware(&memoryCache{values: map[string]string{}}, time.Hour),
+		func(c *gin.Context) {
+			created++
+			c.JSON(http.StatusCreated, gin.H{"owner": c.GetString("authID"), "number": created})
+		},
+	)
+	post := func(user, body string) *httptest.ResponseRecorder {
+		req, _ := http.NewRequest(http.MethodPost, "/api/notes", strings.NewReader(body))
+		req.Header.Set(IdempotencyKeyHeader, "key")
+		req.Header.Set("X-User", user)
+		w := httptest.NewRecorder()
+		engine.ServeHTTP(w, req)
+		return w
+	}
+
+	w := post("jane", `{"text": "hello"}`)
+	assert.Equal(t, http.StatusCreated, w.Code)
+	assert.JSONEq(t, `{"owner": "jane", "number": 1}`, w.Body.String())
+
+	// retries replay the response
+	w = post("jane", `{"text": "hello"}`)
+	assert.Equal(t, http.StatusCreated, w.Code)
+	assert.Equal(t, "true", w.Header().Get(IdempotentReplayedHeader))
+	assert.JSONEq(t, `{"owner": "jane", "number": 1}`, w.Body.String())
+
+	// the key can not be reused for another body
+	w = post("jane", `{"text": "bye"}`)
+	assert.Equal(t, http.StatusUnprocessableEntity, w.Code)
+
+	// other requesters never receive the response of the key
+	w = post("john", `{"text": "hello"}`)
+	assert.Equal(t, http.StatusCreated, w.Code)
+	assert.Empty(t, w.Header().Get(IdempotentReplayedHeader))
+	assert.JSONEq(t, `{"owner": "john", "number": 2}`, w.Body.String())
+}
@@ -14,20 +14,18 @@ import (
 	"github.com/machinable/machinable/auth"
 	"github.com/machinable/machinable/config"
 	"github.com/machinable/machinable/dsi/interfaces"
+	"github.com/machinable/machinable/dsi/models"
 )
 
-// Resources is the constant value for the URL parameter
-var Resources = "api"
-
-// JSONKey is the constant value for the URL parameter
-var JSONKey = "json"
-
 // BEARER is the key for the bearer authorization token
 var BEARER = "bearer"
 
 // APIKEY is the key for the apikey authorization token
 var APIKEY = "apikey"
 
+// Changes is the resource path of the change log, `/api/_changes`
+var Changes = "_changes"
+
 // StoreConfig holds the middleware-relevant config for a collection/resource
 type StoreConfig struct {
 	Create        bool
@@ -46,7 +44,7 @@ func (s *StoreConfig) VerbRequiresAuthn(verb string) (bool, error) {
 		return s.Create, nil
 	case "GET":
 		return s.Read, nil
-	case "PUT":
+	case "PUT", "PATCH":
 		return s.Update, nil
 	case "DELETE":
 		return s.Delete, nil
@@ -88,7 +86,6 @@ func ProjectAuthzBuildFiltersMiddleware(store interfaces.Datastore) gin.HandlerF
 	return func(c *gin.Context) {
 		// get project from context, inserted into context from subdomain
 		verb := c.Request.Method
-		filters := map[string]interface{}{}
 
 		// get store config
 		storei, exists := c.Get("storeConfig")
@@ -98,45 +95,87 @@ func ProjectAuthzBuildFiltersMiddleware(store interfaces.Datastore) gin.HandlerF
 		}
 		storeConfig := storei.(StoreConfig)
 
-		// check verb authentication policy
-		requiresAuthn, err := storeConfig.VerbRequiresAuthn(verb)
+		filters, code, err := buildFilters(storeConfig, verb, c.GetString("authRole"), c.GetString("authID"))
 		if err != nil {
-			respondWithError(http.StatusNotImplemented, "unexpected HTTP verb when checking for authentication", c)
-			return
-		}
-		// if this verb does not require authn, or the user is creating an object (no need for creator filter), let it on by!
-		if !requiresAuthn || verb == "POST" {
-			c.Set("filters", filters)
-			c.Next()
+			respondWithError(code, err.Error(), c)
 			return
 		}
 
-		rRole := c.GetString("authRole")
-		rID := c.GetString("authID")
+		c.Set("filters", filters)
+		c.Next()
+	}
+}
 
-		// based on the requester's role and resource access policies, build filters
-		if rRole == auth.RoleUser {
-			if verb == "GET" && storeConfig.ParallelRead == false {
-				filters["_metadata.creator"] = rID
-			} else if (verb == "PUT" || verb == "DELETE") && storeConfig.ParallelWrite == false {
-				filters["_metadata.creator"] = rID
-			}
+// buildFilters builds the filters of the requester's role for the verb, based on the access policies of the store
+func buildFilters(storeConfig StoreConfig, verb, role, id string) (map[string]interface{}, int, error) {
+	filters := map[string]interface{}{}
 
-			c.Set("filters", filters)
-			c.Next()
-			return
-		} else if rRole == auth.RoleAdmin {
-			// `admin` role:
-			//    no filter needed
-			c.Set("filters", filters)
-			c.Next()
-			return
+	// check verb authentication policy
+	requiresAuthn, err := storeConfig.VerbRequiresAuthn(verb)
+	if err != nil {
+		return nil, http.StatusNotImplemented, errors.New("unexpected HTTP verb when checking for authentication")
+	}
+	// if this verb does not require authn, or the user is creating an object (no need for creator filter), let it on by!
+	if !requiresAuthn || verb == "POST" {
+		return filters, http.StatusOK, nil
+	}
+
+	// based on the requester's role and resource access policies, build filters
+	if role == auth.RoleUser {
+		if verb == "GET" && storeConfig.ParallelRead == false {
+			filters["_metadata.creator"] = id
+		} else if (verb == "PUT" || verb == "PATCH" || verb == "DELETE") && storeConfig.ParallelWrite == false {
+			filters["_metadata.creator"] = id
 		}
+		return filters, http.StatusOK, nil
+	} else if role == auth.RoleAdmin {
+		// `admin` role:
+		//    no filter needed
+		return filters, http.StatusOK, nil
+	}
 
-		// unknown role, cancel request
-		respondWithError(http.StatusForbidden, "unknown role", c)
-		return
+	// unknown role, cancel request
+	return nil, http.StatusForbidden, errors.New("unknown role")
+}
+
+// resourceStoreConfig returns the access policies of the resource definition
+func resourceStoreConfig(def *models.ResourceDefinition) StoreConfig {
+	return StoreConfig{
+		Create:        def.Create,
+		Read:          def.Read,
+		Update:        def.Update,
+		Delete:        def.Delete,
+		ParallelRead:  def.ParallelRead,
+		ParallelWrite: def.ParallelWrite,
+	}
+}
+
+// ResourceReadFilters returns the filters of the requester in the context to read the documents of the resource, as
+// `ProjectUserAuthzMiddleware` and `ProjectAuthzBuildFiltersMiddleware` build them for requests to list the resource.
+// The status code to respond with is returned with the error if the requester cannot read the resource.
+func ResourceReadFilters(c *gin.Context, def *models.ResourceDefinition) (map[string]interface{}, int, error) {
+	return resourceFilters(c, def, "GET")
+}
+
+// ResourceCreateFilters returns the filters of the requester in the context to create a document of the resource, as
+// they are built for POST requests, for writes which create documents through another verb, i.e. PUT upserts. The
+// status code to respond with is returned with the error if the requester cannot create documents of the resource.
+func ResourceCreateFilters(c *gin.Context, def *models.ResourceDefinition) (map[string]interface{}, int, error) {
+	return resourceFilters(c, def, "POST")
+}
+
+// resourceFilters checks the authentication policy of the resource for the verb and builds the filters of the requester
+func resourceFilters(c *gin.Context, def *models.ResourceDefinition, verb string) (map[string]interface{}, int, error) {
+	storeConfig := resourceStoreConfig(def)
+	requiresAuthn, err := storeConfig.VerbRequiresAuthn(verb)
+	if err != nil {
+		return nil, http.StatusNotImplemented, errors.New("unexpected HTTP verb when checking for authentication")
 	}
+	if requiresAuthn && c.GetString("authType") == "anonymous" {
+		return nil, http.StatusUnauthorized, errors.New("access token required")
+	}
+
+	return buildFilters(storeConfig, verb, c.GetString("authRole"), c.GetString("authID"))
 }
 
 // ProjectUserAuthzMiddleware authenticates the JWT and verifies the requesting user has access to this project. This middleware
@@ -161,7 +200,6 @@ func ProjectUserAuthzMiddleware(store interfaces.Datastore, config *config.AppCo
 			return
 		}
 
-		// TODO: query hooks as part of project detail view
 		hooks, lErr := store.ListHooks(project.ID)
 		if lErr != nil {
 			respondWithError(http.StatusNotFound, fmt.Sprintf("error loading project details: %s", lErr.Error()), c)
@@ -172,24 +210,16 @@ func ProjectUserAuthzMiddleware(store interfaces.Datastore, config *config.AppCo
 		c.Set("projectObject", project)
 		c.Set("projectId", project.ID)
 		c.Set("accountRequestLimit", project.Requests)
+		c.Set("accountStorageLimit", project.Storage)
 		c.Set("accountId", project.UserID)
 
-		// load resource access policies
-		params := strings.Split(c.Request.URL.Path, "/")
-
-		if len(params) < 3 {
-			respondWithError(http.StatusBadRequest, "malformed request - invalid params", c)
-			return
-		}
-
-		storeType := params[1]
+		// load the access policies of the resource or root key of the route
+		resourceName := c.Param("resourcePathName")
+		rootKeyStr := c.Param("rootKey")
 		storeConfig := StoreConfig{}
 
 		// check store type, load store and get config for access policies
-		if storeType == Resources {
-			resourceName := params[2]
-			// TODO: Perhaps move this to a view with the project so we only make one DB query?
-			// TODO: put this into the context to be used to validate object later (for PUT and POST)
+		if resourceName != "" {
 			def, err := store.GetDefinitionByPathName(project.ID, resourceName)
 			if err != nil {
 				respondWithError(http.StatusNotFound, "error retrieving resource - does not exist", c)
@@ -197,14 +227,9 @@ func ProjectUserAuthzMiddleware(store interfaces.Datastore, config *config.AppCo
 			}
 			c.Set("entityID", def.ID)
 			c.Set("entityKey", resourceName)
-			storeConfig.Create = def.Create
-			storeConfig.Read = def.Read
-			storeConfig.Update = def.Update
-			storeConfig.Delete = def.Delete
-			storeConfig.ParallelRead = def.ParallelRead
-			storeConfig.ParallelWrite = def.ParallelWrite
-		} else if storeType == JSONKey {
-			rootKeyStr := params[2]
+			c.Set("resourceDefinition", def)
+			storeConfig = resourceStoreConfig(def)
+		} else if rootKeyStr != "" {
 			rootKey, err := store.GetRootKey(project.ID, rootKeyStr)
 			if err != nil {
 				respondWithError(http.StatusNotFound, "error retrieving root key - does not exist", c)
@@ -212,6 +237,7 @@ func ProjectUserAuthzMiddleware(store interfaces.Datastore, config *config.AppCo
 			}
 			c.Set("entityID", rootKey.ID)
 			c.Set("entityKey", rootKeyStr)
+			c.Set("jsonRootKey", rootKey)
 			storeConfig.Create = rootKey.Create
 			storeConfig.Read = rootKey.Read
 			storeConfig.Update = rootKey.Update
@@ -280,7 +306,7 @@ func ProjectUserAuthzMiddleware(store interfaces.Datastore, config *config.AppCo
 						perms["POST"] = true
 						perms["DELETE"] = true
 						perms["PUT"] = true
-						// perms["PATCH"] = true
+						perms["PATCH"] = true
 					}
 
 					if _, ok := perms[verb]; !ok {
@@ -294,6 +320,10 @@ func ProjectUserAuthzMiddleware(store interfaces.Datastore, config *config.AppCo
 					c.Set("authID", user["id"])
 					c.Set("authRole", user["role"])
 
+					if !authorizeJSONRules(c, store) {
+						return
+					}
+
 					c.Next()
 					return
 				}
@@ -320,7 +350,7 @@ func ProjectUserAuthzMiddleware(store interfaces.Datastore, config *config.AppCo
 					perms["POST"] = true
 					perms["DELETE"] = true
 					perms["PUT"] = true
-					// perms["PATCH"] = true
+					perms["PATCH"] = true
 				}
 
 				if _, ok := perms[verb]; !ok {
@@ -334,6 +364,10 @@ func ProjectUserAuthzMiddleware(store interfaces.Datastore, config *config.AppCo
 				c.Set("authID", key.ID)
 				c.Set("authRole", key.Role)
 
+				if !authorizeJSONRules(c, store) {
+					return
+				}
+
 				c.Next()
 				return
 			}
@@ -354,6 +388,10 @@ func ProjectUserAuthzMiddleware(store interfaces.Datastore, config *config.AppCo
 			c.Set("authID", "anonymous")
 			c.Set("authRole", "anonymous")
 
+			if !authorizeJSONRules(c, store) {
+				return
+			}
+
 			// project does not require authentication, carry on
 			c.Next()
 			return
@@ -364,6 +402,114 @@ func ProjectUserAuthzMiddleware(store interfaces.Datastore, config *config.AppCo
 	}
 }
 
+// ProjectRequesterAuthzMiddleware authenticates the requester of a request which can read any resource of the project,
+// i.e. a live query connection or the change log. The access policies of each resource are checked by the handler with
+// `ResourceReadFilters`.
+func ProjectRequesterAuthzMiddleware(store interfaces.Datastore, config *config.AppConfig) gin.HandlerFunc {
+	jwtAuth := auth.NewJWT(config)
+	return func(c *gin.Context) {
+		projectSlug := c.GetString("project")
+		if projectSlug == "" {
+			respondWithError(http.StatusUnauthorized, "invalid project", c)
+			return
+		}
+
+		project, err := store.GetProjectDetailBySlug(projectSlug)
+		if err != nil {
+			respondWithError(http.StatusNotFound, "project not found", c)
+			return
+		}
+
+		c.Set("projectObject", project)
+		c.Set("projectId", project.ID)
+		c.Set("accountRequestLimit", project.Requests)
+		c.Set("accountStorageLimit", project.Storage)
+		c.Set("accountId", project.UserID)
+
+		if !authenticateRequester(c, store, jwtAuth, config, project) {
+			return
+		}
+
+		c.Next()
+	}
+}
+
+// authenticateRequester authenticates the requester of a request which reads more than one resource or root key, whose
+// access policies are checked by the handler. Browsers cannot set headers on WebSocket requests, so the bearer token or
+// API key can also be sent with the `access_token` or `apikey` query parameter. Requests without credentials are
+// anonymous. Returns false if the request was aborted.
+func authenticateRequester(c *gin.Context, store interfaces.Datastore, jwtAuth *auth.JWT, config *config.AppConfig, project *models.ProjectDetail) bool {
+	authorization := c.GetHeader("Authorization")
+	if token := c.Query("access_token"); authorization == "" && token != "" {
+		authorization = BEARER + " " + token
+	} else if key := c.Query("apikey"); authorization == "" && key != "" {
+		authorization = APIKEY + " " + key
+	}
+
+	if authorization == "" {
+		c.Set("authType", "anonymous")
+		c.Set("authString", "anonymous")
+		c.Set("authID", "anonymous")
+		c.Set("authRole", "anonymous")
+		return true
+	}
+
+	requester, code, err := authenticate(authorization, store, jwtAuth, config, project)
+	if err != nil {
+		respondWithError(code, err.Error(), c)
+		return false
+	}
+
+	verb := c.Request.Method
+	if !requester.allows(verb) {
+		respondWithError(http.StatusUnauthorized, fmt.Sprintf("user does not have permission to '%s'", verb), c)
+		return false
+	}
+
+	requester.set(c)
+	return true
+}
+
+// DryRun returns true if the request only validates a write, either with the `dry_run=true` query parameter or through
+// a route of `DryRunMiddleware`. Dry runs do not save anything, trigger events, or count towards the request limit.
+func DryRun(c *gin.Context) bool {
+	if c.Request.Method != "POST" && c.Request.Method != "PUT" {
+		return false
+	}
+	return c.Query("dry_run") == "true" || c.GetBool("dryRun")
+}
+
+// DryRunMiddleware marks the requests of a validation route, i.e. `_validate`, as dry runs. It must run before the
+// middleware which checks `DryRun`.
+func DryRunMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Set("dryRun", true)
+		c.Next()
+	}
+}
+
+// ChangesRequest returns true if the request reads the change log, which shares the route of the documents of a
+// resource as the router does not allow a static segment in the position of the resource
+func ChangesRequest(c *gin.Context) bool {
+	return c.Request.Method == "GET" && c.Param("resourcePathName") == Changes && c.Param("resourceID") == ""
+}
+
+// Branch runs the `matched` middleware for the requests of the condition, and the `otherwise` middleware for any other
+// request. A nil middleware continues the handler chain.
+func Branch(condition func(*gin.Context) bool, matched, otherwise gin.HandlerFunc) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		next := otherwise
+		if condition(c) {
+			next = matched
+		}
+		if next == nil {
+			c.Next()
+			return
+		}
+		next(c)
+	}
+}
+
 // RequestRateLimit checks the account rate limit and returns 429 if over app tier limit
 func RequestRateLimit(store interfaces.Datastore, cache redis.UniversalClient) gin.HandlerFunc {
 	return func(c *gin.Context) {
@@ -388,6 +534,12 @@ func RequestRateLimit(store interfaces.Datastore, cache redis.UniversalClient) g
 			return
 		}
 
+		// dry runs are limited, but not counted
+		if DryRun(c) {
+			c.Next()
+			return
+		}
+
 		// increment and set request count in redis
 		val++
 		// expire key after 1 hour
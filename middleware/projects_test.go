@@ -0,0 +1,102 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/machinable/machinable/auth"
+	"github.com/machinable/machinable/dsi/models"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestResourceCreateFilters(t *testing.T) {
+	// creating requires authentication, updating does not
+	def := &models.ResourceDefinition{Create: true, Update: false}
+
+	c := &gin.Context{}
+	c.Set("authType", "anonymous")
+	c.Set("authRole", "anonymous")
+	_, code, err := ResourceCreateFilters(c, def)
+	assert.NotNil(t, err)
+	assert.Equal(t, http.StatusUnauthorized, code)
+
+	c = &gin.Context{}
+	c.Set("authType", "user")
+	c.Set("authRole", auth.RoleUser)
+	c.Set("authID", "jane")
+	filters, _, err := ResourceCreateFilters(c, def)
+	assert.Nil(t, err)
+	assert.Empty(t, filters)
+
+	def.Create = false
+	c = &gin.Context{}
+	c.Set("authType", "anonymous")
+	c.Set("authRole", "anonymous")
+	_, _, err = ResourceCreateFilters(c, def)
+	assert.Nil(t, err)
+}
+
+func TestDryRun(t *testing.T) {
+	gin.SetMode(gin.ReleaseMode)
+	engine := gin.New()
+	dryRuns := map[string]bool{}
+	record := func(c *gin.Context) { dryRuns[c.Request.Method+" "+c.Request.URL.String()] = DryRun(c) }
+	engine.POST("/api/:resourcePathName/_validate", DryRunMiddleware(), record)
+	engine.POST("/api/:resourcePathName", record)
+	engine.PUT("/api/:resourcePathName/:resourceID", record)
+
+	for _, request := range []string{
+		"POST /api/dogs/_validate",
+		"POST /api/dogs",
+		"POST /api/dogs?dry_run=true",
+		"PUT /api/dogs/_validate",
+		"PUT /api/dogs/rex?dry_run=true",
+	} {
+		parts := strings.SplitN(request, " ", 2)
+		req, _ := http.NewRequest(parts[0], parts[1], nil)
+		engine.ServeHTTP(httptest.NewRecorder(), req)
+	}
+
+	assert.Equal(t, map[string]bool{
+		"POST /api/dogs/_validate":       true,
+		"POST /api/dogs":                 false,
+		"POST /api/dogs?dry_run=true":    true,
+		"PUT /api/dogs/_validate":        false, // a document with the ID `_validate`
+		"PUT /api/dogs/rex?dry_run=true": true,
+	}, dryRuns)
+}
+
+func TestBranchChangesRequest(t *testing.T) {
+	gin.SetMode(gin.ReleaseMode)
+	engine := gin.New()
+	branches := map[string]string{}
+	mark := func(name string) gin.HandlerFunc {
+		return func(c *gin.Context) {
+			c.Set("branch", c.GetString("branch")+name)
+			c.Next()
+		}
+	}
+	record := func(c *gin.Context) { branches[c.Request.Method+" "+c.Request.URL.Path] = c.GetString("branch") }
+	api := engine.Group("/api")
+	api.Use(Branch(ChangesRequest, mark("changes"), mark("documents")))
+	api.Use(Branch(ChangesRequest, nil, mark("+filters")))
+	api.GET("/:resourcePathName", record)
+	api.POST("/:resourcePathName", record)
+	api.GET("/:resourcePathName/:resourceID", record)
+
+	for _, request := range []string{"GET /api/_changes", "GET /api/dogs", "POST /api/_changes", "GET /api/dogs/_changes"} {
+		parts := strings.SplitN(request, " ", 2)
+		req, _ := http.NewRequest(parts[0], parts[1], nil)
+		engine.ServeHTTP(httptest.NewRecorder(), req)
+	}
+
+	assert.Equal(t, map[string]string{
+		"GET /api/_changes":      "changes",
+		"GET /api/dogs":          "documents+filters",
+		"POST /api/_changes":     "documents+filters",
+		"GET /api/dogs/_changes": "documents+filters",
+	}, branches)
+}
@@ -0,0 +1,123 @@
+package middleware
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+
+	jwt "github.com/dgrijalva/jwt-go"
+	"github.com/gin-gonic/gin"
+	"github.com/machinable/machinable/auth"
+	"github.com/machinable/machinable/config"
+	"github.com/machinable/machinable/dsi/interfaces"
+	"github.com/machinable/machinable/dsi/models"
+)
+
+// requester is the project user or API key which authenticated a request
+type requester struct {
+	authType string
+	name     interface{}
+	id       interface{}
+	role     interface{}
+	read     bool
+	write    bool
+}
+
+// allows returns true if the requester has permission for the HTTP verb
+func (r *requester) allows(verb string) bool {
+	switch verb {
+	case "GET":
+		return r.read
+	case "POST", "DELETE", "PUT", "PATCH":
+		return r.write
+	default:
+		return false
+	}
+}
+
+// set injects the requester into the context
+func (r *requester) set(c *gin.Context) {
+	c.Set("authType", r.authType)
+	c.Set("authString", r.name)
+	c.Set("authID", r.id)
+	c.Set("authRole", r.role)
+}
+
+// authenticate authenticates the bearer token or API key of an `Authorization` value for the project, for the requests
+// of `ProjectRequesterAuthzMiddleware`. The status code to respond with is returned with the error if the credentials
+// are invalid.
+func authenticate(authorization string, store interfaces.Datastore, jwtAuth *auth.JWT, config *config.AppConfig, project *models.ProjectDetail) (*requester, int, error) {
+	vals := strings.Split(authorization, " ")
+
+	authType := strings.ToLower(vals[0])
+
+	if authType == BEARER && len(vals) > 1 {
+		token, err := jwt.Parse(vals[1], jwtAuth.TokenLookup)
+		if err != nil {
+			return nil, http.StatusUnauthorized, errors.New("invalid access token")
+		}
+
+		// token is valid, get claims and perform authorization
+		claims := token.Claims.(jwt.MapClaims)
+
+		projects, ok := claims["projects"].(map[string]interface{})
+		if !ok {
+			return nil, http.StatusUnauthorized, errors.New("improperly formatted access token")
+		}
+
+		_, ok = projects[project.Slug]
+		if !ok {
+			// project user does not have access to this project
+			return nil, http.StatusNotFound, errors.New("project not found")
+		}
+
+		user, ok := claims["user"].(map[string]interface{})
+		if !ok {
+			return nil, http.StatusUnauthorized, errors.New("improperly formatted access token")
+		}
+
+		userType, ok := user["type"].(string)
+		if !ok || userType != "project" {
+			return nil, http.StatusUnauthorized, errors.New("invalid access token")
+		}
+
+		userIsActive, ok := user["active"].(bool)
+		if !ok || !userIsActive {
+			return nil, http.StatusUnauthorized, errors.New("user is not active, please confirm your account")
+		}
+
+		read, _ := user["read"].(bool)
+		write, _ := user["write"].(bool)
+
+		return &requester{
+			authType: "user",
+			name:     user["name"],
+			id:       user["id"],
+			role:     user["role"],
+			read:     read,
+			write:    write,
+		}, http.StatusOK, nil
+	} else if authType == APIKEY {
+		// authenticate api key
+		if len(vals) < 2 {
+			return nil, http.StatusNotFound, errors.New("invalid key")
+		}
+		hashedKey := auth.SHA1(vals[1], config.AppSecret)
+
+		key, err := store.GetAPIKeyByKey(project.ID, hashedKey)
+		if err != nil {
+			return nil, http.StatusNotFound, errors.New("invalid key")
+		}
+
+		return &requester{
+			authType: "apikey",
+			name:     key.Description,
+			id:       key.ID,
+			role:     key.Role,
+			read:     key.Read,
+			write:    key.Write,
+		}, http.StatusOK, nil
+	}
+
+	return nil, http.StatusUnauthorized, errors.New("invalid access token")
+}
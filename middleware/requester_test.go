@@ -0,0 +1,84 @@
+package middleware
+
+import (
+	"errors"
+	"net/http"
+	"testing"
+
+	jwt "github.com/dgrijalva/jwt-go"
+	"github.com/machinable/machinable/auth"
+	"github.com/machinable/machinable/config"
+	"github.com/machinable/machinable/dsi/interfaces"
+	"github.com/machinable/machinable/dsi/models"
+	"github.com/stretchr/testify/assert"
+)
+
+// apiKeyStore finds the API keys of a project by their hash
+type apiKeyStore struct {
+	interfaces.Datastore
+	keys map[string]*models.ProjectAPIKey
+}
+
+func (s *apiKeyStore) GetAPIKeyByKey(projectID, hash string) (*models.ProjectAPIKey, error) {
+	if key, ok := s.keys[hash]; ok && key.ProjectID == projectID {
+		return key, nil
+	}
+	return nil, errors.New("not found")
+}
+
+func TestAuthenticate(t *testing.T) {
+	cfg := &config.AppConfig{AppSecret: "secret"}
+	jwtAuth := auth.NewJWT(cfg)
+	project := &models.ProjectDetail{ID: "project", Slug: "pets"}
+	store := &apiKeyStore{keys: map[string]*models.ProjectAPIKey{
+		auth.SHA1("reader", cfg.AppSecret): {ID: "key", ProjectID: "project", Description: "reader", Read: true, Role: auth.RoleUser},
+	}}
+
+	// API keys
+	r, _, err := authenticate("apikey reader", store, jwtAuth, cfg, project)
+	if assert.Nil(t, err) {
+		assert.Equal(t, "apikey", r.authType)
+		assert.Equal(t, "key", r.id)
+		assert.True(t, r.allows("GET"))
+		assert.False(t, r.allows("POST"))
+	}
+
+	_, code, err := authenticate("apikey unknown", store, jwtAuth, cfg, project)
+	assert.NotNil(t, err)
+	assert.Equal(t, http.StatusNotFound, code)
+
+	_, code, err = authenticate("apikey", store, jwtAuth, cfg, project)
+	assert.NotNil(t, err)
+	assert.Equal(t, http.StatusNotFound, code)
+
+	// access tokens of project users
+	user := map[string]interface{}{"id": "jane", "name": "jane", "role": auth.RoleUser, "type": "project", "active": true, "read": true, "write": true}
+	token, _ := jwtAuth.CreateAccessToken(jwt.MapClaims{"projects": map[string]interface{}{"pets": true}, "user": user})
+	r, _, err = authenticate("Bearer "+token, store, jwtAuth, cfg, project)
+	if assert.Nil(t, err) {
+		assert.Equal(t, "user", r.authType)
+		assert.Equal(t, "jane", r.id)
+		assert.True(t, r.allows("POST"))
+	}
+
+	// users of other projects
+	token, _ = jwtAuth.CreateAccessToken(jwt.MapClaims{"projects": map[string]interface{}{"cats": true}, "user": user})
+	_, code, err = authenticate("bearer "+token, store, jwtAuth, cfg, project)
+	assert.NotNil(t, err)
+	assert.Equal(t, http.StatusNotFound, code)
+
+	// inactive users
+	user["active"] = false
+	token, _ = jwtAuth.CreateAccessToken(jwt.MapClaims{"projects": map[string]interface{}{"pets": true}, "user": user})
+	_, code, err = authenticate("bearer "+token, store, jwtAuth, cfg, project)
+	assert.NotNil(t, err)
+	assert.Equal(t, http.StatusUnauthorized, code)
+
+	// tokens signed with another secret, and unknown schemes
+	token, _ = auth.NewJWT(&config.AppConfig{AppSecret: "other"}).CreateAccessToken(jwt.MapClaims{"projects": map[string]interface{}{"pets": true}, "user": user})
+	for _, authorization := range []string{"bearer " + token, "bearer", "basic abc"} {
+		_, code, err = authenticate(authorization, store, jwtAuth, cfg, project)
+		assert.NotNil(t, err, authorization)
+		assert.Equal(t, http.StatusUnauthorized, code, authorization)
+	}
+}
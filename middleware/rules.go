@@ -0,0 +1,115 @@
+package middleware
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/machinable/machinable/dsi/interfaces"
+	"github.com/machinable/machinable/dsi/models"
+	"github.com/machinable/machinable/rules"
+)
+
+// authorizeJSONRules evaluates the rules of the requested root key, responding with 403 if they deny access. Root keys
+// without rules, and requests which are not JSON tree requests, are allowed.
+func authorizeJSONRules(c *gin.Context, store interfaces.Datastore) bool {
+	value, ok := c.Get("jsonRootKey")
+	if !ok {
+		return true
+	}
+	rootKey := value.(*models.RootKey)
+	if len(rootKey.Rules) == 0 {
+		return true
+	}
+
+	keys, err := models.ParseJSONPointer(strings.TrimRight(c.Param("keys"), "/"))
+	if err != nil {
+		// invalid paths are rejected by the handlers
+		return true
+	}
+
+	method := c.Request.Method
+	req := &rules.Request{
+		Write: method != "GET",
+		Keys:  keys,
+		Auth:  rulesAuth(c),
+	}
+	req.Root = rootLoader(store, rootKey)
+	if req.Write {
+		body, err := c.GetRawData()
+		if err != nil {
+			respondWithError(http.StatusBadRequest, "error reading request body", c)
+			return false
+		}
+		// restore the body for the handlers
+		c.Request.Body = ioutil.NopCloser(bytes.NewBuffer(body))
+
+		req.NewRoot = func() (interface{}, error) {
+			root, err := req.Root()
+			if err != nil {
+				return nil, err
+			}
+			return rules.NewRoot(root, method, keys, body)
+		}
+	}
+
+	if allowed, _ := rules.Check(rootKey.Rules, req); !allowed {
+		respondWithError(http.StatusForbidden, "permission denied", c)
+		return false
+	}
+	return true
+}
+
+// JSONReadAllowed returns true if the requester in the context can read the whole tree of the root key, by its access
+// policy and rules. It is used by requests which read more than one root key.
+func JSONReadAllowed(c *gin.Context, store interfaces.Datastore, rootKey *models.RootKey) bool {
+	if rootKey.Read && c.GetString("authType") == "anonymous" {
+		return false
+	}
+	if len(rootKey.Rules) == 0 {
+		return true
+	}
+
+	allowed, _ := rules.Check(rootKey.Rules, &rules.Request{
+		Keys: []string{},
+		Auth: rulesAuth(c),
+		Root: rootLoader(store, rootKey),
+	})
+	return allowed
+}
+
+// rootLoader returns a function which reads and decodes the tree of the root key once, when the rules first need it
+func rootLoader(store interfaces.Datastore, rootKey *models.RootKey) func() (interface{}, error) {
+	var root interface{}
+	var rootErr error
+	rootLoaded := false
+	return func() (interface{}, error) {
+		if !rootLoaded {
+			rootLoaded = true
+			var tree []byte
+			if tree, rootErr = store.GetJSONKey(rootKey.ProjectID, rootKey.Key); rootErr == nil {
+				rootErr = json.Unmarshal(tree, &root)
+			}
+		}
+		return root, rootErr
+	}
+}
+
+// rulesAuth returns the `auth` variable of the rules for the authenticated requester, nil if anonymous
+func rulesAuth(c *gin.Context) map[string]interface{} {
+	authType := c.GetString("authType")
+	if authType == "" || authType == "anonymous" {
+		return nil
+	}
+
+	authID, _ := c.Get("authID")
+	authRole, _ := c.Get("authRole")
+	return map[string]interface{}{
+		"id":   authID,
+		"role": authRole,
+		"type": authType,
+	}
+}
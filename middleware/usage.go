@@ -2,6 +2,7 @@ package middleware
 
 import (
 	"bytes"
+	"encoding/json"
 	"log"
 	"net/http"
 	"time"
@@ -34,10 +35,6 @@ func ResourceStatsMiddleware(store interfaces.Datastore, emitter *events.Process
 
 func loggingMiddleware(store interfaces.Datastore, emitter *events.Processor, endpointType string) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		// inject custom writer
-		lw := &logWriter{body: bytes.NewBufferString(""), ResponseWriter: c.Writer}
-		c.Writer = lw
-
 		// response time
 		requestStart := time.Now()
 		// get aligned time by 5 minute interval
@@ -79,10 +76,17 @@ func loggingMiddleware(store interfaces.Datastore, emitter *events.Processor, en
 			InitiatorID:    authID,
 		}
 
-		// hooks are disabled with this request header set to false
+		// hooks are disabled with this request header set to false, the change is still streamed
 		xTriggerHooks := c.Request.Header.Get("X-Trigger-Hooks")
 
-		if verb != "GET" && (statusCode == 200 || statusCode == 201) && xTriggerHooks != "false" {
+		// replayed responses have already triggered their events, and dry runs have not changed anything
+		replayed := c.GetBool("idempotentReplay")
+
+		// responses without content only trigger events if the handler sets the action, i.e. deleting a document but
+		// not one of its files
+		success := statusCode == 200 || statusCode == 201 || (statusCode == 204 && c.GetString("eventAction") != "")
+
+		if verb != "GET" && success && !replayed && !DryRun(c) {
 			projecti, exists := c.Get("projectObject")
 			if !exists {
 				respondWithError(http.StatusBadRequest, "malformed request - invalid project", c)
@@ -91,26 +95,42 @@ func loggingMiddleware(store interfaces.Datastore, emitter *events.Processor, en
 			projectObj := projecti.(*models.ProjectDetail)
 
 			action := "create"
-			if verb == "PUT" {
+			if verb == "PUT" || verb == "PATCH" {
 				action = "edit"
 			} else if verb == "DELETE" {
 				action = "delete"
 			}
+			// handlers can override the action, i.e. a PUT which creates the document
+			if a := c.GetString("eventAction"); a != "" {
+				action = a
+			}
 
 			// push event for webhook/websocket processing (async)
 			go emitter.PushEvent(
 				&events.Event{
-					Project:   projectObj,
-					Entity:    endpointType,
-					EntityKey: c.GetString("entityKey"),
-					EntityID:  c.GetString("entityID"),
-					Action:    action,
-					Keys:      c.GetStringSlice("jsonKeys"), // if exists
-					Payload:   lw.body.Bytes(),
+					Project:    projectObj,
+					Entity:     endpointType,
+					EntityKey:  c.GetString("entityKey"),
+					EntityID:   c.GetString("entityID"),
+					Action:     action,
+					Keys:       c.GetStringSlice("jsonKeys"), // if exists
+					Data:       eventValue(c, "eventData"),
+					Previous:   eventValue(c, "eventPrevious"),
+					DocumentID: c.Param("resourceID"),
+					Creator:    c.GetString("eventCreator"), // if the data does not include the document
+					AuthType:   authType,
+					AuthID:     authID,
+					OccurredAt: time.Now(),
+					SkipHooks:  xTriggerHooks == "false",
 				},
 			)
 		}
 
+		// dry runs are not requests of the resource
+		if DryRun(c) {
+			return
+		}
+
 		// save in go routine, do not block request
 		go func(projectID string, plog *models.Log) {
 			// save the log
@@ -125,6 +145,38 @@ func loggingMiddleware(store interfaces.Datastore, emitter *events.Processor, en
 	}
 }
 
+// SetEventData keeps the value the request wrote, as the datastore returned it, for the event of the request
+func SetEventData(c *gin.Context, value interface{}) {
+	if b, err := json.Marshal(value); err == nil {
+		c.Set("eventData", b)
+	}
+}
+
+// SetEventPrevious keeps the value the request writes, as it was before the write, for the event of the request. The
+// value is only loaded if a hook of the project is subscribed to the event, and hooks are not disabled for the request.
+func SetEventPrevious(c *gin.Context, entity, action string, load func() ([]byte, error)) {
+	projecti, exists := c.Get("projectObject")
+	if !exists || c.Request.Header.Get("X-Trigger-Hooks") == "false" {
+		return
+	}
+
+	project := projecti.(*models.ProjectDetail)
+	if !events.NeedsPrevious(project, action, entity, c.GetString("entityID"), c.GetStringSlice("jsonKeys")) {
+		return
+	}
+
+	if b, err := load(); err == nil {
+		c.Set("eventPrevious", b)
+	}
+}
+
+// eventValue returns the value kept by `SetEventData` or `SetEventPrevious`, if any
+func eventValue(c *gin.Context, key string) []byte {
+	v, _ := c.Get(key)
+	b, _ := v.([]byte)
+	return b
+}
+
 // AlignTime returns the aligned `time.Time` based on the `unaligned` parameter and the `interval` to align with (in minutes)
 func AlignTime(unaligned time.Time, interval int) time.Time {
 	timeToAlign := unaligned.Truncate(time.Minute)
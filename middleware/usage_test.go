@@ -0,0 +1,51 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/machinable/machinable/dsi/interfaces"
+	"github.com/machinable/machinable/dsi/models"
+	"github.com/stretchr/testify/assert"
+)
+
+// logStore records the project logs saved by the logging middleware
+type logStore struct {
+	interfaces.Datastore
+	logs chan *models.Log
+}
+
+func (s *logStore) AddProjectLog(projectID string, log *models.Log) error {
+	s.logs <- log
+	return nil
+}
+
+func TestResourceStatsMiddlewareDryRun(t *testing.T) {
+	gin.SetMode(gin.ReleaseMode)
+	store := &logStore{logs: make(chan *models.Log, 2)}
+	engine := gin.New()
+	invalid := func(c *gin.Context) { c.JSON(http.StatusBadRequest, gin.H{"valid": false}) }
+	engine.POST("/api/:resourcePathName/_validate", DryRunMiddleware(), ResourceStatsMiddleware(store, nil), invalid)
+	engine.POST("/api/:resourcePathName", ResourceStatsMiddleware(store, nil), invalid)
+
+	for _, path := range []string{"/api/dogs/_validate", "/api/dogs?dry_run=true", "/api/dogs"} {
+		req, _ := http.NewRequest(http.MethodPost, path, nil)
+		engine.ServeHTTP(httptest.NewRecorder(), req)
+	}
+
+	// only the request which is not a dry run is logged
+	select {
+	case log := <-store.logs:
+		assert.Equal(t, "/api/dogs", log.Path)
+	case <-time.After(time.Second):
+		t.Fatal("the request was not logged")
+	}
+	select {
+	case log := <-store.logs:
+		t.Fatalf("dry run %s was logged", log.Path)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
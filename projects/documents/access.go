@@ -0,0 +1,59 @@
+package documents
+
+import (
+	"errors"
+
+	"github.com/gin-gonic/gin"
+	dsiErrors "github.com/machinable/machinable/dsi/errors"
+	"github.com/machinable/machinable/dsi/models"
+)
+
+// definition returns the resource definition loaded by the project authz middleware, or retrieves it from the
+// datastore for routes which do not load it (mgmt)
+func (h *Documents) definition(c *gin.Context, projectID, resourcePathName string) (*models.ResourceDefinition, error) {
+	if defi, ok := c.Get("resourceDefinition"); ok {
+		return defi.(*models.ResourceDefinition), nil
+	}
+
+	def, err := h.store.GetDefinitionByPathName(projectID, resourcePathName)
+	if err != nil {
+		return nil, errors.New("could not retrieve resource definition")
+	}
+
+	return def, nil
+}
+
+// fieldAccess returns the field permissions of the resource along with the requester's role. App users managing the
+// project have access to every field, so nil permissions are returned for them.
+func (h *Documents) fieldAccess(c *gin.Context, projectID, resourcePathName string) (models.FieldPermissions, string, error) {
+	// app users are set with the `admin` auth type by the mgmt middleware
+	if c.GetString("authType") == "admin" {
+		return nil, "", nil
+	}
+
+	def, err := h.definition(c, projectID, resourcePathName)
+	if err != nil {
+		return nil, "", err
+	}
+
+	permissions, err := def.GetFieldPermissions()
+	if err != nil {
+		return nil, "", errors.New("error getting schema field permissions")
+	}
+
+	return permissions, c.GetString("authRole"), nil
+}
+
+// writeSaveError responds with the error envelope of a failed document write. The envelope is always of the form:
+//
+//	{
+//	  "error": "failed to save {resource}",
+//	  "errors": [{"path": "/age", "keyword": "maximum", "expected": 20, "actual": 25, "message": "..."}]
+//	}
+func writeSaveError(c *gin.Context, code int, resourcePathName string, err error) {
+	if dsiErr, ok := err.(*dsiErrors.DatastoreError); ok {
+		err = dsiErr.Unwrap()
+	}
+
+	c.JSON(code, gin.H{"error": "failed to save " + resourcePathName, "errors": models.AsValidationErrors(err)})
+}
@@ -0,0 +1,168 @@
+package documents
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/machinable/machinable/dsi/models"
+	"github.com/machinable/machinable/middleware"
+	"github.com/machinable/machinable/query"
+)
+
+// ListChanges returns the changes of the change log after the `since` sequence number, in order, for incremental sync.
+// The `resources` and `json` query parameters select resources and root keys by name, otherwise every resource and
+// root key the requester can read is included. Deletes are returned as tombstones, without data. Clients which have
+// not synced since before the compacted tombstones receive 410, and should sync from 0.
+func (h *Documents) ListChanges(c *gin.Context) {
+	projectID := c.MustGet("projectId").(string)
+	values := c.Request.URL.Query()
+
+	since := int64(0)
+	if s := values.Get("since"); s != "" {
+		var err error
+		if since, err = strconv.ParseInt(s, 10, 64); err != nil || since < 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid since"})
+			return
+		}
+	}
+
+	limit, err := query.GetLimit(&values)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	horizon, err := h.store.GetChangeHorizon(projectID)
+	if err != nil {
+		tErr := h.store.TranslateError(err)
+		c.JSON(tErr.Code, gin.H{"error": tErr.Error()})
+		return
+	}
+	if since > 0 && since < horizon {
+		c.JSON(http.StatusGone, gin.H{"error": fmt.Sprintf("changes before %d have been compacted, sync from 0", horizon)})
+		return
+	}
+
+	scopes, permissions, code, err := h.changeScopes(c, projectID, values)
+	if err != nil {
+		c.JSON(code, gin.H{"error": err.Error()})
+		return
+	}
+
+	changes, err := h.store.ListChanges(projectID, since, limit, scopes)
+	if err != nil {
+		tErr := h.store.TranslateError(err)
+		c.JSON(tErr.Code, gin.H{"error": tErr.Error()})
+		return
+	}
+
+	role := c.GetString("authRole")
+	for _, change := range changes {
+		fieldPermissions := permissions[change.EntityKey]
+		if change.Entity != models.EndpointResource || len(fieldPermissions) == 0 || len(change.Data) == 0 {
+			continue
+		}
+
+		doc := map[string]interface{}{}
+		if err := json.Unmarshal(change.Data, &doc); err == nil {
+			fieldPermissions.Strip(doc, role)
+			change.Data, _ = json.Marshal(doc)
+		}
+	}
+
+	last := since
+	if len(changes) > 0 {
+		last = changes[len(changes)-1].Seq
+	}
+
+	c.JSON(http.StatusOK, gin.H{"items": changes, "last": last, "more": int64(len(changes)) == limit})
+}
+
+// changeScopes returns the scopes of the change log read by the requester, with the field permissions of each resource.
+// Resources and root keys named in the query must be readable, otherwise the ones which are not are left out.
+func (h *Documents) changeScopes(c *gin.Context, projectID string, values url.Values) ([]*models.ChangeScope, map[string]models.FieldPermissions, int, error) {
+	resources := splitList(values.Get("resources"))
+	rootKeys := splitList(values.Get("json"))
+	named := len(resources) > 0 || len(rootKeys) > 0
+
+	defs := []*models.ResourceDefinition{}
+	roots := []*models.RootKey{}
+	if named {
+		for _, resource := range resources {
+			def, err := h.store.GetDefinitionByPathName(projectID, resource)
+			if err != nil {
+				return nil, nil, http.StatusNotFound, fmt.Errorf("resource '%s' does not exist", resource)
+			}
+			defs = append(defs, def)
+		}
+		for _, key := range rootKeys {
+			root, err := h.store.GetRootKey(projectID, key)
+			if err != nil {
+				return nil, nil, http.StatusNotFound, fmt.Errorf("root key '%s' does not exist", key)
+			}
+			roots = append(roots, root)
+		}
+	} else {
+		list, dsiErr := h.store.ListDefinitions(projectID)
+		if dsiErr != nil {
+			return nil, nil, http.StatusInternalServerError, errors.New("could not retrieve resource definitions")
+		}
+		defs = list
+
+		var err error
+		if roots, err = h.store.ListRootKeys(projectID); err != nil {
+			return nil, nil, http.StatusInternalServerError, errors.New("could not retrieve root keys")
+		}
+	}
+
+	scopes := []*models.ChangeScope{}
+	permissions := map[string]models.FieldPermissions{}
+	for _, def := range defs {
+		filters, code, err := middleware.ResourceReadFilters(c, def)
+		if err != nil {
+			if named {
+				return nil, nil, code, err
+			}
+			continue
+		}
+
+		fieldPermissions, err := def.GetFieldPermissions()
+		if err != nil {
+			return nil, nil, http.StatusInternalServerError, errors.New("error getting schema field permissions")
+		}
+		permissions[def.PathName] = fieldPermissions
+
+		creator, _ := filters["_metadata.creator"].(string)
+		scopes = append(scopes, &models.ChangeScope{Entity: models.EndpointResource, EntityKey: def.PathName, Creator: creator})
+	}
+
+	for _, root := range roots {
+		if !middleware.JSONReadAllowed(c, h.store, root) {
+			if named {
+				return nil, nil, http.StatusForbidden, errors.New("permission denied")
+			}
+			continue
+		}
+
+		scopes = append(scopes, &models.ChangeScope{Entity: models.EndpointJSON, EntityKey: root.Key})
+	}
+
+	return scopes, permissions, http.StatusOK, nil
+}
+
+// splitList splits a comma separated query parameter, ignoring empty values
+func splitList(value string) []string {
+	list := []string{}
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			list = append(list, item)
+		}
+	}
+	return list
+}
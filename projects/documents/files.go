@@ -0,0 +1,281 @@
+package documents
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"mime/multipart"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/machinable/machinable/dsi/models"
+	"github.com/machinable/machinable/middleware"
+	"github.com/machinable/machinable/storage"
+	uuid "github.com/satori/go.uuid"
+)
+
+// fileFormField is the multipart form field of uploaded files
+const fileFormField = "file"
+
+// bytesPerMegabyte is used to convert the tier storage limit
+const bytesPerMegabyte = 1024 * 1024
+
+// fileField verifies the field is a `file` property of the resource schema
+func (h *Documents) fileField(c *gin.Context, projectID, resourcePathName, field string) error {
+	def, err := h.definition(c, projectID, resourcePathName)
+	if err != nil {
+		return err
+	}
+
+	fields, err := def.GetFileFields()
+	if err != nil {
+		return fmt.Errorf("error getting schema file properties")
+	}
+	if !fields[field] {
+		return fmt.Errorf("'%s' is not a file property", field)
+	}
+
+	return nil
+}
+
+// ListFiles returns the files attached to a document
+func (h *Documents) ListFiles(c *gin.Context) {
+	resourcePathName := c.Param("resourcePathName")
+	resourceID := c.Param("resourceID")
+	projectID := c.MustGet("projectId").(string)
+	authFilters := c.MustGet("filters").(map[string]interface{})
+
+	permissions, role, err := h.fieldAccess(c, projectID, resourcePathName)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	// files share the access of their document
+	if _, dsiErr := h.store.GetDefDocument(projectID, resourcePathName, resourceID, authFilters); dsiErr != nil {
+		c.JSON(dsiErr.Code(), gin.H{"error": dsiErr.Error()})
+		return
+	}
+
+	files, dsiErr := h.store.ListDefDocumentFiles(projectID, resourcePathName, resourceID)
+	if dsiErr != nil {
+		c.JSON(dsiErr.Code(), gin.H{"error": dsiErr.Error()})
+		return
+	}
+
+	readable := make([]*models.File, 0, len(files))
+	for _, file := range files {
+		if permissions.CanRead(file.Field, role) {
+			readable = append(readable, file)
+		}
+	}
+
+	c.JSON(http.StatusOK, gin.H{"items": readable})
+}
+
+// GetFile downloads the file of a document field
+func (h *Documents) GetFile(c *gin.Context) {
+	resourcePathName := c.Param("resourcePathName")
+	resourceID := c.Param("resourceID")
+	field := c.Param("field")
+	projectID := c.MustGet("projectId").(string)
+	authFilters := c.MustGet("filters").(map[string]interface{})
+
+	permissions, role, err := h.fieldAccess(c, projectID, resourcePathName)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if !permissions.CanRead(field, role) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "file not found"})
+		return
+	}
+
+	// files share the access of their document
+	if _, dsiErr := h.store.GetDefDocument(projectID, resourcePathName, resourceID, authFilters); dsiErr != nil {
+		c.JSON(dsiErr.Code(), gin.H{"error": dsiErr.Error()})
+		return
+	}
+
+	file, dsiErr := h.store.GetDefDocumentFile(projectID, resourcePathName, resourceID, field)
+	if dsiErr != nil {
+		c.JSON(dsiErr.Code(), gin.H{"error": dsiErr.Error()})
+		return
+	}
+
+	reader, err := h.files.Get(file.StorageKey())
+	if err == storage.ErrNotFound {
+		c.JSON(http.StatusNotFound, gin.H{"error": "file not found"})
+		return
+	} else if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "error reading file"})
+		return
+	}
+	defer reader.Close()
+
+	c.DataFromReader(http.StatusOK, file.Size, file.ContentType, reader, map[string]string{
+		"Content-Disposition": fmt.Sprintf("attachment; filename=%q", file.Name),
+	})
+}
+
+// PutFile uploads the file of a document field, replacing the current file of the field
+func (h *Documents) PutFile(c *gin.Context) {
+	resourcePathName := c.Param("resourcePathName")
+	resourceID := c.Param("resourceID")
+	field := c.Param("field")
+	projectID := c.MustGet("projectId").(string)
+	authFilters := c.MustGet("filters").(map[string]interface{})
+
+	if err := h.fileField(c, projectID, resourcePathName, field); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	header, err := c.FormFile(fileFormField)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("multipart form field '%s' is required", fileFormField)})
+		return
+	}
+
+	document, dsiErr := h.store.GetDefDocument(projectID, resourcePathName, resourceID, authFilters)
+	if dsiErr != nil {
+		c.JSON(dsiErr.Code(), gin.H{"error": dsiErr.Error()})
+		return
+	}
+
+	permissions, role, err := h.fieldAccess(c, projectID, resourcePathName)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if !permissions.CanWrite(field, role, document) {
+		c.JSON(http.StatusForbidden, gin.H{"error": fmt.Sprintf("'%s' cannot be changed", field)})
+		return
+	}
+
+	// the replaced file no longer counts towards the storage limit
+	used, dsiErr := h.store.GetProjectStorageSize(projectID)
+	if dsiErr != nil {
+		c.JSON(dsiErr.Code(), gin.H{"error": dsiErr.Error()})
+		return
+	}
+	if current, dsiErr := h.store.GetDefDocumentFile(projectID, resourcePathName, resourceID, field); dsiErr == nil {
+		used -= current.Size
+	}
+	if limit := int64(c.GetInt("accountStorageLimit")) * bytesPerMegabyte; used+header.Size > limit {
+		c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": "file exceeds the project storage limit"})
+		return
+	}
+
+	file, err := h.storeFile(projectID, resourcePathName, resourceID, field, header)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "error storing file"})
+		return
+	}
+
+	middleware.SetEventPrevious(c, models.EndpointResource, models.HookEdit, func() ([]byte, error) {
+		return json.Marshal(document)
+	})
+
+	replaced, dsiErr := h.store.AttachDefDocumentFile(projectID, resourcePathName, resourceID, file)
+	if dsiErr != nil {
+		h.deleteFile(file)
+		c.JSON(dsiErr.Code(), gin.H{"error": dsiErr.Error()})
+		return
+	}
+	if replaced != nil {
+		h.deleteFile(replaced)
+	}
+
+	h.setDocumentEvent(c, projectID, resourcePathName, resourceID, authFilters)
+	c.JSON(http.StatusOK, file)
+}
+
+// DeleteFile removes the file of a document field
+func (h *Documents) DeleteFile(c *gin.Context) {
+	resourcePathName := c.Param("resourcePathName")
+	resourceID := c.Param("resourceID")
+	field := c.Param("field")
+	projectID := c.MustGet("projectId").(string)
+	authFilters := c.MustGet("filters").(map[string]interface{})
+
+	document, dsiErr := h.store.GetDefDocument(projectID, resourcePathName, resourceID, authFilters)
+	if dsiErr != nil {
+		c.JSON(dsiErr.Code(), gin.H{"error": dsiErr.Error()})
+		return
+	}
+
+	permissions, role, err := h.fieldAccess(c, projectID, resourcePathName)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if !permissions.CanWrite(field, role, document) {
+		c.JSON(http.StatusForbidden, gin.H{"error": fmt.Sprintf("'%s' cannot be changed", field)})
+		return
+	}
+
+	middleware.SetEventPrevious(c, models.EndpointResource, models.HookEdit, func() ([]byte, error) {
+		return json.Marshal(document)
+	})
+
+	file, dsiErr := h.store.DetachDefDocumentFile(projectID, resourcePathName, resourceID, field)
+	if dsiErr != nil {
+		c.JSON(dsiErr.Code(), gin.H{"error": dsiErr.Error()})
+		return
+	}
+	h.deleteFile(file)
+
+	// removing the file edits the document
+	c.Set("eventAction", models.HookEdit)
+	h.setDocumentEvent(c, projectID, resourcePathName, resourceID, authFilters)
+	c.JSON(http.StatusNoContent, gin.H{})
+}
+
+// setDocumentEvent sets the data of the event of a file write to the document, which the write edited
+func (h *Documents) setDocumentEvent(c *gin.Context, projectID, resourcePathName, resourceID string, authFilters map[string]interface{}) {
+	document, dsiErr := h.store.GetDefDocument(projectID, resourcePathName, resourceID, authFilters)
+	if dsiErr != nil {
+		log.Println("could not read the document of the file ", dsiErr.Error())
+		return
+	}
+	middleware.SetEventData(c, document)
+}
+
+// storeFile writes the uploaded file to the storage backend
+func (h *Documents) storeFile(projectID, resourcePathName, resourceID, field string, header *multipart.FileHeader) (*models.File, error) {
+	src, err := header.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer src.Close()
+
+	contentType := header.Header.Get("Content-Type")
+	if contentType == "" {
+		contentType = "application/octet-stream"
+	}
+
+	file := &models.File{
+		ID:           uuid.NewV4().String(),
+		ProjectID:    projectID,
+		ResourcePath: resourcePathName,
+		DocumentID:   resourceID,
+		Field:        field,
+		Name:         header.Filename,
+		ContentType:  contentType,
+	}
+
+	file.Size, err = h.files.Put(file.StorageKey(), src)
+	if err != nil {
+		return nil, err
+	}
+
+	return file, nil
+}
+
+// deleteFile removes the file contents from the storage backend, failures only leave an orphaned file behind
+func (h *Documents) deleteFile(file *models.File) {
+	if err := h.files.Delete(file.StorageKey()); err != nil {
+		log.Println("could not delete file ", err.Error())
+	}
+}
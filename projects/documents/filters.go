@@ -0,0 +1,78 @@
+package documents
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"strconv"
+
+	"github.com/machinable/machinable/dsi"
+	"github.com/machinable/machinable/dsi/models"
+)
+
+// queryFilter builds the document filter of the query parameters of a list request, skipping the pagination and sort
+// parameters. Fields are filtered by equality, and must be schema properties the requester can read. The geo filter is
+// also returned, nil if the request has no geo parameters.
+func queryFilter(values url.Values, def *models.ResourceDefinition, schema *models.JSONSchemaObject, permissions models.FieldPermissions, role string) (map[string]interface{}, *models.GeoFilter, error) {
+	filter := make(map[string]interface{})
+
+	for k, v := range values {
+		if k == dsi.LimitKey || k == dsi.OffsetKey || k == dsi.SortKey || geoQueryKeys[k] {
+			continue
+		}
+
+		_, ok := schema.Properties[k]
+		if !ok || !permissions.CanRead(k, role) {
+			return nil, nil, fmt.Errorf("unable to filter on '%s'", k)
+		}
+
+		// no need to cast type, let the DSI layer do that (if needed)
+		filter[k] = v[0]
+	}
+
+	geoField, geo, err := geoFilter(values, def, permissions, role)
+	if err != nil {
+		return nil, nil, err
+	}
+	if geo != nil {
+		filter[geoField] = geo
+	}
+
+	return filter, geo, nil
+}
+
+// matchFilter returns true if the document passes the filter of `queryFilter`, as the datastore filters documents. Values
+// are compared as the text of their JSON value, strings without quotes, and missing or null fields never match.
+func matchFilter(filter map[string]interface{}, doc map[string]interface{}) bool {
+	for k, v := range filter {
+		if geo, ok := v.(*models.GeoFilter); ok {
+			if !geo.Match(doc[k]) {
+				return false
+			}
+			continue
+		}
+
+		text, ok := textValue(doc[k])
+		if !ok || text != v {
+			return false
+		}
+	}
+	return true
+}
+
+// textValue returns the text of a decoded JSON value, as postgres returns it with the `->>` operator
+func textValue(value interface{}) (string, bool) {
+	switch v := value.(type) {
+	case nil:
+		return "", false
+	case string:
+		return v, true
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64), true
+	case bool:
+		return strconv.FormatBool(v), true
+	default:
+		b, err := json.Marshal(v)
+		return string(b), err == nil
+	}
+}
@@ -0,0 +1,193 @@
+package documents
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+	"github.com/gin-gonic/gin/render"
+	"github.com/machinable/machinable/dsi"
+	"github.com/machinable/machinable/dsi/models"
+	"github.com/machinable/machinable/query"
+)
+
+const (
+	// MIMECSV is the content type for comma separated values
+	MIMECSV = "text/csv"
+	// MIMENDJSON is the content type for newline delimited JSON
+	MIMENDJSON = "application/x-ndjson"
+
+	mimeAny = "*/*"
+)
+
+// offeredFormats are the response formats supported by the document handlers, in order of preference
+var offeredFormats = []string{
+	binding.MIMEJSON,
+	MIMECSV,
+	MIMENDJSON,
+	binding.MIMEMSGPACK2,
+	binding.MIMEMSGPACK,
+	mimeAny,
+}
+
+// negotiateFormat returns the response format based on the `Accept` header of the request. An empty string is
+// returned if none of the accepted formats are offered.
+func negotiateFormat(c *gin.Context) string {
+	if header := c.GetHeader("Accept"); header != "" {
+		accepted := acceptedFormats(header)
+		if len(accepted) == 0 {
+			return ""
+		}
+		c.SetAccepted(accepted...)
+	}
+
+	format := c.NegotiateFormat(offeredFormats...)
+	switch format {
+	case mimeAny:
+		return binding.MIMEJSON
+	case binding.MIMEMSGPACK:
+		return binding.MIMEMSGPACK2
+	}
+	return format
+}
+
+// acceptedFormats returns the media types of an `Accept` header ordered by their quality value, keeping the order of
+// the header for equal values. Media types with a quality value of 0 are not acceptable and left out.
+func acceptedFormats(header string) []string {
+	type acceptedFormat struct {
+		format  string
+		quality float64
+	}
+
+	formats := []acceptedFormat{}
+	for _, part := range strings.Split(header, ",") {
+		params := strings.Split(part, ";")
+		format := acceptedFormat{format: strings.TrimSpace(params[0]), quality: 1}
+		if format.format == "" {
+			continue
+		}
+		for _, param := range params[1:] {
+			param = strings.TrimSpace(param)
+			if strings.HasPrefix(param, "q=") {
+				if q, err := strconv.ParseFloat(param[len("q="):], 64); err == nil {
+					format.quality = q
+				}
+			}
+		}
+		if format.quality > 0 {
+			formats = append(formats, format)
+		}
+	}
+	sort.SliceStable(formats, func(i, j int) bool {
+		return formats[i].quality > formats[j].quality
+	})
+
+	accepted := make([]string, len(formats))
+	for i, format := range formats {
+		accepted[i] = format.format
+	}
+	return accepted
+}
+
+// setPaginationHeaders sets the `Link` and `X-Total-Count` headers, used in place of the JSON envelope for non-JSON formats
+func setPaginationHeaders(c *gin.Context, links *query.Links, count int64) {
+	if header := links.Header(); header != "" {
+		c.Header("Link", header)
+	}
+	c.Header("X-Total-Count", strconv.FormatInt(count, 10))
+}
+
+// csvColumns returns the ordered CSV header for the documents of a resource definition, excluding fields the role
+// is not allowed to see
+func csvColumns(def *models.ResourceDefinition, permissions models.FieldPermissions, role string) ([]string, error) {
+	schema, err := def.GetSchema()
+	if err != nil {
+		return nil, err
+	}
+
+	properties := make([]string, 0, len(schema.Properties))
+	for key := range schema.Properties {
+		if permissions.CanRead(key, role) {
+			properties = append(properties, key)
+		}
+	}
+	sort.Strings(properties)
+
+	columns := []string{dsi.JSONIDKey}
+	columns = append(columns, properties...)
+	columns = append(columns, dsi.MetadataCreated, dsi.MetadataCreator, dsi.MetadataCreatorType)
+
+	return columns, nil
+}
+
+// csvRecord flattens a document into a CSV record with the values ordered by `columns`
+func csvRecord(doc map[string]interface{}, columns []string) []string {
+	meta, _ := doc[dsi.MetadataKey].(models.MetaData)
+
+	record := make([]string, len(columns))
+	for i, column := range columns {
+		switch column {
+		case dsi.MetadataCreated:
+			record[i] = strconv.FormatInt(meta.Created, 10)
+		case dsi.MetadataCreator:
+			record[i] = meta.Creator
+		case dsi.MetadataCreatorType:
+			record[i] = meta.CreatorType
+		default:
+			record[i] = csvValue(doc[column])
+		}
+	}
+
+	return record
+}
+
+// csvValue formats a single document value as a CSV cell. Objects and arrays are written as JSON.
+func csvValue(value interface{}) string {
+	switch v := value.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case bool:
+		return strconv.FormatBool(v)
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case json.Number:
+		return v.String()
+	default:
+		b, err := json.Marshal(v)
+		if err != nil {
+			return fmt.Sprint(v)
+		}
+		return string(b)
+	}
+}
+
+// writeCSV writes the documents as CSV, with a header row of `columns`
+func writeCSV(c *gin.Context, code int, columns []string, documents []map[string]interface{}) {
+	c.Header("Content-Type", MIMECSV+"; charset=utf-8")
+	c.Status(code)
+
+	w := csv.NewWriter(c.Writer)
+	w.Write(columns)
+	for _, doc := range documents {
+		w.Write(csvRecord(doc, columns))
+	}
+	w.Flush()
+}
+
+// writeMsgPack writes the object as MessagePack
+func writeMsgPack(c *gin.Context, code int, obj interface{}) {
+	c.Render(code, render.MsgPack{Data: obj})
+}
+
+// writeNotAcceptable responds with the list of formats the document handlers are able to produce
+func writeNotAcceptable(c *gin.Context) {
+	c.JSON(http.StatusNotAcceptable, gin.H{"error": "the accepted formats are not offered by the server", "formats": offeredFormats[:len(offeredFormats)-1]})
+}
@@ -0,0 +1,99 @@
+package documents
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+	"github.com/machinable/machinable/dsi/models"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNegotiateFormat(t *testing.T) {
+	gin.SetMode(gin.ReleaseMode)
+	tests := []struct {
+		accept string
+		format string
+	}{
+		{"", binding.MIMEJSON},
+		{"*/*", binding.MIMEJSON},
+		{"application/json", binding.MIMEJSON},
+		{"text/csv", MIMECSV},
+		{"application/x-ndjson", MIMENDJSON},
+		{"application/msgpack", binding.MIMEMSGPACK2},
+		{"application/x-msgpack", binding.MIMEMSGPACK2},
+		{"text/html, text/csv", MIMECSV},
+		{"text/csv, application/json", MIMECSV},
+		{"text/csv;q=0.5, application/json", binding.MIMEJSON},
+		{"application/json; q=0.2, text/csv; q=0.8", MIMECSV},
+		{"text/csv;q=0.9, application/x-ndjson;q=0.9", MIMECSV},
+		{"text/csv;q=0, */*;q=0.1", binding.MIMEJSON},
+		{"text/csv;q=invalid, application/json;q=0.5", MIMECSV},
+		{"text/html", ""},
+		{"text/html, application/xml;q=0.9", ""},
+		{"text/csv;q=0", ""},
+	}
+
+	for _, test := range tests {
+		c, _ := gin.CreateTestContext(httptest.NewRecorder())
+		c.Request, _ = http.NewRequest(http.MethodGet, "/api/dogs", nil)
+		if test.accept != "" {
+			c.Request.Header.Set("Accept", test.accept)
+		}
+		assert.Equal(t, test.format, negotiateFormat(c), test.accept)
+	}
+}
+
+func TestWriteNotAcceptable(t *testing.T) {
+	gin.SetMode(gin.ReleaseMode)
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	writeNotAcceptable(c)
+
+	assert.Equal(t, http.StatusNotAcceptable, w.Code)
+	assert.Contains(t, w.Body.String(), MIMECSV)
+	assert.NotContains(t, w.Body.String(), mimeAny)
+}
+
+func TestCSVColumns(t *testing.T) {
+	def := &models.ResourceDefinition{Schema: `{"type": "object", "properties": {"name": {"type": "string"}, "age": {"type": "number"}, "secret": {"type": "string"}}}`}
+	permissions := models.FieldPermissions{"secret": {ReadRoles: []string{"admin"}}}
+
+	columns, err := csvColumns(def, permissions, "user")
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"id", "age", "name", "_metadata.created", "_metadata.creator", "_metadata.creator_type"}, columns)
+
+	columns, err = csvColumns(def, permissions, "admin")
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"id", "age", "name", "secret", "_metadata.created", "_metadata.creator", "_metadata.creator_type"}, columns)
+}
+
+func TestWriteCSV(t *testing.T) {
+	gin.SetMode(gin.ReleaseMode)
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+
+	columns := []string{"id", "name", "tags", "age", "_metadata.created", "_metadata.creator", "_metadata.creator_type"}
+	documents := []map[string]interface{}{
+		{
+			"id":        "rex",
+			"name":      `Rex "the dog", Jr.`,
+			"tags":      []interface{}{"good", "boy"},
+			"age":       float64(3.5),
+			"_metadata": models.MetaData{Creator: "jane", CreatorType: "user", Created: 1546300800},
+		},
+		{
+			"id":   "max",
+			"name": "Max\nthe second",
+		},
+	}
+	writeCSV(c, http.StatusOK, columns, documents)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "text/csv; charset=utf-8", w.Header().Get("Content-Type"))
+	assert.Equal(t, "id,name,tags,age,_metadata.created,_metadata.creator,_metadata.creator_type\n"+
+		`rex,"Rex ""the dog"", Jr.","[""good"",""boy""]",3.5,1546300800,jane,user`+"\n"+
+		"max,\"Max\nthe second\",,,0,,\n", w.Body.String())
+}
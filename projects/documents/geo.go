@@ -0,0 +1,75 @@
+package documents
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+
+	"github.com/machinable/machinable/dsi"
+	"github.com/machinable/machinable/dsi/models"
+)
+
+// geoQueryKeys are the query parameters of geo filters
+var geoQueryKeys = map[string]bool{
+	dsi.NearKey:        true,
+	dsi.WithinKey:      true,
+	dsi.BoundingBoxKey: true,
+	dsi.GeoFieldKey:    true,
+}
+
+// geoFilter parses the geo query parameters of a list request, returning the geopoint field to filter and the filter.
+// A nil filter is returned if the request has no geo parameters.
+func geoFilter(values url.Values, def *models.ResourceDefinition, permissions models.FieldPermissions, role string) (string, *models.GeoFilter, error) {
+	near, within, box := values.Get(dsi.NearKey), values.Get(dsi.WithinKey), values.Get(dsi.BoundingBoxKey)
+	if near == "" && within == "" && box == "" {
+		return "", nil, nil
+	}
+
+	fields, err := def.GetGeoFields()
+	if err != nil {
+		return "", nil, errors.New("error getting schema geopoint properties")
+	}
+
+	// the geopoint field only needs to be named if the resource has more than one
+	field := values.Get(dsi.GeoFieldKey)
+	if field == "" {
+		if len(fields) != 1 {
+			return "", nil, fmt.Errorf("'%s' is required to select the geopoint property", dsi.GeoFieldKey)
+		}
+		field = fields[0]
+	}
+	if !containsField(fields, field) || !permissions.CanRead(field, role) {
+		return "", nil, fmt.Errorf("unable to filter on '%s'", field)
+	}
+
+	geo := &models.GeoFilter{}
+	if near != "" {
+		if geo.Near, err = models.ParseGeoPoint(near); err != nil {
+			return "", nil, err
+		}
+	}
+	if within != "" {
+		if geo.Near == nil {
+			return "", nil, fmt.Errorf("'%s' requires a '%s' point", dsi.WithinKey, dsi.NearKey)
+		}
+		if geo.Within, err = models.ParseDistance(within); err != nil {
+			return "", nil, err
+		}
+	}
+	if box != "" {
+		if geo.Box, err = models.ParseGeoBox(box); err != nil {
+			return "", nil, err
+		}
+	}
+
+	return field, geo, nil
+}
+
+func containsField(fields []string, field string) bool {
+	for _, f := range fields {
+		if f == field {
+			return true
+		}
+	}
+	return false
+}
@@ -68,7 +68,7 @@ func (d *Documents) ListCollectionUsage(c *gin.Context) {
 	c.PureJSON(http.StatusOK, gin.H{"items": response})
 }
 
-// GetStats returns the size of the collections
+// GetStats returns the size of the collections and document files
 func (d *Documents) GetStats(c *gin.Context) {
 	projectID := c.MustGet("projectId").(string)
 
@@ -94,5 +94,13 @@ func (d *Documents) GetStats(c *gin.Context) {
 		totalStats.Count += stats.Count
 	}
 
-	c.JSON(http.StatusOK, gin.H{"total": totalStats, "resources": resourceStats})
+	// files count towards the total size, but are not documents
+	fileStats, err := d.store.GetFileStats(projectID)
+	if err != nil {
+		c.JSON(err.Code(), gin.H{"error": err.Error()})
+		return
+	}
+	totalStats.Size += fileStats.Size
+
+	c.JSON(http.StatusOK, gin.H{"total": totalStats, "resources": resourceStats, "files": fileStats})
 }
@@ -1,27 +1,37 @@
 package documents
 
 import (
+	"encoding/json"
 	"fmt"
+	"log"
 	"net/http"
-	"strings"
 
 	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
 	"github.com/machinable/machinable/dsi"
 	"github.com/machinable/machinable/dsi/interfaces"
 	"github.com/machinable/machinable/dsi/models"
+	"github.com/machinable/machinable/events"
+	"github.com/machinable/machinable/middleware"
 	"github.com/machinable/machinable/query"
+	"github.com/machinable/machinable/storage"
+	uuid "github.com/satori/go.uuid"
 )
 
 // New returns a pointer to a new `Documents` struct
-func New(db interfaces.Datastore) *Documents {
+func New(db interfaces.Datastore, files storage.Backend, changes *events.Broker) *Documents {
 	return &Documents{
-		store: db,
+		store:   db,
+		files:   files,
+		changes: changes,
 	}
 }
 
-// Documents contains the datastore and any HTTP handlers for project resource documents
+// Documents contains the datastore, file storage, change streams and any HTTP handlers for project resource documents
 type Documents struct {
-	store interfaces.Datastore
+	store   interfaces.Datastore
+	files   storage.Backend
+	changes *events.Broker
 }
 
 // AddObject creates a new document of the resource definition
@@ -41,17 +51,44 @@ func (h *Documents) AddObject(c *gin.Context) {
 
 	meta := models.NewMetaData(creator, creatorType)
 
-	// TODO: Validate against schema here
+	def, err := h.definition(c, projectID, resourcePathName)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "resource does not exist"})
+		return
+	}
+
+	// verify the requester is allowed to set each field
+	permissions, role, err := h.fieldAccess(c, projectID, resourcePathName)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	permErr := permissions.CheckCreate(fieldValues, role)
+	if middleware.DryRun(c) {
+		h.dryRun(c, projectID, resourcePathName, fieldValues, permErr)
+		return
+	}
+	if permErr != nil {
+		writeSaveError(c, http.StatusForbidden, resourcePathName, permErr)
+		return
+	}
+
+	if err := fieldValues.Validate(def); err != nil {
+		writeSaveError(c, http.StatusBadRequest, resourcePathName, err)
+		return
+	}
 
 	newID, dsiErr := h.store.AddDefDocument(projectID, resourcePathName, fieldValues, meta)
 	if dsiErr != nil {
-		c.JSON(dsiErr.Code(), gin.H{"error": "failed to save " + resourcePathName, "errors": strings.Split(dsiErr.Error(), ",")})
+		writeSaveError(c, dsiErr.Code(), resourcePathName, dsiErr)
 		return
 	}
 
 	// Set the inserted ID for the response
 	fieldValues["id"] = newID
 	fieldValues["_metadata"] = meta
+	middleware.SetEventData(c, fieldValues)
+	permissions.Strip(fieldValues, role)
 
 	c.JSON(http.StatusCreated, fieldValues)
 }
@@ -71,20 +108,119 @@ func (h *Documents) PutObject(c *gin.Context) {
 		return
 	}
 
-	// TODO: Validate against schema here
+	def, err := h.definition(c, projectID, resourcePathName)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	// documents of resources which allow upserts can be created with the client supplied ID
+	if def.Upsert {
+		if _, err := uuid.FromString(resourceID); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid id, must be a UUID"})
+			return
+		}
+	}
+
+	permissions, role, err := h.fieldAccess(c, projectID, resourcePathName)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	dryRun := middleware.DryRun(c)
+	if len(permissions) > 0 || dryRun {
+		// compare against the existing document for read-only and write-once fields
+		existing, dsiErr := h.store.GetDefDocument(projectID, resourcePathName, resourceID, authFilters)
+		if dsiErr != nil && !(def.Upsert && dsiErr.Code() == http.StatusNotFound) {
+			c.JSON(dsiErr.Code(), gin.H{"error": dsiErr.Error()})
+			return
+		}
+
+		if existing == nil {
+			err = permissions.CheckCreate(fieldValues, role)
+		} else {
+			err = permissions.ApplyUpdate(fieldValues, existing, role)
+		}
+		if dryRun {
+			h.dryRun(c, projectID, resourcePathName, fieldValues, err)
+			return
+		}
+		if err != nil {
+			writeSaveError(c, http.StatusForbidden, resourcePathName, err)
+			return
+		}
+	}
+
+	if err := fieldValues.Validate(def); err != nil {
+		writeSaveError(c, http.StatusBadRequest, resourcePathName, err)
+		return
+	}
+
+	middleware.SetEventPrevious(c, models.EndpointResource, models.HookEdit, func() ([]byte, error) {
+		existing, dsiErr := h.store.GetDefDocument(projectID, resourcePathName, resourceID, authFilters)
+		if dsiErr != nil {
+			return nil, dsiErr
+		}
+		return json.Marshal(existing)
+	})
+
+	if def.Upsert {
+		// documents are only created for requesters the create policy of the resource allows
+		meta := models.NewMetaData(c.GetString("authID"), c.GetString("authType"))
+		_, createCode, createErr := middleware.ResourceCreateFilters(c, def)
+		if createErr != nil {
+			meta = nil
+		}
+
+		object, created, dsiErr := h.store.UpsertDefDocument(projectID, resourcePathName, resourceID, fieldValues, meta, authFilters)
+		if dsiErr != nil && createErr != nil && dsiErr.Code() == http.StatusNotFound {
+			c.JSON(createCode, gin.H{"error": createErr.Error()})
+			return
+		} else if dsiErr != nil {
+			writeSaveError(c, dsiErr.Code(), resourcePathName, dsiErr)
+			return
+		}
+		middleware.SetEventData(c, object)
+		setEventCreator(c, *object)
+		permissions.Strip(*object, role)
+
+		status := http.StatusOK
+		if created {
+			status = http.StatusCreated
+			c.Set("eventAction", "create")
+		}
+		c.JSON(status, object)
+		return
+	}
 
 	object, dsiErr := h.store.UpdateDefDocument(projectID, resourcePathName, resourceID, fieldValues, authFilters)
 	if dsiErr != nil {
-		c.JSON(dsiErr.Code(), gin.H{"error": "failed to save " + resourcePathName, "errors": strings.Split(dsiErr.Error(), ",")})
+		writeSaveError(c, dsiErr.Code(), resourcePathName, dsiErr)
 		return
 	}
+	middleware.SetEventData(c, object)
+	setEventCreator(c, *object)
+	permissions.Strip(*object, role)
 
 	c.JSON(http.StatusOK, object)
 }
 
+// setEventCreator sets the creator of an updated document for its edit event, updates return the metadata of the
+// document as `_meta` rather than `_metadata`
+func setEventCreator(c *gin.Context, object models.ResourceObject) {
+	if meta, ok := object["_meta"].(*models.MetaData); ok && meta != nil {
+		c.Set("eventCreator", meta.Creator)
+	}
+}
+
 // ListObjects returns the list of objects for a resource
 func (h *Documents) ListObjects(c *gin.Context) {
 	resourcePathName := c.Param("resourcePathName")
+	if middleware.ChangesRequest(c) {
+		h.ListChanges(c)
+		return
+	}
 	projectID := c.MustGet("projectId").(string)
 	authFilters := c.MustGet("filters").(map[string]interface{})
 
@@ -93,6 +229,12 @@ func (h *Documents) ListObjects(c *gin.Context) {
 		return
 	}
 
+	format := negotiateFormat(c)
+	if format == "" {
+		writeNotAcceptable(c)
+		return
+	}
+
 	// Get pagination parameters
 	values := c.Request.URL.Query()
 
@@ -107,54 +249,51 @@ func (h *Documents) ListObjects(c *gin.Context) {
 		return
 	}
 
+	resourceDefinition, err := h.definition(c, projectID, resourcePathName)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "could not retrieve resource definition to validate query parameters"})
+		return
+	}
+
+	// get property types
+	validSchema, err := resourceDefinition.GetSchema()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "error getting schema property types"})
+		return
+	}
+
+	permissions, role, err := h.fieldAccess(c, projectID, resourcePathName)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
 	// Format query parameters
-	filter := make(map[string]interface{})
 	sort := make(map[string]int)
 
-	var resourceDefinition *models.ResourceDefinition
-	validSchema := &models.JSONSchemaObject{}
-	for k, v := range values {
-		if k == dsi.LimitKey || k == dsi.OffsetKey {
-			continue
-		}
-
-		if k == dsi.SortKey {
-			sortField := v[0]
-			firstChar := string(sortField[0])
-			order := 1
-			if firstChar == "-" {
-				order = -1
-				sortField = sortField[1:]
-			}
-			sort[sortField] = order
-			continue
-		}
-
-		if resourceDefinition == nil || validSchema == nil {
-			// get resource definition if we do not already have it
-			resourceDefinition, err := h.store.GetDefinitionByPathName(projectID, resourcePathName)
-			if err != nil {
-				c.JSON(http.StatusInternalServerError, gin.H{"error": "could not retrieve resource definition to validate query parameters"})
-				return
-			}
-
-			// get property types
-			var pErr error
-			validSchema, pErr = resourceDefinition.GetSchema()
-			if pErr != nil {
-				c.JSON(http.StatusInternalServerError, gin.H{"error": "error getting schema property types"})
-				return
-			}
-		}
-
-		_, ok := validSchema.Properties[k]
-		if !ok {
-			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("unable to filter on '%s'", k)})
+	if sortValues, ok := values[dsi.SortKey]; ok {
+		sortField := sortValues[0]
+		firstChar := string(sortField[0])
+		order := 1
+		if firstChar == "-" {
+			order = -1
+			sortField = sortField[1:]
+		}
+		if !permissions.CanRead(sortField, role) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("unable to sort on '%s'", sortField)})
 			return
 		}
+		sort[sortField] = order
+	}
 
-		// no need to cast type, let the DSI layer do that (if needed)
-		filter[k] = v[0]
+	filter, geo, err := queryFilter(values, resourceDefinition, validSchema, permissions, role)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if _, ok := sort[dsi.DistanceKey]; ok && (geo == nil || geo.Near == nil) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("sorting by distance requires a '%s' point", dsi.NearKey)})
+		return
 	}
 
 	// Apply authorization filters
@@ -176,6 +315,15 @@ func (h *Documents) ListObjects(c *gin.Context) {
 		return
 	}
 
+	links := query.NewLinks(c.Request, iLimit, iOffset, docCount)
+
+	if format == MIMENDJSON {
+		// stream documents as they are read, rather than loading the page into memory
+		setPaginationHeaders(c, links, docCount)
+		h.streamDocuments(c, projectID, resourcePathName, iLimit, iOffset, filter, sort, permissions, role)
+		return
+	}
+
 	documents, dsiErr := h.store.ListDefDocuments(projectID, resourcePathName, iLimit, iOffset, filter, sort)
 
 	if dsiErr != nil {
@@ -183,9 +331,51 @@ func (h *Documents) ListObjects(c *gin.Context) {
 		return
 	}
 
-	links := query.NewLinks(c.Request, iLimit, iOffset, docCount)
+	for _, doc := range documents {
+		permissions.Strip(doc, role)
+	}
 
-	c.PureJSON(http.StatusOK, gin.H{"items": documents, "links": links, "count": docCount})
+	switch format {
+	case MIMECSV:
+		columns, err := csvColumns(resourceDefinition, permissions, role)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		setPaginationHeaders(c, links, docCount)
+		writeCSV(c, http.StatusOK, columns, documents)
+	case binding.MIMEMSGPACK2:
+		setPaginationHeaders(c, links, docCount)
+		writeMsgPack(c, http.StatusOK, documents)
+	default:
+		c.PureJSON(http.StatusOK, gin.H{"items": documents, "links": links, "count": docCount})
+	}
+}
+
+// streamDocuments writes each document as a line of JSON as it is read from the datastore
+func (h *Documents) streamDocuments(c *gin.Context, projectID, resourcePathName string, limit, offset int64, filter map[string]interface{}, sort map[string]int, permissions models.FieldPermissions, role string) {
+	c.Header("Content-Type", MIMENDJSON)
+	c.Status(http.StatusOK)
+
+	enc := json.NewEncoder(c.Writer)
+	dsiErr := h.store.EachDefDocument(projectID, resourcePathName, limit, offset, filter, sort, func(doc map[string]interface{}) error {
+		permissions.Strip(doc, role)
+		if err := enc.Encode(doc); err != nil {
+			return err
+		}
+		c.Writer.Flush()
+		return nil
+	})
+
+	if dsiErr != nil {
+		if c.Writer.Written() {
+			// the status has already been sent, all we can do is end the stream
+			log.Println("error streaming documents:", dsiErr.Error())
+			return
+		}
+		c.Writer.Header().Del("Content-Type")
+		c.JSON(dsiErr.Code(), gin.H{"error": dsiErr.Error()})
+	}
 }
 
 // GetObject returns a single object with the resourceID for this resource
@@ -195,14 +385,54 @@ func (h *Documents) GetObject(c *gin.Context) {
 	projectID := c.MustGet("projectId").(string)
 	authFilters := c.MustGet("filters").(map[string]interface{})
 
-	document, err := h.store.GetDefDocument(projectID, resourcePathName, resourceID, authFilters)
+	// the stream shares the route of documents, which cannot have a static segment in the same position
+	if resourceID == streamPath {
+		h.StreamObjects(c)
+		return
+	}
+
+	format := negotiateFormat(c)
+	if format == "" {
+		writeNotAcceptable(c)
+		return
+	}
 
+	permissions, role, err := h.fieldAccess(c, projectID, resourcePathName)
 	if err != nil {
-		c.JSON(err.Code(), gin.H{"error": err.Error()})
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	document, dsiErr := h.store.GetDefDocument(projectID, resourcePathName, resourceID, authFilters)
+
+	if dsiErr != nil {
+		c.JSON(dsiErr.Code(), gin.H{"error": dsiErr.Error()})
 		return
 	}
+	permissions.Strip(document, role)
 
-	c.IndentedJSON(http.StatusOK, document)
+	switch format {
+	case MIMECSV:
+		def, err := h.definition(c, projectID, resourcePathName)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		columns, err := csvColumns(def, permissions, role)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		writeCSV(c, http.StatusOK, columns, []map[string]interface{}{document})
+	case MIMENDJSON:
+		c.Header("Content-Type", MIMENDJSON)
+		c.Status(http.StatusOK)
+		json.NewEncoder(c.Writer).Encode(document)
+	case binding.MIMEMSGPACK2:
+		writeMsgPack(c, http.StatusOK, document)
+	default:
+		c.IndentedJSON(http.StatusOK, document)
+	}
 }
 
 // DeleteObject deletes the object from the collection
@@ -212,12 +442,34 @@ func (h *Documents) DeleteObject(c *gin.Context) {
 	projectID := c.MustGet("projectId").(string)
 	authFilters := c.MustGet("filters").(map[string]interface{})
 
-	err := h.store.DeleteDefDocument(projectID, resourcePathName, resourceID, authFilters)
+	// the creator of the deleted document is streamed with its delete event
+	existing, err := h.store.GetDefDocument(projectID, resourcePathName, resourceID, authFilters)
+	if err != nil {
+		c.JSON(err.Code(), gin.H{"error": err.Error()})
+		return
+	}
+	if meta, ok := existing["_metadata"].(models.MetaData); ok {
+		c.Set("eventCreator", meta.Creator)
+	}
+	middleware.SetEventPrevious(c, models.EndpointResource, models.HookDelete, func() ([]byte, error) {
+		return json.Marshal(existing)
+	})
 
+	err = h.store.DeleteDefDocument(projectID, resourcePathName, resourceID, authFilters)
 	if err != nil {
 		c.JSON(err.Code(), gin.H{"error": err.Error()})
 		return
 	}
 
+	// remove the files attached to the document
+	if err := h.store.DropDefDocumentFiles(projectID, resourcePathName, resourceID); err != nil {
+		c.JSON(err.Code(), gin.H{"error": err.Error()})
+		return
+	}
+	if err := h.files.DeleteAll(models.DocumentFilesPrefix(projectID, resourcePathName, resourceID)); err != nil {
+		log.Println("could not delete document files ", err.Error())
+	}
+
+	c.Set("eventAction", "delete")
 	c.JSON(http.StatusNoContent, gin.H{})
 }
@@ -0,0 +1,22 @@
+package documents
+
+import (
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/machinable/machinable/dsi/models"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSetEventCreator(t *testing.T) {
+	// updated documents have the metadata as `_meta`
+	c := &gin.Context{}
+	setEventCreator(c, models.ResourceObject{"id": "rex", "_meta": &models.MetaData{Creator: "jane", CreatorType: "user"}})
+	assert.Equal(t, "jane", c.GetString("eventCreator"))
+
+	// created documents have the metadata as `_metadata`, which the event reads from its data
+	c = &gin.Context{}
+	setEventCreator(c, models.ResourceObject{"id": "rex", "_metadata": &models.MetaData{Creator: "jane"}})
+	_, exists := c.Get("eventCreator")
+	assert.False(t, exists)
+}
@@ -0,0 +1,342 @@
+package documents
+
+import (
+	"encoding/json"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/machinable/machinable/dsi/models"
+	"github.com/machinable/machinable/events"
+	"github.com/machinable/machinable/middleware"
+	"github.com/machinable/machinable/query"
+	"golang.org/x/net/websocket"
+)
+
+// Types of live query messages. Clients send `subscribe` and `unsubscribe` messages, every other type is sent by the
+// server.
+const (
+	liveSubscribe    = "subscribe"
+	liveUnsubscribe  = "unsubscribe"
+	liveSubscribed   = "subscribed"
+	liveUnsubscribed = "unsubscribed"
+	liveAdded        = "added"
+	liveChanged      = "changed"
+	liveRemoved      = "removed"
+	liveError        = "error"
+)
+
+// liveBuffer is the number of messages queued for a live query connection while it is written to
+const liveBuffer = 256
+
+// liveWriteTimeout is how long a message can take to be written before the connection is closed
+const liveWriteTimeout = 10 * time.Second
+
+// liveMaxMessageSize is the maximum size of a client message, in bytes
+const liveMaxMessageSize = 64 << 10
+
+// liveMessage is a message of the live query protocol. A subscription has a client chosen `id`, which is included in
+// every message about it, and the `resource` and list `query` (i.e. `name=rex&near=40.7,-74.0&within=5km`) it follows.
+type liveMessage struct {
+	Type       string                 `json:"type"`
+	ID         string                 `json:"id,omitempty"`
+	Resource   string                 `json:"resource,omitempty"`
+	Query      string                 `json:"query,omitempty"`
+	Change     int64                  `json:"change,omitempty"`
+	DocumentID string                 `json:"document_id,omitempty"`
+	Document   map[string]interface{} `json:"document,omitempty"`
+	Error      string                 `json:"error,omitempty"`
+}
+
+// liveSubscription is a subscription of a connection to the documents of a resource which match a filter
+type liveSubscription struct {
+	id          string
+	filter      map[string]interface{}
+	permissions models.FieldPermissions
+	role        string
+	changes     *events.Subscription
+	// matched are the documents sent as added or changed, which are sent as removed once they no longer match
+	matched map[string]bool
+	stop    chan struct{}
+}
+
+// liveConn is a live query connection, with its subscriptions. Messages are queued on `out` and written by a single
+// writer.
+type liveConn struct {
+	h         *Documents
+	c         *gin.Context
+	ws        *websocket.Conn
+	projectID string
+	out       chan *liveMessage
+	done      chan struct{}
+	closeOnce sync.Once
+
+	mu            sync.Mutex
+	subscriptions map[string]*liveSubscription
+}
+
+// LiveQueries serves live query connections over WebSocket. Each connection can subscribe to the documents of many
+// resources with the filters of `ListObjects`. Subscriptions start with the first page of matching documents as `added`
+// messages followed by `subscribed`, then receive `added`, `changed` and `removed` messages as documents are created,
+// edited and deleted, or start or stop matching.
+func (h *Documents) LiveQueries(c *gin.Context) {
+	server := websocket.Server{
+		// the project API is open to every origin, credentials are checked by the middleware
+		Handler: func(ws *websocket.Conn) {
+			ws.MaxPayloadBytes = liveMaxMessageSize
+
+			conn := &liveConn{
+				h:             h,
+				c:             c,
+				ws:            ws,
+				projectID:     c.MustGet("projectId").(string),
+				out:           make(chan *liveMessage, liveBuffer),
+				done:          make(chan struct{}),
+				subscriptions: map[string]*liveSubscription{},
+			}
+			conn.serve()
+		},
+	}
+
+	server.ServeHTTP(c.Writer, c.Request)
+}
+
+// serve reads the messages of the client until the connection is closed
+func (l *liveConn) serve() {
+	go l.write()
+	defer l.close()
+
+	for {
+		var data []byte
+		if err := websocket.Message.Receive(l.ws, &data); err != nil {
+			return
+		}
+
+		msg := &liveMessage{}
+		if err := json.Unmarshal(data, msg); err != nil {
+			l.send(&liveMessage{Type: liveError, Error: "invalid message"})
+			continue
+		}
+
+		switch msg.Type {
+		case liveSubscribe:
+			l.subscribe(msg)
+		case liveUnsubscribe:
+			l.unsubscribe(msg)
+		default:
+			l.send(&liveMessage{Type: liveError, ID: msg.ID, Error: "unknown message type"})
+		}
+	}
+}
+
+// write writes the queued messages to the client
+func (l *liveConn) write() {
+	for {
+		select {
+		case msg := <-l.out:
+			l.ws.SetWriteDeadline(time.Now().Add(liveWriteTimeout))
+			if err := websocket.JSON.Send(l.ws, msg); err != nil {
+				l.close()
+				return
+			}
+		case <-l.done:
+			return
+		}
+	}
+}
+
+// send queues a message for the client. Sends block while the client falls behind, which in turn makes its subscriptions
+// fall behind the changes of the project and close the connection.
+func (l *liveConn) send(msg *liveMessage) {
+	select {
+	case l.out <- msg:
+	case <-l.done:
+	}
+}
+
+// close closes the connection and its subscriptions
+func (l *liveConn) close() {
+	l.closeOnce.Do(func() {
+		close(l.done)
+		l.ws.Close()
+
+		l.mu.Lock()
+		defer l.mu.Unlock()
+		for id, s := range l.subscriptions {
+			delete(l.subscriptions, id)
+			close(s.stop)
+			s.changes.Close()
+		}
+	})
+}
+
+// subscribe validates the subscription like a list request of the requester, sends the first page of matching
+// documents, and then follows the changes of the resource
+func (l *liveConn) subscribe(msg *liveMessage) {
+	fail := func(err string) {
+		l.send(&liveMessage{Type: liveError, ID: msg.ID, Error: err})
+	}
+
+	if msg.ID == "" {
+		fail("subscription id is required")
+		return
+	}
+	l.mu.Lock()
+	_, exists := l.subscriptions[msg.ID]
+	l.mu.Unlock()
+	if exists {
+		fail("subscription id is already in use")
+		return
+	}
+
+	def, defErr := l.h.store.GetDefinitionByPathName(l.projectID, msg.Resource)
+	if defErr != nil {
+		fail("resource does not exist")
+		return
+	}
+
+	authFilters, _, err := middleware.ResourceReadFilters(l.c, def)
+	if err != nil {
+		fail(err.Error())
+		return
+	}
+
+	values, err := url.ParseQuery(msg.Query)
+	if err != nil {
+		fail("invalid query")
+		return
+	}
+	limit, err := query.GetLimit(&values)
+	if err != nil {
+		fail(err.Error())
+		return
+	}
+
+	schema, err := def.GetSchema()
+	if err != nil {
+		fail("error getting schema property types")
+		return
+	}
+	permissions, err := def.GetFieldPermissions()
+	if err != nil {
+		fail("error getting schema field permissions")
+		return
+	}
+	role := l.c.GetString("authRole")
+
+	filter, _, err := queryFilter(values, def, schema, permissions, role)
+	if err != nil {
+		fail(err.Error())
+		return
+	}
+
+	// subscribe before reading the first page, so no change is missed
+	creator, _ := authFilters["_metadata.creator"].(string)
+	changes, _ := l.h.changes.Subscribe(l.projectID, 0, func(change *events.Change) bool {
+		return change.Entity == models.EndpointResource &&
+			change.EntityKey == msg.Resource &&
+			(creator == "" || change.Creator == creator)
+	})
+
+	s := &liveSubscription{
+		id:          msg.ID,
+		filter:      filter,
+		permissions: permissions,
+		role:        role,
+		changes:     changes,
+		matched:     map[string]bool{},
+		stop:        make(chan struct{}),
+	}
+
+	pageFilter := map[string]interface{}{}
+	for k, v := range filter {
+		pageFilter[k] = v
+	}
+	for k, v := range authFilters {
+		pageFilter[k] = v
+	}
+
+	dsiErr := l.h.store.EachDefDocument(l.projectID, msg.Resource, limit, 0, pageFilter, map[string]int{}, func(doc map[string]interface{}) error {
+		id, _ := doc["id"].(string)
+		s.matched[id] = true
+		permissions.Strip(doc, role)
+		l.send(&liveMessage{Type: liveAdded, ID: s.id, DocumentID: id, Document: doc})
+		return nil
+	})
+	if dsiErr != nil {
+		changes.Close()
+		fail(dsiErr.Error())
+		return
+	}
+
+	l.mu.Lock()
+	l.subscriptions[s.id] = s
+	l.mu.Unlock()
+
+	l.send(&liveMessage{Type: liveSubscribed, ID: s.id, Resource: msg.Resource, Query: msg.Query})
+
+	go l.follow(s)
+}
+
+// unsubscribe stops a subscription
+func (l *liveConn) unsubscribe(msg *liveMessage) {
+	l.mu.Lock()
+	s, ok := l.subscriptions[msg.ID]
+	if ok {
+		delete(l.subscriptions, msg.ID)
+		close(s.stop)
+		s.changes.Close()
+	}
+	l.mu.Unlock()
+
+	if !ok {
+		l.send(&liveMessage{Type: liveError, ID: msg.ID, Error: "subscription not found"})
+		return
+	}
+	l.send(&liveMessage{Type: liveUnsubscribed, ID: msg.ID})
+}
+
+// follow sends the changes of the subscription until it is stopped. Subscriptions which fall behind the changes of
+// the project close the connection.
+func (l *liveConn) follow(s *liveSubscription) {
+	for change := range s.changes.C {
+		if msg := s.notification(change); msg != nil {
+			l.send(msg)
+		}
+	}
+
+	select {
+	case <-s.stop:
+	default:
+		l.close()
+	}
+}
+
+// notification returns the message of a change of a document for the subscription, nil if the document neither matches
+// nor matched the filter
+func (s *liveSubscription) notification(change *events.Change) *liveMessage {
+	id := change.DocumentID
+	doc := map[string]interface{}{}
+
+	matches := false
+	if change.Action != "delete" && json.Unmarshal(change.Data, &doc) == nil {
+		matches = matchFilter(s.filter, doc)
+	}
+
+	if matches {
+		msgType := liveChanged
+		if !s.matched[id] {
+			msgType = liveAdded
+			s.matched[id] = true
+		}
+		s.permissions.Strip(doc, s.role)
+		return &liveMessage{Type: msgType, ID: s.id, Change: change.ID, DocumentID: id, Document: doc}
+	}
+
+	if s.matched[id] {
+		delete(s.matched, id)
+		return &liveMessage{Type: liveRemoved, ID: s.id, Change: change.ID, DocumentID: id}
+	}
+	return nil
+}
@@ -0,0 +1,99 @@
+package documents
+
+import (
+	"net/url"
+	"testing"
+
+	"github.com/machinable/machinable/dsi/models"
+	"github.com/machinable/machinable/events"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestQueryFilter(t *testing.T) {
+	def := &models.ResourceDefinition{Schema: `{
+		"type": "object",
+		"properties": {
+			"name": {"type": "string"},
+			"age": {"type": "integer"},
+			"location": {"type": "object", "format": "geopoint"}
+		}
+	}`}
+	schema, _ := def.GetSchema()
+
+	filter, geo, err := queryFilter(url.Values{"name": {"rex"}, "_limit": {"5"}, "near": {"40.7,-74.0"}, "within": {"5km"}}, def, schema, nil, "")
+	assert.Nil(t, err)
+	assert.Equal(t, "rex", filter["name"])
+	assert.Equal(t, geo, filter["location"])
+	assert.Equal(t, 5000.0, geo.Within)
+
+	_, _, err = queryFilter(url.Values{"color": {"brown"}}, def, schema, nil, "")
+	assert.NotNil(t, err)
+}
+
+func TestMatchFilter(t *testing.T) {
+	doc := map[string]interface{}{
+		"name":     "rex",
+		"age":      3.0,
+		"good":     true,
+		"location": map[string]interface{}{"lat": 40.71, "lon": -74.0},
+		"owner":    nil,
+	}
+
+	tables := []struct {
+		filter   map[string]interface{}
+		expected bool
+	}{
+		{map[string]interface{}{}, true},
+		{map[string]interface{}{"name": "rex", "age": "3", "good": "true"}, true},
+		{map[string]interface{}{"age": "3.0"}, false},
+		{map[string]interface{}{"name": "fido"}, false},
+		{map[string]interface{}{"owner": "null"}, false},
+		{map[string]interface{}{"missing": "rex"}, false},
+		{map[string]interface{}{"location": &models.GeoFilter{Near: &models.GeoPoint{Lat: 40.7, Lon: -74.0}, Within: 5000}}, true},
+		{map[string]interface{}{"location": &models.GeoFilter{Near: &models.GeoPoint{Lat: 41.7, Lon: -74.0}, Within: 5000}}, false},
+	}
+
+	for i, tt := range tables {
+		assert.Equal(t, tt.expected, matchFilter(tt.filter, doc), i)
+	}
+}
+
+func TestLiveNotification(t *testing.T) {
+	s := &liveSubscription{
+		id:      "puppies",
+		filter:  map[string]interface{}{"age": "1"},
+		matched: map[string]bool{},
+	}
+
+	change := func(id int64, action, data string) *events.Change {
+		return &events.Change{ID: id, Action: action, DocumentID: "a", Data: []byte(data)}
+	}
+
+	assert.Nil(t, s.notification(change(1, "create", `{"id": "a", "age": 2}`)), "documents which never matched are skipped")
+
+	msg := s.notification(change(2, "edit", `{"id": "a", "age": 1}`))
+	if assert.NotNil(t, msg) {
+		assert.Equal(t, liveAdded, msg.Type)
+		assert.Equal(t, "puppies", msg.ID)
+		assert.Equal(t, int64(2), msg.Change)
+	}
+
+	msg = s.notification(change(3, "edit", `{"id": "a", "age": 1, "name": "rex"}`))
+	if assert.NotNil(t, msg) {
+		assert.Equal(t, liveChanged, msg.Type)
+		assert.Equal(t, "rex", msg.Document["name"])
+	}
+
+	msg = s.notification(change(4, "edit", `{"id": "a", "age": 2}`))
+	if assert.NotNil(t, msg) {
+		assert.Equal(t, liveRemoved, msg.Type)
+		assert.Equal(t, "a", msg.DocumentID)
+		assert.Nil(t, msg.Document)
+	}
+
+	s.notification(change(5, "edit", `{"id": "a", "age": 1}`))
+	msg = s.notification(change(6, "delete", ``))
+	if assert.NotNil(t, msg) {
+		assert.Equal(t, liveRemoved, msg.Type)
+	}
+}
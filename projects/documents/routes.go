@@ -7,26 +7,54 @@ import (
 	"github.com/machinable/machinable/dsi/interfaces"
 	"github.com/machinable/machinable/events"
 	"github.com/machinable/machinable/middleware"
+	"github.com/machinable/machinable/storage"
 )
 
 // SetRoutes sets all of the appropriate routes to handlers for project collections
 func SetRoutes(engine *gin.Engine, datastore interfaces.Datastore, cache redis.UniversalClient, processor *events.Processor, config *config.AppConfig) error {
 	// create new Resources handler with datastore
-	handler := New(datastore)
+	handler := New(datastore, storage.NewLocal(config.GetFileStoragePath()), processor.Changes())
 
-	// project/user routes
+	// project/user routes, the change log shares the route of listing documents but can read every resource and root
+	// key of the project
 	api := engine.Group("/api")
 	api.Use(middleware.ResourceStatsMiddleware(datastore, processor))
-	api.Use(middleware.ProjectUserAuthzMiddleware(datastore, config))
+	api.Use(middleware.Branch(middleware.ChangesRequest,
+		middleware.ProjectRequesterAuthzMiddleware(datastore, config),
+		middleware.ProjectUserAuthzMiddleware(datastore, config),
+	))
 	api.Use(middleware.RequestRateLimit(datastore, cache))
-	api.Use(middleware.ProjectAuthzBuildFiltersMiddleware(datastore))
+	api.Use(middleware.Branch(middleware.ChangesRequest, nil, middleware.ProjectAuthzBuildFiltersMiddleware(datastore)))
+	api.Use(middleware.IdempotencyMiddleware(cache, config.GetIdempotencyWindow()))
 
 	api.POST("/:resourcePathName", handler.AddObject)
-	api.GET("/:resourcePathName", handler.ListObjects)
-	api.GET("/:resourcePathName/:resourceID", handler.GetObject)
+	api.GET("/:resourcePathName", handler.ListObjects)           // `_changes` lists the change log, see `ListChanges`
+	api.GET("/:resourcePathName/:resourceID", handler.GetObject) // `_stream` streams changes, see `StreamObjects`
 	api.PUT("/:resourcePathName/:resourceID", handler.PutObject)
 	api.DELETE("/:resourcePathName/:resourceID", handler.DeleteObject)
 
+	// validation of documents, which are dry runs before any other middleware
+	validate := engine.Group("/api")
+	validate.Use(middleware.DryRunMiddleware())
+	validate.Use(middleware.ResourceStatsMiddleware(datastore, processor))
+	validate.Use(middleware.ProjectUserAuthzMiddleware(datastore, config))
+	validate.Use(middleware.RequestRateLimit(datastore, cache))
+	validate.Use(middleware.ProjectAuthzBuildFiltersMiddleware(datastore))
+	validate.POST("/:resourcePathName/_validate", handler.ValidateObject)
+
+	// document files
+	api.GET("/:resourcePathName/:resourceID/files", handler.ListFiles)
+	api.GET("/:resourcePathName/:resourceID/files/:field", handler.GetFile)
+	api.PUT("/:resourcePathName/:resourceID/files/:field", handler.PutFile)
+	api.DELETE("/:resourcePathName/:resourceID/files/:field", handler.DeleteFile)
+
+	// live queries over WebSocket, which can subscribe to every resource of the project
+	engine.GET("/live",
+		middleware.ProjectRequesterAuthzMiddleware(datastore, config),
+		middleware.RequestRateLimit(datastore, cache),
+		handler.LiveQueries,
+	)
+
 	// App mgmt routes with different authz policy
 	mgmt := engine.Group("/mgmt")
 	mgmt.Use(middleware.AppUserJwtAuthzMiddleware(config))
@@ -0,0 +1,26 @@
+package documents
+
+import (
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/machinable/machinable/config"
+	"github.com/machinable/machinable/events"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSetRoutes(t *testing.T) {
+	gin.SetMode(gin.ReleaseMode)
+	engine := gin.New()
+	assert.Nil(t, SetRoutes(engine, nil, nil, events.NewProcessor(nil, nil, nil), &config.AppConfig{}))
+
+	routes := map[string]string{}
+	for _, route := range engine.Routes() {
+		routes[route.Method+" "+route.Path] = route.Handler
+	}
+
+	// the change log and streams share the routes of documents, see `ListObjects` and `GetObject`
+	assert.Contains(t, routes["GET /api/:resourcePathName"], "ListObjects")
+	assert.Contains(t, routes["GET /api/:resourcePathName/:resourceID"], "GetObject")
+	assert.Contains(t, routes["POST /api/:resourcePathName/_validate"], "ValidateObject")
+}
@@ -0,0 +1,52 @@
+package documents
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/machinable/machinable/dsi/models"
+	"github.com/machinable/machinable/events"
+)
+
+// streamPath is the document path of the change stream of a resource, `/api/{resource}/_stream`
+const streamPath = "_stream"
+
+// StreamObjects streams the creates, edits and deletes of the documents of the resource as Server-Sent Events. Requesters
+// limited to the documents they created only receive the changes of those documents, without the fields they cannot read.
+func (h *Documents) StreamObjects(c *gin.Context) {
+	resourcePathName := c.Param("resourcePathName")
+	projectID := c.MustGet("projectId").(string)
+	authFilters := c.MustGet("filters").(map[string]interface{})
+
+	permissions, role, err := h.fieldAccess(c, projectID, resourcePathName)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	creator, _ := authFilters["_metadata.creator"].(string)
+	filter := func(change *events.Change) bool {
+		return change.Entity == models.EndpointResource &&
+			change.EntityKey == resourcePathName &&
+			(creator == "" || change.Creator == creator)
+	}
+
+	render := func(change *events.Change) *events.Change {
+		if len(permissions) == 0 || len(change.Data) == 0 {
+			return change
+		}
+
+		doc := map[string]interface{}{}
+		if err := json.Unmarshal(change.Data, &doc); err != nil {
+			return change
+		}
+		permissions.Strip(doc, role)
+
+		stripped := *change
+		stripped.Data, _ = json.Marshal(doc)
+		return &stripped
+	}
+
+	events.ServeSSE(c, h.changes, projectID, filter, render)
+}
@@ -0,0 +1,47 @@
+package documents
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/machinable/machinable/dsi/models"
+)
+
+// ValidateObject validates a new document of the resource definition without saving it. This is the same as
+// `AddObject` with `?dry_run=true`.
+func (h *Documents) ValidateObject(c *gin.Context) {
+	h.AddObject(c)
+}
+
+// dryRun completes a write request without saving anything, responding with the result of the validation of the
+// document. `permErr` is the result of the field permission checks of the write.
+func (h *Documents) dryRun(c *gin.Context, projectID, resourcePathName string, obj models.ResourceObject, permErr error) {
+	if permErr != nil {
+		writeValidationResult(c, http.StatusForbidden, permErr)
+		return
+	}
+
+	def, err := h.definition(c, projectID, resourcePathName)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	// resources do not define uniqueness or reference constraints, so the schema is the only remaining check
+	if err := obj.Validate(def); err != nil {
+		writeValidationResult(c, http.StatusBadRequest, err)
+		return
+	}
+
+	writeValidationResult(c, http.StatusOK, nil)
+}
+
+// writeValidationResult responds with the result of a dry run, with the status code the write would have returned
+func writeValidationResult(c *gin.Context, code int, err error) {
+	errs := models.AsValidationErrors(err)
+	if errs == nil {
+		errs = models.ValidationErrors{}
+	}
+
+	c.JSON(code, gin.H{"valid": err == nil, "errors": errs})
+}
@@ -2,22 +2,30 @@ package hooks
 
 import (
 	"net/http"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/machinable/machinable/dsi/interfaces"
 	"github.com/machinable/machinable/dsi/models"
+	"github.com/machinable/machinable/events"
+	"github.com/machinable/machinable/signing"
+	uuid "github.com/satori/go.uuid"
 )
 
-// New returns a pointer to a new `APIKeys` struct
-func New(db interfaces.ProjectHooksDatastore) *WebHooks {
+// New returns a pointer to a new `APIKeys` struct. Test events are sent with the hook `timeout`.
+func New(db interfaces.Datastore, processor *events.Processor, timeout time.Duration) *WebHooks {
 	return &WebHooks{
-		store: db,
+		store:     db,
+		processor: processor,
+		client:    &http.Client{Timeout: timeout},
 	}
 }
 
 // WebHooks wraps the datastore and any HTTP handlers for project web hooks
 type WebHooks struct {
-	store interfaces.ProjectHooksDatastore
+	store     interfaces.Datastore
+	processor *events.Processor
+	client    *http.Client
 }
 
 // UpdateHook updates an existing project webhook by id and and project id
@@ -45,7 +53,8 @@ func (w *WebHooks) UpdateHook(c *gin.Context) {
 	c.JSON(http.StatusOK, gin.H{})
 }
 
-// AddHook creates a new webhook for a project
+// AddHook creates a new webhook for a project. The signing secret of the hook is generated, and only returned in this
+// response.
 func (w *WebHooks) AddHook(c *gin.Context) {
 	projectID := c.MustGet("projectId").(string)
 
@@ -59,6 +68,13 @@ func (w *WebHooks) AddHook(c *gin.Context) {
 		return
 	}
 
+	secret, serr := signing.NewSecret()
+	if serr != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to generate signing secret"})
+		return
+	}
+	hook.Secret = secret
+
 	// save hook to database for project
 	err := w.store.AddHook(projectID, &hook)
 	if err != nil {
@@ -66,7 +82,28 @@ func (w *WebHooks) AddHook(c *gin.Context) {
 		return
 	}
 
-	c.JSON(http.StatusCreated, gin.H{"hook": &hook})
+	c.JSON(http.StatusCreated, gin.H{"hook": &hook, "secret": secret})
+}
+
+// RotateSecret replaces the signing secret of a webhook, returning the new secret. Deliveries are signed with the new
+// secret from then on, including retries of earlier events.
+func (w *WebHooks) RotateSecret(c *gin.Context) {
+	hookID := c.Param("hookID")
+	projectID := c.MustGet("projectId").(string)
+
+	secret, serr := signing.NewSecret()
+	if serr != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to generate signing secret"})
+		return
+	}
+
+	err := w.store.UpdateHookSecret(projectID, hookID, secret)
+	if err != nil {
+		c.JSON(err.Code(), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"secret": secret})
 }
 
 // ListHooks lists all webhooks for a project
@@ -124,3 +161,154 @@ func (w *WebHooks) DeleteHook(c *gin.Context) {
 
 	c.JSON(http.StatusNoContent, gin.H{})
 }
+
+// ListFailures lists the deliveries of a webhook which failed every attempt, with their payload and attempts
+func (w *WebHooks) ListFailures(c *gin.Context) {
+	hookID := c.Param("hookID")
+	projectID := c.MustGet("projectId").(string)
+
+	failures, err := w.store.ListFailures(projectID, hookID)
+	if err != nil {
+		c.JSON(err.Code(), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"items": failures})
+}
+
+// ReplayFailure queues a failed delivery of a webhook again, to the current URL and headers of the hook. The delivery
+// is removed from the failures, and kept again if every attempt of the replay fails.
+func (w *WebHooks) ReplayFailure(c *gin.Context) {
+	hookID := c.Param("hookID")
+	failureID := c.Param("failureID")
+	projectID := c.MustGet("projectId").(string)
+
+	hook, err := w.store.GetHook(projectID, hookID)
+	if err != nil {
+		c.JSON(err.Code(), gin.H{"error": err.Error()})
+		return
+	}
+
+	failure, err := w.store.GetFailure(projectID, hookID, failureID)
+	if err != nil {
+		c.JSON(err.Code(), gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := w.replay(hook, failure); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusAccepted, gin.H{})
+}
+
+// ReplayFailures queues every failed delivery of a webhook again, see `ReplayFailure`
+func (w *WebHooks) ReplayFailures(c *gin.Context) {
+	hookID := c.Param("hookID")
+	projectID := c.MustGet("projectId").(string)
+
+	hook, err := w.store.GetHook(projectID, hookID)
+	if err != nil {
+		c.JSON(err.Code(), gin.H{"error": err.Error()})
+		return
+	}
+
+	failures, err := w.store.ListFailures(projectID, hookID)
+	if err != nil {
+		c.JSON(err.Code(), gin.H{"error": err.Error()})
+		return
+	}
+
+	replayed := 0
+	for _, failure := range failures {
+		if err := w.replay(hook, failure); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error(), "replayed": replayed})
+			return
+		}
+		replayed++
+	}
+
+	c.JSON(http.StatusAccepted, gin.H{"replayed": replayed})
+}
+
+// DeleteFailure discards a failed delivery of a webhook
+func (w *WebHooks) DeleteFailure(c *gin.Context) {
+	hookID := c.Param("hookID")
+	failureID := c.Param("failureID")
+	projectID := c.MustGet("projectId").(string)
+
+	err := w.store.DeleteFailure(projectID, hookID, failureID)
+	if err != nil {
+		c.JSON(err.Code(), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusNoContent, gin.H{})
+}
+
+// replay queues the failed delivery and removes it from the failures
+func (w *WebHooks) replay(hook *models.WebHook, failure *models.HookFailure) error {
+	if err := w.processor.ReplayFailure(hook, failure); err != nil {
+		return err
+	}
+	if err := w.store.DeleteFailure(failure.ProjectID, failure.WebHookID, failure.ID); err != nil {
+		return err
+	}
+	return nil
+}
+
+// TestHook sends a synthetic event to a webhook, with a payload of the entity and event of the hook, and returns the
+// result of the delivery once the receiver responds. The result is recorded with the results of the hook, but test
+// events are not retried.
+func (w *WebHooks) TestHook(c *gin.Context) {
+	hookID := c.Param("hookID")
+	projectID := c.MustGet("projectId").(string)
+
+	hook, err := w.store.GetHook(projectID, hookID)
+	if err != nil {
+		c.JSON(err.Code(), gin.H{"error": err.Error()})
+		return
+	}
+
+	secret, err := w.store.GetHookSecret(projectID, hookID)
+	if err != nil {
+		c.JSON(err.Code(), gin.H{"error": err.Error()})
+		return
+	}
+
+	// the first event of the hook, or the one chosen with the `event` query parameter
+	event := c.Query("event")
+	if event == "" && len(hook.HookEvents) > 0 {
+		event = hook.HookEvents[0]
+	}
+	if event != models.HookCreate && event != models.HookEdit && event != models.HookDelete {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid hook event"})
+		return
+	}
+
+	sample, serr := w.sampleEvent(projectID, hook, event)
+	if serr != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": serr.Error()})
+		return
+	}
+	sample.AuthType = c.GetString("authType")
+
+	hookEvent := &events.HookEvent{
+		ID:        uuid.NewV4().String(),
+		Attempt:   1,
+		Hook:      hook,
+		Event:     event,
+		EntityKey: sample.EntityKey,
+		Payload:   events.NewEnvelope(sample),
+		Test:      true,
+	}
+
+	result := events.Deliver(w.client, hookEvent, secret)
+	if err := w.store.AddResult(result); err != nil {
+		c.JSON(err.Code(), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"result": result})
+}
@@ -4,6 +4,7 @@ import (
 	"github.com/gin-gonic/gin"
 	"github.com/machinable/machinable/config"
 	"github.com/machinable/machinable/dsi/interfaces"
+	"github.com/machinable/machinable/events"
 	"github.com/machinable/machinable/middleware"
 )
 
@@ -15,12 +16,18 @@ type Handler interface {
 	GetHook(c *gin.Context)
 	DeleteHook(c *gin.Context)
 	ListResults(c *gin.Context)
+	RotateSecret(c *gin.Context)
+	ListFailures(c *gin.Context)
+	ReplayFailure(c *gin.Context)
+	ReplayFailures(c *gin.Context)
+	DeleteFailure(c *gin.Context)
+	TestHook(c *gin.Context)
 }
 
 // SetRoutes sets all of the appropriate routes to handlers for project users
-func SetRoutes(engine *gin.Engine, datastore interfaces.Datastore, config *config.AppConfig) error {
+func SetRoutes(engine *gin.Engine, datastore interfaces.Datastore, processor *events.Processor, config *config.AppConfig) error {
 	// create new Resources handler with datastore
-	handler := New(datastore)
+	handler := New(datastore, processor, config.GetHookTimeout())
 
 	// di for testing
 	return setRoutes(
@@ -37,12 +44,19 @@ func setRoutes(engine *gin.Engine, handler Handler, datastore interfaces.Project
 	keys := engine.Group("/hooks")
 	keys.Use(mw...)
 
-	keys.GET("/", handler.ListHooks)                  // get list of project web hooks
-	keys.POST("/", handler.AddHook)                   // create a new project web hook
-	keys.DELETE("/:hookID", handler.DeleteHook)       // delete a project web hook
-	keys.PUT("/:hookID", handler.UpdateHook)          // update a project web hook
-	keys.GET("/:hookID", handler.GetHook)             // get a project web hook
-	keys.GET("/:hookID/results", handler.ListResults) // get list of hook results
+	keys.GET("/", handler.ListHooks)                   // get list of project web hooks
+	keys.POST("/", handler.AddHook)                    // create a new project web hook
+	keys.DELETE("/:hookID", handler.DeleteHook)        // delete a project web hook
+	keys.PUT("/:hookID", handler.UpdateHook)           // update a project web hook
+	keys.GET("/:hookID", handler.GetHook)              // get a project web hook
+	keys.GET("/:hookID/results", handler.ListResults)  // get list of hook results
+	keys.POST("/:hookID/secret", handler.RotateSecret) // rotate the signing secret of a hook
+	keys.POST("/:hookID/test", handler.TestHook)       // send a test event and return the result
+
+	keys.GET("/:hookID/failed", handler.ListFailures)                     // get list of failed deliveries
+	keys.POST("/:hookID/replay", handler.ReplayFailures)                  // replay every failed delivery
+	keys.POST("/:hookID/failed/:failureID/replay", handler.ReplayFailure) // replay a failed delivery
+	keys.DELETE("/:hookID/failed/:failureID", handler.DeleteFailure)      // discard a failed delivery
 
 	return nil
 }
@@ -0,0 +1,188 @@
+package hooks
+
+import (
+	"encoding/json"
+	"errors"
+	"sort"
+	"time"
+
+	"github.com/machinable/machinable/dsi/models"
+	"github.com/machinable/machinable/events"
+	uuid "github.com/satori/go.uuid"
+)
+
+// sampleEvent returns an event of the entity of the hook for a test event. Resource documents are generated from the
+// resource schema, JSON trees are sampled from their current data at the path of the hook. Hooks of every resource or
+// root key sample the first one. Deletes have the sampled value as their previous value.
+func (w *WebHooks) sampleEvent(projectID string, hook *models.WebHook, event string) (*events.Event, error) {
+	e := &events.Event{
+		ID:         uuid.NewV4().String(),
+		Project:    &models.ProjectDetail{ID: projectID},
+		Entity:     hook.Entity,
+		Action:     event,
+		OccurredAt: time.Now(),
+	}
+
+	var value interface{}
+	switch hook.Entity {
+	case models.EndpointResource:
+		defs, err := w.store.ListDefinitions(projectID)
+		if err != nil {
+			return nil, errors.New("could not retrieve resource definitions")
+		}
+		for _, def := range defs {
+			if hook.EntityID != "" && def.ID != hook.EntityID {
+				continue
+			}
+
+			schema, serr := def.GetSchema()
+			if serr != nil {
+				return nil, errors.New("error getting schema property types")
+			}
+			doc := sampleDocument(schema, time.Now())
+			e.EntityID = def.ID
+			e.EntityKey = def.PathName
+			e.DocumentID, _ = doc["id"].(string)
+			value = doc
+			break
+		}
+		if e.EntityKey == "" {
+			return nil, errors.New("resource of the hook does not exist")
+		}
+	case models.EndpointJSON:
+		roots, err := w.store.ListRootKeys(projectID)
+		if err != nil {
+			return nil, errors.New("could not retrieve root keys")
+		}
+		for _, root := range roots {
+			if hook.EntityID != "" && root.ID != hook.EntityID {
+				continue
+			}
+
+			keys, err := models.ParseJSONPointer(hook.Path)
+			if err != nil {
+				return nil, err
+			}
+
+			var data interface{}
+			if b, err := w.store.GetJSONKey(projectID, root.Key, keys...); err == nil {
+				json.Unmarshal(b, &data)
+			}
+
+			if len(keys) == 0 {
+				keys, data = sampleKey(data)
+			}
+			e.EntityID = root.ID
+			e.EntityKey = root.Key
+			e.Keys = keys
+			value = data
+			break
+		}
+		if e.EntityKey == "" {
+			return nil, errors.New("root key of the hook does not exist")
+		}
+	default:
+		return nil, errors.New("unknown hook entity")
+	}
+
+	b, err := json.Marshal(value)
+	if err != nil {
+		return nil, err
+	}
+	if event == models.HookDelete {
+		e.Previous = b
+	} else {
+		e.Data = b
+	}
+	return e, nil
+}
+
+// sampleDocument returns a document with a value for every property of the schema, and the fields the datastore adds
+func sampleDocument(schema *models.JSONSchemaObject, created time.Time) map[string]interface{} {
+	doc := map[string]interface{}{}
+	for name, property := range schema.Properties {
+		doc[name] = sampleValue(property)
+	}
+
+	doc["id"] = uuid.NewV4().String()
+	doc["_metadata"] = map[string]interface{}{
+		"creator":      uuid.NewV4().String(),
+		"creator_type": "user",
+		"created":      created.Unix(),
+	}
+	return doc
+}
+
+// sampleValue returns a value of a schema property, its example, default or first enum value if it has one
+func sampleValue(property map[string]interface{}) interface{} {
+	if examples, ok := property["examples"].([]interface{}); ok && len(examples) > 0 {
+		return examples[0]
+	}
+	for _, keyword := range []string{"example", "default", "const"} {
+		if v, ok := property[keyword]; ok {
+			return v
+		}
+	}
+	if enum, ok := property["enum"].([]interface{}); ok && len(enum) > 0 {
+		return enum[0]
+	}
+
+	format, _ := property["format"].(string)
+	switch property["type"] {
+	case "string":
+		switch format {
+		case "date-time":
+			return time.Now().UTC().Format(time.RFC3339)
+		case "date":
+			return time.Now().UTC().Format("2006-01-02")
+		case "email":
+			return "jane@example.com"
+		case "uri", "url":
+			return "https://example.com"
+		case "uuid":
+			return uuid.NewV4().String()
+		}
+		return "string"
+	case "integer":
+		return 42
+	case "number":
+		return 4.2
+	case "boolean":
+		return true
+	case "array":
+		if items, ok := property["items"].(map[string]interface{}); ok {
+			return []interface{}{sampleValue(items)}
+		}
+		return []interface{}{}
+	case "object":
+		if format == "geopoint" {
+			return map[string]interface{}{"lat": 40.7128, "lon": -74.006}
+		}
+		obj := map[string]interface{}{}
+		if properties, ok := property["properties"].(map[string]interface{}); ok {
+			for name, p := range properties {
+				if p, ok := p.(map[string]interface{}); ok {
+					obj[name] = sampleValue(p)
+				}
+			}
+		}
+		return obj
+	}
+	return nil
+}
+
+// sampleKey returns the first key of an object and its value, as a write of that key would send them, or no keys and
+// the whole value
+func sampleKey(data interface{}) ([]string, interface{}) {
+	obj, ok := data.(map[string]interface{})
+	if !ok || len(obj) == 0 {
+		return []string{}, data
+	}
+
+	keys := make([]string, 0, len(obj))
+	for key := range obj {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return []string{keys[0]}, obj[keys[0]]
+}
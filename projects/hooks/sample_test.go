@@ -0,0 +1,48 @@
+package hooks
+
+import (
+	"testing"
+	"time"
+
+	"github.com/machinable/machinable/dsi/models"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSampleDocument(t *testing.T) {
+	def := &models.ResourceDefinition{Schema: `{
+		"type": "object",
+		"properties": {
+			"name": {"type": "string", "example": "rex"},
+			"breed": {"type": "string", "enum": ["lab", "pug"]},
+			"age": {"type": "integer"},
+			"good": {"type": "boolean"},
+			"tags": {"type": "array", "items": {"type": "string"}},
+			"location": {"type": "object", "format": "geopoint"},
+			"owner": {"type": "object", "properties": {"email": {"type": "string", "format": "email"}}}
+		}
+	}`}
+	schema, err := def.GetSchema()
+	assert.Nil(t, err)
+
+	created := time.Unix(1580753521, 0)
+	doc := sampleDocument(schema, created)
+	assert.Equal(t, "rex", doc["name"])
+	assert.Equal(t, "lab", doc["breed"])
+	assert.Equal(t, 42, doc["age"])
+	assert.Equal(t, true, doc["good"])
+	assert.Equal(t, []interface{}{"string"}, doc["tags"])
+	assert.Equal(t, map[string]interface{}{"lat": 40.7128, "lon": -74.006}, doc["location"])
+	assert.Equal(t, map[string]interface{}{"email": "jane@example.com"}, doc["owner"])
+	assert.NotEmpty(t, doc["id"])
+	assert.Equal(t, int64(1580753521), doc["_metadata"].(map[string]interface{})["created"])
+}
+
+func TestSampleKey(t *testing.T) {
+	keys, value := sampleKey(map[string]interface{}{"dogs": []interface{}{"rex"}, "cats": 2.0})
+	assert.Equal(t, []string{"cats"}, keys)
+	assert.Equal(t, 2.0, value)
+
+	keys, value = sampleKey("rex")
+	assert.Empty(t, keys)
+	assert.Equal(t, "rex", value)
+}
@@ -0,0 +1,158 @@
+package jsontree
+
+import (
+	"database/sql"
+	"encoding/json"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/machinable/machinable/dsi/models"
+)
+
+// snapshot takes an automatic snapshot of the root key before a write which replaces or removes data
+func (h *Handlers) snapshot(projectID, rootKey string) error {
+	_, err := h.db.CreateJSONSnapshot(projectID, rootKey, models.SnapshotWrite, 0, h.snapshotRetention)
+	return err
+}
+
+// ListSnapshots returns the snapshots of a root key, latest first. Snapshots of deleted root keys are listed until
+// they expire.
+func (h *Handlers) ListSnapshots(c *gin.Context) {
+	rootKey := c.Param("rootKey")
+	projectID := c.MustGet("projectId").(string)
+
+	snapshots, err := h.db.ListJSONSnapshots(projectID, rootKey)
+	if err != nil {
+		tErr := h.db.TranslateError(err)
+		c.JSON(tErr.Code, gin.H{"error": tErr.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"items": snapshots})
+}
+
+// CreateSnapshot takes a manual snapshot of a root key, which is kept until it is deleted
+func (h *Handlers) CreateSnapshot(c *gin.Context) {
+	rootKey := c.Param("rootKey")
+	projectID := c.MustGet("projectId").(string)
+
+	snapshot, err := h.db.CreateJSONSnapshot(projectID, rootKey, models.SnapshotManual, 0, 0)
+	if err != nil {
+		tErr := h.db.TranslateError(err)
+		c.JSON(tErr.Code, gin.H{"error": tErr.Error()})
+		return
+	}
+
+	c.JSON(http.StatusCreated, snapshot)
+}
+
+// GetSnapshot returns a snapshot of a root key, including its tree and settings
+func (h *Handlers) GetSnapshot(c *gin.Context) {
+	rootKey := c.Param("rootKey")
+	snapshotID := c.Param("snapshotID")
+	projectID := c.MustGet("projectId").(string)
+
+	snapshot, err := h.db.GetJSONSnapshot(projectID, rootKey, snapshotID)
+	if err != nil {
+		tErr := h.db.TranslateError(err)
+		c.JSON(tErr.Code, gin.H{"error": tErr.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, snapshot)
+}
+
+// DeleteSnapshot permanently removes a snapshot of a root key
+func (h *Handlers) DeleteSnapshot(c *gin.Context) {
+	rootKey := c.Param("rootKey")
+	snapshotID := c.Param("snapshotID")
+	projectID := c.MustGet("projectId").(string)
+
+	err := h.db.DeleteJSONSnapshot(projectID, rootKey, snapshotID)
+	if err != nil {
+		tErr := h.db.TranslateError(err)
+		c.JSON(tErr.Code, gin.H{"error": tErr.Error()})
+		return
+	}
+
+	c.JSON(http.StatusNoContent, gin.H{})
+}
+
+// DiffSnapshot returns the changes from a snapshot to another snapshot, with the `to` query parameter, or to the
+// current tree. The current tree of a deleted root key is `null`.
+func (h *Handlers) DiffSnapshot(c *gin.Context) {
+	rootKey := c.Param("rootKey")
+	snapshotID := c.Param("snapshotID")
+	projectID := c.MustGet("projectId").(string)
+
+	from, err := h.db.GetJSONSnapshot(projectID, rootKey, snapshotID)
+	if err != nil {
+		tErr := h.db.TranslateError(err)
+		c.JSON(tErr.Code, gin.H{"error": tErr.Error()})
+		return
+	}
+
+	to := "current"
+	var toData []byte
+	if toID := c.Query("to"); toID != "" {
+		snapshot, err := h.db.GetJSONSnapshot(projectID, rootKey, toID)
+		if err != nil {
+			tErr := h.db.TranslateError(err)
+			c.JSON(tErr.Code, gin.H{"error": tErr.Error()})
+			return
+		}
+		to = snapshot.ID
+		toData = snapshot.Data
+	} else {
+		toData, err = h.db.GetJSONKey(projectID, rootKey)
+		if err == sql.ErrNoRows {
+			toData = []byte("null")
+		} else if err != nil {
+			tErr := h.db.TranslateError(err)
+			c.JSON(tErr.Code, gin.H{"error": tErr.Error()})
+			return
+		}
+	}
+
+	var fromTree, toTree interface{}
+	json.Unmarshal(from.Data, &fromTree)
+	json.Unmarshal(toData, &toTree)
+
+	c.JSON(http.StatusOK, gin.H{"from": from.ID, "to": to, "changes": models.DiffJSON(fromTree, toTree)})
+}
+
+// RestoreSnapshot replaces the tree of a root key with a snapshot, after taking a snapshot of the current tree. The
+// restored tree must match the current schema. Deleted root keys are recreated with the settings of the snapshot.
+func (h *Handlers) RestoreSnapshot(c *gin.Context) {
+	rootKey := c.Param("rootKey")
+	snapshotID := c.Param("snapshotID")
+	projectID := c.MustGet("projectId").(string)
+
+	snapshot, err := h.db.GetJSONSnapshot(projectID, rootKey, snapshotID)
+	if err != nil {
+		tErr := h.db.TranslateError(err)
+		c.JSON(tErr.Code, gin.H{"error": tErr.Error()})
+		return
+	}
+
+	key, err := h.db.GetRootKey(projectID, rootKey)
+	if err == sql.ErrNoRows {
+		err = h.db.CreateRootKey(projectID, rootKey, snapshot.Data)
+		if err == nil && snapshot.Settings != nil {
+			err = h.db.UpdateRootKey(projectID, snapshot.Settings)
+		}
+	} else if err == nil {
+		err = h.snapshot(projectID, rootKey)
+		if err == nil {
+			err = h.db.UpdateJSONKey(projectID, rootKey, snapshot.Data, key.Validator())
+		}
+	}
+	if err != nil {
+		h.writeError(c, rootKey, err)
+		return
+	}
+
+	var tree interface{}
+	json.Unmarshal(snapshot.Data, &tree)
+	c.JSON(http.StatusOK, tree)
+}
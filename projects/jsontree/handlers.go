@@ -4,21 +4,33 @@ import (
 	"encoding/json"
 	"net/http"
 	"strings"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/machinable/machinable/dsi/interfaces"
 	"github.com/machinable/machinable/dsi/models"
+	"github.com/machinable/machinable/events"
+	"github.com/machinable/machinable/middleware"
+	"github.com/machinable/machinable/rules"
 )
 
 // Handlers contains all handler functions
 type Handlers struct {
 	db interfaces.Datastore
+	// snapshotRetention is the number of automatic snapshots kept for each root key
+	snapshotRetention int
+	// deleteGracePeriod is how long the snapshot of a deleted root key is kept
+	deleteGracePeriod time.Duration
+	changes           *events.Broker
 }
 
-// NewHandlers creates and returns a new instance of `Handlers` with the datastore
-func NewHandlers(datastore interfaces.Datastore) *Handlers {
+// NewHandlers creates and returns a new instance of `Handlers` with the datastore, snapshot retention and change streams
+func NewHandlers(datastore interfaces.Datastore, snapshotRetention int, deleteGracePeriod time.Duration, changes *events.Broker) *Handlers {
 	return &Handlers{
-		db: datastore,
+		db:                datastore,
+		snapshotRetention: snapshotRetention,
+		deleteGracePeriod: deleteGracePeriod,
+		changes:           changes,
 	}
 }
 
@@ -36,7 +48,7 @@ func (h *Handlers) ListRootKeys(c *gin.Context) {
 	c.JSON(http.StatusOK, gin.H{"items": rootKeys})
 }
 
-// UpdateRootKey updates the access policies
+// UpdateRootKey updates the access policies and schema. The current tree must be valid against a new schema.
 func (h *Handlers) UpdateRootKey(c *gin.Context) {
 	rootKey := c.Param("rootKey")
 	projectID := c.MustGet("projectId").(string)
@@ -46,6 +58,28 @@ func (h *Handlers) UpdateRootKey(c *gin.Context) {
 
 	if keyData.Key != rootKey {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid key"})
+		return
+	}
+
+	if err := keyData.ValidateSchema(); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err := rules.Validate(keyData.Rules); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if keyData.HasSchema() {
+		tree, err := h.db.GetJSONKey(projectID, rootKey)
+		if err != nil {
+			tErr := h.db.TranslateError(err)
+			c.JSON(tErr.Code, gin.H{"error": tErr.Error()})
+			return
+		}
+		if err := keyData.ValidateTree(tree); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "the current tree does not match the schema", "errors": models.AsValidationErrors(err)})
+			return
+		}
 	}
 
 	err := h.db.UpdateRootKey(projectID, keyData)
@@ -96,12 +130,19 @@ func (h *Handlers) ReadRootKey(c *gin.Context) {
 	c.IndentedJSON(http.StatusOK, obj)
 }
 
-// DeleteRootKey deletes the entire rootKey
+// DeleteRootKey deletes the entire rootKey. A final snapshot is kept for the grace period, which can restore the root key.
 func (h *Handlers) DeleteRootKey(c *gin.Context) {
 	rootKey := c.Param("rootKey")
 	projectID := c.MustGet("projectId").(string)
 
-	err := h.db.DeleteRootKey(projectID, rootKey)
+	_, err := h.db.CreateJSONSnapshot(projectID, rootKey, models.SnapshotDelete, h.deleteGracePeriod, 0)
+	if err != nil {
+		tErr := h.db.TranslateError(err)
+		c.JSON(tErr.Code, gin.H{"error": tErr.Error()})
+		return
+	}
+
+	err = h.db.DeleteRootKey(projectID, rootKey)
 	if err != nil {
 		tErr := h.db.TranslateError(err)
 		c.JSON(tErr.Code, gin.H{"error": tErr.Error()})
@@ -111,14 +152,151 @@ func (h *Handlers) DeleteRootKey(c *gin.Context) {
 	c.JSON(http.StatusNoContent, gin.H{})
 }
 
-// ReadJSONKey retrieves the data stored at the key path provided by the HTTP path parameters
+// simulation is a request to simulate against the rules of a root key
+type simulation struct {
+	Method string                 `json:"method"`
+	Path   string                 `json:"path"`
+	Auth   map[string]interface{} `json:"auth"`
+	Data   json.RawMessage        `json:"data"`
+	Rules  []*models.JSONRule     `json:"rules"`
+}
+
+// SimulateRules evaluates the rules of the root key for a simulated request, without reading or writing the path.
+// Unsaved rules can be tested by including them in the request.
+func (h *Handlers) SimulateRules(c *gin.Context) {
+	rootKey := c.Param("rootKey")
+	projectID := c.MustGet("projectId").(string)
+
+	sim := &simulation{}
+	if err := c.BindJSON(sim); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	method := strings.ToUpper(sim.Method)
+	switch method {
+	case "GET", "POST", "PUT", "PATCH", "DELETE":
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid method, must be one of GET, POST, PUT, PATCH or DELETE"})
+		return
+	}
+
+	keys, err := models.ParseJSONPointer(strings.TrimRight(sim.Path, "/"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if sim.Rules == nil {
+		key, err := h.db.GetRootKey(projectID, rootKey)
+		if err != nil {
+			tErr := h.db.TranslateError(err)
+			c.JSON(tErr.Code, gin.H{"error": tErr.Error()})
+			return
+		}
+		sim.Rules = key.Rules
+	} else if err := rules.Validate(sim.Rules); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	req := &rules.Request{
+		Write: method != "GET",
+		Keys:  keys,
+		Auth:  sim.Auth,
+		Root: func() (interface{}, error) {
+			tree, err := h.db.GetJSONKey(projectID, rootKey)
+			if err != nil {
+				return nil, err
+			}
+			var root interface{}
+			return root, json.Unmarshal(tree, &root)
+		},
+	}
+	req.NewRoot = func() (interface{}, error) {
+		root, err := req.Root()
+		if err != nil {
+			return nil, err
+		}
+		return rules.NewRoot(root, method, keys, sim.Data)
+	}
+
+	allowed, results := rules.Check(sim.Rules, req)
+
+	c.JSON(http.StatusOK, gin.H{"allowed": allowed, "results": results})
+}
+
+// validator returns the validator of the root key loaded by the project authz middleware
+func (h *Handlers) validator(c *gin.Context, projectID, rootKey string) (models.JSONValidator, error) {
+	if key, ok := c.Get("jsonRootKey"); ok {
+		return key.(*models.RootKey).Validator(), nil
+	}
+
+	key, err := h.db.GetRootKey(projectID, rootKey)
+	if err != nil {
+		return nil, err
+	}
+	return key.Validator(), nil
+}
+
+// writeError responds with the error of a tree write. Trees which do not match the root key schema are rejected with
+// the same validation envelope as resource documents.
+func (h *Handlers) writeError(c *gin.Context, rootKey string, err error) {
+	if vErr, ok := err.(models.ValidationErrors); ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "failed to save " + rootKey, "errors": vErr})
+		return
+	}
+
+	tErr := h.db.TranslateError(err)
+	c.JSON(tErr.Code, gin.H{"error": tErr.Error()})
+}
+
+// jsonKeys parses the `keys` path parameter as a JSON Pointer (RFC 6901), i.e. `/dogs/0/a~1b`. Trailing slashes are
+// ignored, so `/` is the root of the tree.
+func jsonKeys(c *gin.Context) ([]string, error) {
+	return models.ParseJSONPointer(strings.TrimRight(c.Param("keys"), "/"))
+}
+
+// ReadJSONKey retrieves the data stored at the key path provided by the HTTP path parameters. The query parameters
+// `shallow`, `orderBy`, `limitToFirst`, `limitToLast`, `startAt` and `endAt` read part of an object, and `stream=true`
+// streams the changes of the path.
 func (h *Handlers) ReadJSONKey(c *gin.Context) {
 	rootKey := c.Param("rootKey")
 	projectID := c.MustGet("projectId").(string)
-	keys := c.Param("keys")
 
-	keys = strings.TrimRight(strings.TrimLeft(keys, "/"), "/")
-	byt, err := h.db.GetJSONKey(projectID, rootKey, strings.Split(keys, "/")...)
+	keys, err := jsonKeys(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if c.Query("stream") == "true" {
+		h.streamJSONKey(c, projectID, rootKey, keys)
+		return
+	}
+
+	query, err := jsonQuery(c.Request.URL.Query())
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if query != nil {
+		byt, err := h.db.QueryJSONKey(projectID, rootKey, query, keys...)
+		if err != nil {
+			tErr := h.db.TranslateError(err)
+			c.JSON(tErr.Code, gin.H{"error": tErr.Error()})
+			return
+		}
+		if byt == nil {
+			byt = []byte("null")
+		}
+
+		// written as is, to keep the order of the children
+		c.Data(http.StatusOK, "application/json; charset=utf-8", byt)
+		return
+	}
+
+	byt, err := h.db.GetJSONKey(projectID, rootKey, keys...)
 	if err != nil {
 		tErr := h.db.TranslateError(err)
 		c.JSON(tErr.Code, gin.H{"error": tErr.Error()})
@@ -130,11 +308,11 @@ func (h *Handlers) ReadJSONKey(c *gin.Context) {
 	c.IndentedJSON(http.StatusOK, obj)
 }
 
-// CreateJSONKey updates a key at the key path. An error is returned if the key already exists.
+// CreateJSONKey updates a key at the key path. An error is returned if the key already exists. A last key of `-`
+// appends to an array.
 func (h *Handlers) CreateJSONKey(c *gin.Context) {
 	rootKey := c.Param("rootKey")
 	projectID := c.MustGet("projectId").(string)
-	keys := c.Param("keys")
 
 	b, rErr := c.GetRawData()
 	if rErr != nil {
@@ -142,29 +320,40 @@ func (h *Handlers) CreateJSONKey(c *gin.Context) {
 		return
 	}
 
-	keys = strings.TrimRight(strings.TrimLeft(keys, "/"), "/")
-	if keys == "" {
+	keys, err := jsonKeys(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if len(keys) == 0 {
 		c.JSON(http.StatusBadRequest, "no keys provided")
 		return
 	}
+	c.Set("jsonKeys", keys)
 
-	err := h.db.CreateJSONKey(projectID, rootKey, b, strings.Split(strings.Trim(keys, "/"), "/")...)
+	validate, err := h.validator(c, projectID, rootKey)
 	if err != nil {
-		tErr := h.db.TranslateError(err)
-		c.JSON(tErr.Code, gin.H{"error": tErr.Error()})
+		h.writeError(c, rootKey, err)
+		return
+	}
+
+	err = h.db.CreateJSONKey(projectID, rootKey, b, validate, keys...)
+	if err != nil {
+		h.writeError(c, rootKey, err)
 		return
 	}
 
 	var bod interface{}
 	json.Unmarshal(b, &bod)
+	middleware.SetEventData(c, bod)
 	c.JSON(http.StatusCreated, bod)
 }
 
-// UpdateJSONKey updates a root key at the key path. The key is created if it does not already exist.
+// UpdateJSONKey updates a root key at the key path. The key is created if it does not already exist. A last key of
+// `-` appends to an array.
 func (h *Handlers) UpdateJSONKey(c *gin.Context) {
 	rootKey := c.Param("rootKey")
 	projectID := c.MustGet("projectId").(string)
-	keys := c.Param("keys")
 
 	b, rErr := c.GetRawData()
 	if rErr != nil {
@@ -172,36 +361,130 @@ func (h *Handlers) UpdateJSONKey(c *gin.Context) {
 		return
 	}
 
-	parseKeys := strings.Split(strings.Trim(keys, "/"), "/")
-	c.Set("jsonKeys", parseKeys)
+	keys, err := jsonKeys(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	c.Set("jsonKeys", keys)
 
-	err := h.db.UpdateJSONKey(projectID, rootKey, b, parseKeys...)
+	validate, err := h.validator(c, projectID, rootKey)
 	if err != nil {
-		tErr := h.db.TranslateError(err)
-		c.JSON(tErr.Code, gin.H{"error": tErr.Error()})
+		h.writeError(c, rootKey, err)
+		return
+	}
+
+	if err := h.snapshot(projectID, rootKey); err != nil {
+		h.writeError(c, rootKey, err)
+		return
+	}
+
+	middleware.SetEventPrevious(c, models.EndpointJSON, models.HookEdit, func() ([]byte, error) {
+		return h.db.GetJSONKey(projectID, rootKey, keys...)
+	})
+
+	err = h.db.UpdateJSONKey(projectID, rootKey, b, validate, keys...)
+	if err != nil {
+		h.writeError(c, rootKey, err)
 		return
 	}
 
 	var bod interface{}
 	json.Unmarshal(b, &bod)
+	middleware.SetEventData(c, bod)
 	c.JSON(http.StatusCreated, bod)
 }
 
+// PatchJSONKey atomically applies an operation to the value at the key path and returns the new value, i.e.
+// `{"op": "increment", "value": 1}`. The current value is returned with a 409 if it does not allow the operation.
+func (h *Handlers) PatchJSONKey(c *gin.Context) {
+	rootKey := c.Param("rootKey")
+	projectID := c.MustGet("projectId").(string)
+
+	keys, err := jsonKeys(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if len(keys) == 0 {
+		c.JSON(http.StatusBadRequest, "no keys provided")
+		return
+	}
+
+	op := &models.JSONOperation{}
+	if err := c.BindJSON(op); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err := op.Validate(); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	c.Set("jsonKeys", keys)
+
+	validate, err := h.validator(c, projectID, rootKey)
+	if err != nil {
+		h.writeError(c, rootKey, err)
+		return
+	}
+
+	middleware.SetEventPrevious(c, models.EndpointJSON, models.HookEdit, func() ([]byte, error) {
+		return h.db.GetJSONKey(projectID, rootKey, keys...)
+	})
+
+	byt, err := h.db.ApplyJSONOperation(projectID, rootKey, op, validate, keys...)
+	if err == models.ErrJSONOperationConflict {
+		var current interface{}
+		if cur, cErr := h.db.GetJSONKey(projectID, rootKey, keys...); cErr == nil {
+			json.Unmarshal(cur, &current)
+		}
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error(), "value": current})
+		return
+	} else if err != nil {
+		h.writeError(c, rootKey, err)
+		return
+	}
+
+	var bod interface{}
+	json.Unmarshal(byt, &bod)
+	middleware.SetEventData(c, bod)
+	c.JSON(http.StatusOK, bod)
+}
+
 // DeleteJSONKey deletes a project key at the key path
 func (h *Handlers) DeleteJSONKey(c *gin.Context) {
 	rootKey := c.Param("rootKey")
 	projectID := c.MustGet("projectId").(string)
-	keys := c.Param("keys")
-	keys = strings.TrimRight(strings.TrimLeft(keys, "/"), "/")
-	if keys == "" {
+
+	keys, err := jsonKeys(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if len(keys) == 0 {
 		c.JSON(http.StatusBadRequest, "no keys provided")
 		return
 	}
+	c.Set("jsonKeys", keys)
 
-	err := h.db.DeleteJSONKey(projectID, rootKey, strings.Split(keys, "/")...)
+	validate, err := h.validator(c, projectID, rootKey)
 	if err != nil {
-		tErr := h.db.TranslateError(err)
-		c.JSON(tErr.Code, gin.H{"error": tErr.Error()})
+		h.writeError(c, rootKey, err)
+		return
+	}
+
+	if err := h.snapshot(projectID, rootKey); err != nil {
+		h.writeError(c, rootKey, err)
+		return
+	}
+
+	middleware.SetEventPrevious(c, models.EndpointJSON, models.HookDelete, func() ([]byte, error) {
+		return h.db.GetJSONKey(projectID, rootKey, keys...)
+	})
+
+	err = h.db.DeleteJSONKey(projectID, rootKey, validate, keys...)
+	if err != nil {
+		h.writeError(c, rootKey, err)
 		return
 	}
 
@@ -0,0 +1,91 @@
+package jsontree
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"strconv"
+
+	"github.com/machinable/machinable/dsi/models"
+)
+
+// Query parameters of JSON tree reads
+const (
+	shallowKey      = "shallow"
+	orderByKey      = "orderBy"
+	limitToFirstKey = "limitToFirst"
+	limitToLastKey  = "limitToLast"
+	startAtKey      = "startAt"
+	endAtKey        = "endAt"
+)
+
+// jsonQuery parses the query parameters of a JSON tree read. A nil query is returned if the read has no query
+// parameters, and the entire value at the path should be returned.
+func jsonQuery(values url.Values) (*models.JSONQuery, error) {
+	query := &models.JSONQuery{
+		Shallow: values.Get(shallowKey) == "true",
+		OrderBy: values.Get(orderByKey),
+	}
+
+	var err error
+	if query.LimitToFirst, err = parseLimit(values, limitToFirstKey); err != nil {
+		return nil, err
+	}
+	if query.LimitToLast, err = parseLimit(values, limitToLastKey); err != nil {
+		return nil, err
+	}
+	if query.LimitToFirst > 0 && query.LimitToLast > 0 {
+		return nil, fmt.Errorf("'%s' and '%s' cannot be combined", limitToFirstKey, limitToLastKey)
+	}
+
+	ordered := query.OrderBy != "" || query.LimitToFirst > 0 || query.LimitToLast > 0 ||
+		values.Get(startAtKey) != "" || values.Get(endAtKey) != ""
+	if query.Shallow && ordered {
+		return nil, fmt.Errorf("'%s' cannot be combined with other query parameters", shallowKey)
+	}
+	if !query.Shallow && !ordered {
+		return nil, nil
+	}
+
+	// children are ordered by key unless specified
+	if query.OrderBy == "" {
+		query.OrderBy = models.JSONOrderByKey
+	}
+
+	query.StartAt = boundValue(values.Get(startAtKey), query.OrderBy)
+	query.EndAt = boundValue(values.Get(endAtKey), query.OrderBy)
+
+	return query, nil
+}
+
+func parseLimit(values url.Values, key string) (int, error) {
+	value := values.Get(key)
+	if value == "" {
+		return 0, nil
+	}
+
+	limit, err := strconv.Atoi(value)
+	if err != nil || limit <= 0 {
+		return 0, errors.New("invalid " + key)
+	}
+	return limit, nil
+}
+
+// boundValue parses a `startAt` or `endAt` value as JSON, values which are not valid JSON are strings. Keys are always
+// strings, so `startAt=5` of `$key` is the key `"5"`.
+func boundValue(value, orderBy string) json.RawMessage {
+	if value == "" {
+		return nil
+	}
+
+	var parsed interface{}
+	if err := json.Unmarshal([]byte(value), &parsed); err == nil {
+		if _, isString := parsed.(string); isString || orderBy != models.JSONOrderByKey {
+			return json.RawMessage(value)
+		}
+	}
+
+	b, _ := json.Marshal(value)
+	return json.RawMessage(b)
+}
@@ -0,0 +1,41 @@
+package jsontree
+
+import (
+	"encoding/json"
+	"net/url"
+	"testing"
+
+	"github.com/machinable/machinable/dsi/models"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestJSONQuery(t *testing.T) {
+	query, err := jsonQuery(url.Values{})
+	assert.Nil(t, err)
+	assert.Nil(t, query, "reads without parameters return the whole value")
+
+	query, err = jsonQuery(url.Values{"shallow": {"true"}})
+	assert.Nil(t, err)
+	assert.True(t, query.Shallow)
+
+	query, err = jsonQuery(url.Values{"orderBy": {"profile.age"}, "startAt": {"21"}, "endAt": {"old"}, "limitToLast": {"2"}})
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"profile", "age"}, query.ChildPath())
+	assert.Equal(t, json.RawMessage(`21`), query.StartAt)
+	assert.Equal(t, json.RawMessage(`"old"`), query.EndAt)
+	assert.Equal(t, 2, query.LimitToLast)
+
+	query, err = jsonQuery(url.Values{"startAt": {"5"}})
+	assert.Nil(t, err)
+	assert.Equal(t, models.JSONOrderByKey, query.OrderBy)
+	assert.Equal(t, json.RawMessage(`"5"`), query.StartAt, "keys are always strings")
+
+	_, err = jsonQuery(url.Values{"limitToFirst": {"1"}, "limitToLast": {"1"}})
+	assert.NotNil(t, err)
+
+	_, err = jsonQuery(url.Values{"shallow": {"true"}, "orderBy": {"$value"}})
+	assert.NotNil(t, err)
+
+	_, err = jsonQuery(url.Values{"limitToFirst": {"-1"}})
+	assert.NotNil(t, err)
+}
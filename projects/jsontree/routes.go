@@ -16,9 +16,17 @@ type Handler interface {
 	UpdateRootKey(c *gin.Context)
 	ReadRootKey(c *gin.Context)
 	DeleteRootKey(c *gin.Context)
+	SimulateRules(c *gin.Context)
+	ListSnapshots(c *gin.Context)
+	CreateSnapshot(c *gin.Context)
+	GetSnapshot(c *gin.Context)
+	DiffSnapshot(c *gin.Context)
+	RestoreSnapshot(c *gin.Context)
+	DeleteSnapshot(c *gin.Context)
 	ReadJSONKey(c *gin.Context)
 	CreateJSONKey(c *gin.Context)
 	UpdateJSONKey(c *gin.Context)
+	PatchJSONKey(c *gin.Context)
 	DeleteJSONKey(c *gin.Context)
 
 	ListUsage(c *gin.Context)
@@ -26,7 +34,7 @@ type Handler interface {
 
 // SetRoutes sets all of the appropriate routes to handlers for the application
 func SetRoutes(engine *gin.Engine, datastore interfaces.Datastore, cache redis.UniversalClient, processor *events.Processor, config *config.AppConfig) error {
-	handler := NewHandlers(datastore)
+	handler := NewHandlers(datastore, config.GetJSONSnapshotRetention(), config.GetJSONDeleteGracePeriod(), processor.Changes())
 
 	return setRoutes(engine, handler, datastore, cache, processor, config)
 }
@@ -44,6 +52,7 @@ func setRoutes(engine *gin.Engine, h Handler, datastore interfaces.Datastore, ca
 	jsonKeys.GET("/:rootKey/*keys", h.ReadJSONKey)
 	jsonKeys.POST("/:rootKey/*keys", h.CreateJSONKey)
 	jsonKeys.PUT("/:rootKey/*keys", h.UpdateJSONKey)
+	jsonKeys.PATCH("/:rootKey/*keys", h.PatchJSONKey)
 	jsonKeys.DELETE("/:rootKey/*keys", h.DeleteJSONKey)
 
 	// App mgmt routes with different authz policy
@@ -56,11 +65,20 @@ func setRoutes(engine *gin.Engine, h Handler, datastore interfaces.Datastore, ca
 	mgmtStats.GET("/", h.ListUsage)
 
 	mgmtAPI := mgmt.Group("/json")
-	mgmtAPI.GET("/", h.ListRootKeys)             // returns all root keys
-	mgmtAPI.GET("/:rootKey", h.ReadRootKey)      // returns entire root tree
-	mgmtAPI.POST("/:rootKey", h.CreateRootKey)   // create a new tree at `rootKey`
-	mgmtAPI.PUT("/:rootKey", h.UpdateRootKey)    // create a new tree at `rootKey`
-	mgmtAPI.DELETE("/:rootKey", h.DeleteRootKey) // root tree must be empty to delete
+	mgmtAPI.GET("/", h.ListRootKeys)                     // returns all root keys
+	mgmtAPI.GET("/:rootKey", h.ReadRootKey)              // returns entire root tree
+	mgmtAPI.POST("/:rootKey", h.CreateRootKey)           // create a new tree at `rootKey`
+	mgmtAPI.PUT("/:rootKey", h.UpdateRootKey)            // create a new tree at `rootKey`
+	mgmtAPI.DELETE("/:rootKey", h.DeleteRootKey)         // root tree must be empty to delete
+	mgmtAPI.POST("/:rootKey/_simulate", h.SimulateRules) // evaluate the rules for a simulated request
+
+	// snapshots outlive their root key, to restore deleted root keys
+	mgmtAPI.GET("/:rootKey/snapshots", h.ListSnapshots)
+	mgmtAPI.POST("/:rootKey/snapshots", h.CreateSnapshot)
+	mgmtAPI.GET("/:rootKey/snapshots/:snapshotID", h.GetSnapshot)
+	mgmtAPI.DELETE("/:rootKey/snapshots/:snapshotID", h.DeleteSnapshot)
+	mgmtAPI.GET("/:rootKey/snapshots/:snapshotID/diff", h.DiffSnapshot)        // changes from the snapshot to `?to=` or the current tree
+	mgmtAPI.POST("/:rootKey/snapshots/:snapshotID/restore", h.RestoreSnapshot) // replaces the tree, recreating deleted root keys
 
 	return nil
 }
@@ -0,0 +1,69 @@
+package jsontree
+
+import (
+	"encoding/json"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/machinable/machinable/dsi/models"
+	"github.com/machinable/machinable/events"
+)
+
+// streamJSONKey streams the creates, edits and deletes at, above or below the key path as Server-Sent Events. Changes
+// above the path are narrowed to the value at the path, so subscribers only receive what they can read.
+func (h *Handlers) streamJSONKey(c *gin.Context, projectID, rootKey string, keys []string) {
+	filter := func(change *events.Change) bool {
+		return change.Entity == models.EndpointJSON &&
+			change.EntityKey == rootKey &&
+			(hasPrefix(change.Keys, keys) || hasPrefix(keys, change.Keys))
+	}
+
+	render := func(change *events.Change) *events.Change {
+		if len(change.Keys) >= len(keys) {
+			return change
+		}
+
+		narrowed := *change
+		narrowed.Keys = keys
+		if len(change.Data) > 0 {
+			var data interface{}
+			json.Unmarshal(change.Data, &data)
+			narrowed.Data, _ = json.Marshal(valueAt(data, keys[len(change.Keys):]))
+		}
+		return &narrowed
+	}
+
+	events.ServeSSE(c, h.changes, projectID, filter, render)
+}
+
+// hasPrefix returns true if the prefix keys are the first keys of the keys
+func hasPrefix(keys, prefix []string) bool {
+	if len(prefix) > len(keys) {
+		return false
+	}
+	for i, key := range prefix {
+		if keys[i] != key {
+			return false
+		}
+	}
+	return true
+}
+
+// valueAt returns the value at the keys of a decoded JSON value, or nil if it does not exist
+func valueAt(value interface{}, keys []string) interface{} {
+	for _, key := range keys {
+		switch v := value.(type) {
+		case map[string]interface{}:
+			value = v[key]
+		case []interface{}:
+			i, err := strconv.Atoi(key)
+			if err != nil || i < 0 || i >= len(v) {
+				return nil
+			}
+			value = v[i]
+		default:
+			return nil
+		}
+	}
+	return value
+}
@@ -1,23 +1,27 @@
 package resources
 
 import (
+	"log"
 	"net/http"
 
 	"github.com/gin-gonic/gin"
 	"github.com/machinable/machinable/dsi/interfaces"
 	"github.com/machinable/machinable/dsi/models"
+	"github.com/machinable/machinable/storage"
 )
 
 // New returns a pointer to a new `Resources` struct
-func New(db interfaces.ResourcesDatastore) *Resources {
+func New(db interfaces.ResourcesDatastore, files storage.Backend) *Resources {
 	return &Resources{
 		store: db,
+		files: files,
 	}
 }
 
 // Resources contains the datastore and any HTTP handlers for project resource definitions and documents
 type Resources struct {
 	store interfaces.ResourcesDatastore
+	files storage.Backend
 }
 
 // AddResourceDefinition creates a new resource definition in the users' collection
@@ -110,11 +114,22 @@ func (h *Resources) DeleteResourceDefinition(c *gin.Context) {
 	resourceID := c.Param("resourceDefinitionID")
 	projectID := c.MustGet("projectId").(string)
 
-	err := h.store.DeleteDefinition(projectID, resourceID)
+	def, err := h.store.GetDefinition(projectID, resourceID)
+	if err != nil {
+		c.JSON(err.Code(), gin.H{"error": err.Error()})
+		return
+	}
+
+	err = h.store.DeleteDefinition(projectID, resourceID)
 	if err != nil {
 		c.JSON(err.Code(), gin.H{"error": err.Error()})
 		return
 	}
 
+	// remove the files attached to the resource documents
+	if err := h.files.DeleteAll(models.ResourceFilesPrefix(projectID, def.PathName)); err != nil {
+		log.Println("could not delete resource files ", err.Error())
+	}
+
 	c.JSON(http.StatusNoContent, gin.H{})
 }
@@ -5,12 +5,13 @@ import (
 	"github.com/machinable/machinable/config"
 	"github.com/machinable/machinable/dsi/interfaces"
 	"github.com/machinable/machinable/middleware"
+	"github.com/machinable/machinable/storage"
 )
 
 // SetRoutes sets all of the appropriate routes to handlers for project collections
 func SetRoutes(engine *gin.Engine, datastore interfaces.Datastore, config *config.AppConfig) error {
 	// create new Resources handler with datastore
-	handler := New(datastore)
+	handler := New(datastore, storage.NewLocal(config.GetFileStoragePath()))
 
 	// admin/mgmt routes
 	// Only application users have access to resource definitions
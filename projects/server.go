@@ -35,7 +35,7 @@ func CreateRoutes(datastore interfaces.Datastore, cache redis.UniversalClient, p
 	apikeys.SetRoutes(router, datastore, config)
 	jsontree.SetRoutes(router, datastore, cache, processor, config)
 	spec.SetRoutes(router, datastore)
-	hooks.SetRoutes(router, datastore, config)
+	hooks.SetRoutes(router, datastore, processor, config)
 
 	return router
 }
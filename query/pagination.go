@@ -7,6 +7,7 @@ import (
 	"net/url"
 	"os"
 	"strconv"
+	"strings"
 )
 
 const (
@@ -106,3 +107,19 @@ func NewLinks(r *http.Request, limit, offset, max int64) *Links {
 
 	return links
 }
+
+// Header formats the pagination links as the value of an HTTP `Link` header (RFC 8288)
+func (l *Links) Header() string {
+	links := make([]string, 0)
+	if l.Self != "" {
+		links = append(links, fmt.Sprintf("<%s>; rel=\"self\"", l.Self))
+	}
+	if l.Next != "" {
+		links = append(links, fmt.Sprintf("<%s>; rel=\"next\"", l.Next))
+	}
+	if l.Prev != "" {
+		links = append(links, fmt.Sprintf("<%s>; rel=\"prev\"", l.Prev))
+	}
+
+	return strings.Join(links, ", ")
+}
@@ -0,0 +1,493 @@
+package rules
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// Lookup returns the value of a variable of an expression, i.e. `auth`, `data` or a path variable `$uid`
+type Lookup func(name string) (interface{}, error)
+
+// Expression is a parsed rule expression, i.e. `auth.id == $uid && newData.owner == auth.id`. Expressions evaluate
+// JSON values: `null`, booleans, numbers, strings, objects and arrays. Object keys and array indexes are read with
+// `.key` or `[expr]`, reading a key of a missing value is `null`.
+type Expression struct {
+	source string
+	root   node
+}
+
+// Parse parses the rule expression
+func Parse(source string) (*Expression, error) {
+	tokens, err := lex(source)
+	if err != nil {
+		return nil, err
+	}
+
+	p := &parser{tokens: tokens}
+	root, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if tok := p.peek(); tok.kind != tokenEOF {
+		return nil, fmt.Errorf("unexpected '%s' at position %d", tok.text, tok.pos)
+	}
+
+	return &Expression{source: source, root: root}, nil
+}
+
+// String returns the source of the expression
+func (e *Expression) String() string {
+	return e.source
+}
+
+// Variables returns the names of the variables referenced by the expression
+func (e *Expression) Variables() []string {
+	names := []string{}
+	e.root.walk(func(n node) {
+		if v, ok := n.(*variable); ok {
+			names = append(names, v.name)
+		}
+	})
+	return names
+}
+
+// Eval evaluates the expression, which must result in a boolean
+func (e *Expression) Eval(lookup Lookup) (bool, error) {
+	value, err := e.root.eval(lookup)
+	if err != nil {
+		return false, err
+	}
+
+	result, ok := value.(bool)
+	if !ok {
+		return false, fmt.Errorf("expression must be a boolean, got %s", typeName(value))
+	}
+	return result, nil
+}
+
+/* LEXER */
+
+type tokenKind int
+
+const (
+	tokenEOF tokenKind = iota
+	tokenIdent
+	tokenNumber
+	tokenString
+	tokenOperator
+)
+
+type token struct {
+	kind  tokenKind
+	text  string
+	value interface{}
+	pos   int
+}
+
+// operators are matched longest first
+var operators = []string{"==", "!=", "<=", ">=", "&&", "||", "<", ">", "!", "(", ")", "[", "]", "."}
+
+func lex(source string) ([]token, error) {
+	tokens := []token{}
+	runes := []rune(source)
+
+	for i := 0; i < len(runes); {
+		r := runes[i]
+		switch {
+		case unicode.IsSpace(r):
+			i++
+		case r == '$' || r == '_' || unicode.IsLetter(r):
+			start := i
+			for i < len(runes) && (runes[i] == '$' || runes[i] == '_' || unicode.IsLetter(runes[i]) || unicode.IsDigit(runes[i])) {
+				i++
+			}
+			tokens = append(tokens, token{kind: tokenIdent, text: string(runes[start:i]), pos: start})
+		case unicode.IsDigit(r):
+			start := i
+			for i < len(runes) && (unicode.IsDigit(runes[i]) || runes[i] == '.') {
+				i++
+			}
+			n, err := strconv.ParseFloat(string(runes[start:i]), 64)
+			if err != nil {
+				return nil, fmt.Errorf("invalid number at position %d", start)
+			}
+			tokens = append(tokens, token{kind: tokenNumber, text: string(runes[start:i]), value: n, pos: start})
+		case r == '\'' || r == '"':
+			start := i
+			var sb strings.Builder
+			for i++; i < len(runes) && runes[i] != r; i++ {
+				if runes[i] == '\\' && i+1 < len(runes) {
+					i++
+				}
+				sb.WriteRune(runes[i])
+			}
+			if i >= len(runes) {
+				return nil, fmt.Errorf("unterminated string at position %d", start)
+			}
+			i++
+			tokens = append(tokens, token{kind: tokenString, text: string(runes[start:i]), value: sb.String(), pos: start})
+		default:
+			matched := false
+			for _, op := range operators {
+				if strings.HasPrefix(string(runes[i:]), op) {
+					tokens = append(tokens, token{kind: tokenOperator, text: op, pos: i})
+					i += len([]rune(op))
+					matched = true
+					break
+				}
+			}
+			if !matched {
+				return nil, fmt.Errorf("unexpected '%c' at position %d", r, i)
+			}
+		}
+	}
+
+	return append(tokens, token{kind: tokenEOF, text: "end of expression", pos: len(runes)}), nil
+}
+
+/* PARSER */
+
+type parser struct {
+	tokens []token
+	pos    int
+}
+
+func (p *parser) peek() token {
+	return p.tokens[p.pos]
+}
+
+func (p *parser) next() token {
+	tok := p.tokens[p.pos]
+	if tok.kind != tokenEOF {
+		p.pos++
+	}
+	return tok
+}
+
+func (p *parser) accept(ops ...string) (string, bool) {
+	tok := p.peek()
+	if tok.kind != tokenOperator {
+		return "", false
+	}
+	for _, op := range ops {
+		if tok.text == op {
+			p.next()
+			return op, true
+		}
+	}
+	return "", false
+}
+
+func (p *parser) expect(op string) error {
+	if _, ok := p.accept(op); !ok {
+		tok := p.peek()
+		return fmt.Errorf("expected '%s' at position %d, got '%s'", op, tok.pos, tok.text)
+	}
+	return nil
+}
+
+// parseOr parses `a || b`, the lowest precedence
+func (p *parser) parseOr() (node, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		if _, ok := p.accept("||"); !ok {
+			return left, nil
+		}
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		left = &binary{op: "||", left: left, right: right}
+	}
+}
+
+func (p *parser) parseAnd() (node, error) {
+	left, err := p.parseComparison()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		if _, ok := p.accept("&&"); !ok {
+			return left, nil
+		}
+		right, err := p.parseComparison()
+		if err != nil {
+			return nil, err
+		}
+		left = &binary{op: "&&", left: left, right: right}
+	}
+}
+
+func (p *parser) parseComparison() (node, error) {
+	left, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+	op, ok := p.accept("==", "!=", "<=", ">=", "<", ">")
+	if !ok {
+		return left, nil
+	}
+	right, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+	return &binary{op: op, left: left, right: right}, nil
+}
+
+func (p *parser) parseUnary() (node, error) {
+	if _, ok := p.accept("!"); ok {
+		operand, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return &not{operand: operand}, nil
+	}
+	return p.parseMember()
+}
+
+// parseMember parses a primary value followed by any `.key` or `[expr]` accessors
+func (p *parser) parseMember() (node, error) {
+	target, err := p.parsePrimary()
+	if err != nil {
+		return nil, err
+	}
+
+	for {
+		if _, ok := p.accept("."); ok {
+			tok := p.next()
+			if tok.kind != tokenIdent {
+				return nil, fmt.Errorf("expected a key at position %d, got '%s'", tok.pos, tok.text)
+			}
+			target = &member{target: target, key: &literal{value: tok.text}}
+		} else if _, ok := p.accept("["); ok {
+			key, err := p.parseOr()
+			if err != nil {
+				return nil, err
+			}
+			if err := p.expect("]"); err != nil {
+				return nil, err
+			}
+			target = &member{target: target, key: key}
+		} else {
+			return target, nil
+		}
+	}
+}
+
+func (p *parser) parsePrimary() (node, error) {
+	tok := p.next()
+	switch tok.kind {
+	case tokenNumber, tokenString:
+		return &literal{value: tok.value}, nil
+	case tokenIdent:
+		switch tok.text {
+		case "true":
+			return &literal{value: true}, nil
+		case "false":
+			return &literal{value: false}, nil
+		case "null":
+			return &literal{value: nil}, nil
+		}
+		return &variable{name: tok.text}, nil
+	case tokenOperator:
+		if tok.text == "(" {
+			inner, err := p.parseOr()
+			if err != nil {
+				return nil, err
+			}
+			if err := p.expect(")"); err != nil {
+				return nil, err
+			}
+			return inner, nil
+		}
+	}
+	return nil, fmt.Errorf("unexpected '%s' at position %d", tok.text, tok.pos)
+}
+
+/* EVALUATION */
+
+type node interface {
+	eval(lookup Lookup) (interface{}, error)
+	walk(fn func(node))
+}
+
+type literal struct {
+	value interface{}
+}
+
+func (n *literal) eval(lookup Lookup) (interface{}, error) { return n.value, nil }
+func (n *literal) walk(fn func(node))                      { fn(n) }
+
+type variable struct {
+	name string
+}
+
+func (n *variable) eval(lookup Lookup) (interface{}, error) { return lookup(n.name) }
+func (n *variable) walk(fn func(node))                      { fn(n) }
+
+type member struct {
+	target node
+	key    node
+}
+
+func (n *member) walk(fn func(node)) {
+	fn(n)
+	n.target.walk(fn)
+	n.key.walk(fn)
+}
+
+func (n *member) eval(lookup Lookup) (interface{}, error) {
+	target, err := n.target.eval(lookup)
+	if err != nil {
+		return nil, err
+	}
+	key, err := n.key.eval(lookup)
+	if err != nil {
+		return nil, err
+	}
+
+	switch t := target.(type) {
+	case map[string]interface{}:
+		if k, ok := key.(string); ok {
+			return t[k], nil
+		}
+	case []interface{}:
+		if i, ok := key.(float64); ok {
+			if int(i) >= 0 && int(i) < len(t) && float64(int(i)) == i {
+				return t[int(i)], nil
+			}
+		} else if k, ok := key.(string); ok {
+			if i, err := strconv.Atoi(k); err == nil && i >= 0 && i < len(t) {
+				return t[i], nil
+			}
+		}
+	}
+
+	// keys of missing values, primitives or the wrong type of key are null
+	return nil, nil
+}
+
+type not struct {
+	operand node
+}
+
+func (n *not) walk(fn func(node)) {
+	fn(n)
+	n.operand.walk(fn)
+}
+
+func (n *not) eval(lookup Lookup) (interface{}, error) {
+	value, err := n.operand.eval(lookup)
+	if err != nil {
+		return nil, err
+	}
+	b, ok := value.(bool)
+	if !ok {
+		return nil, fmt.Errorf("'!' requires a boolean, got %s", typeName(value))
+	}
+	return !b, nil
+}
+
+type binary struct {
+	op          string
+	left, right node
+}
+
+func (n *binary) walk(fn func(node)) {
+	fn(n)
+	n.left.walk(fn)
+	n.right.walk(fn)
+}
+
+func (n *binary) eval(lookup Lookup) (interface{}, error) {
+	left, err := n.left.eval(lookup)
+	if err != nil {
+		return nil, err
+	}
+
+	// logical operators short circuit, so `data != null && data.owner == auth.id` only reads data once it exists
+	if n.op == "&&" || n.op == "||" {
+		l, ok := left.(bool)
+		if !ok {
+			return nil, fmt.Errorf("'%s' requires booleans, got %s", n.op, typeName(left))
+		}
+		if (n.op == "&&" && !l) || (n.op == "||" && l) {
+			return l, nil
+		}
+		right, err := n.right.eval(lookup)
+		if err != nil {
+			return nil, err
+		}
+		r, ok := right.(bool)
+		if !ok {
+			return nil, fmt.Errorf("'%s' requires booleans, got %s", n.op, typeName(right))
+		}
+		return r, nil
+	}
+
+	right, err := n.right.eval(lookup)
+	if err != nil {
+		return nil, err
+	}
+
+	switch n.op {
+	case "==":
+		return reflect.DeepEqual(left, right), nil
+	case "!=":
+		return !reflect.DeepEqual(left, right), nil
+	}
+
+	// ordering compares two numbers or two strings
+	if l, ok := left.(float64); ok {
+		if r, ok := right.(float64); ok {
+			return compare(n.op, l < r, l == r), nil
+		}
+	}
+	if l, ok := left.(string); ok {
+		if r, ok := right.(string); ok {
+			return compare(n.op, l < r, l == r), nil
+		}
+	}
+	return nil, fmt.Errorf("'%s' cannot compare %s and %s", n.op, typeName(left), typeName(right))
+}
+
+func compare(op string, less, equal bool) bool {
+	switch op {
+	case "<":
+		return less
+	case "<=":
+		return less || equal
+	case ">":
+		return !less && !equal
+	default:
+		return !less
+	}
+}
+
+func typeName(value interface{}) string {
+	switch value.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "boolean"
+	case float64:
+		return "number"
+	case string:
+		return "string"
+	case []interface{}:
+		return "array"
+	case map[string]interface{}:
+		return "object"
+	}
+	return "unknown"
+}
+
+// errUnknownVariable is returned for variables which are not defined
+var errUnknownVariable = errors.New("unknown variable")
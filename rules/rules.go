@@ -0,0 +1,223 @@
+package rules
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/machinable/machinable/dsi/models"
+)
+
+// Variables of rule expressions, along with the `$` variables of the rule path
+const (
+	// AuthVar is the requester, `{"id": "...", "role": "...", "type": "..."}`, or null if anonymous
+	AuthVar = "auth"
+	// DataVar is the current value at the rule path
+	DataVar = "data"
+	// NewDataVar is the value at the rule path after the write, the current value of reads
+	NewDataVar = "newData"
+	// RootVar is the current tree
+	RootVar = "root"
+	// NewRootVar is the tree after the write, the current tree of reads
+	NewRootVar = "newRoot"
+	// NowVar is the current time, in milliseconds since the epoch
+	NowVar = "now"
+)
+
+var variables = map[string]bool{
+	AuthVar:    true,
+	DataVar:    true,
+	NewDataVar: true,
+	RootVar:    true,
+	NewRootVar: true,
+	NowVar:     true,
+}
+
+// Request is an access to a JSON tree
+type Request struct {
+	// Write is true for creates, updates and deletes
+	Write bool
+	// Keys is the path of the access
+	Keys []string
+	// Auth is the requester, nil if anonymous
+	Auth map[string]interface{}
+	// Root returns the current tree, it is only called if an expression reads the current data
+	Root func() (interface{}, error)
+	// NewRoot returns the tree after the write, it is only called if an expression reads the new data of a write
+	NewRoot func() (interface{}, error)
+}
+
+// Result is the evaluation of a rule
+type Result struct {
+	Path       string `json:"path"`
+	Expression string `json:"expression"`
+	Allowed    bool   `json:"allowed"`
+	Error      string `json:"error,omitempty"`
+}
+
+// parsePattern parses the path pattern of a rule, `/` is the root of the tree
+func parsePattern(path string) ([]string, error) {
+	return models.ParseJSONPointer(strings.TrimRight(path, "/"))
+}
+
+// match returns the path variables of the pattern if it matches the keys or a parent of the keys
+func match(pattern, keys []string) (map[string]string, bool) {
+	if len(pattern) > len(keys) {
+		return nil, false
+	}
+
+	vars := map[string]string{}
+	for i, key := range pattern {
+		if strings.HasPrefix(key, "$") {
+			vars[key] = keys[i]
+		} else if key != keys[i] {
+			return nil, false
+		}
+	}
+	return vars, true
+}
+
+// Validate parses the rules, verifying the expressions only reference defined variables
+func Validate(rules []*models.JSONRule) error {
+	for _, rule := range rules {
+		pattern, err := parsePattern(rule.Path)
+		if err != nil {
+			return fmt.Errorf("invalid rule path '%s': %s", rule.Path, err.Error())
+		}
+
+		vars := map[string]bool{}
+		for _, key := range pattern {
+			if strings.HasPrefix(key, "$") {
+				vars[key] = true
+			}
+		}
+
+		for _, source := range []string{rule.Read, rule.Write} {
+			if source == "" {
+				continue
+			}
+			expr, err := Parse(source)
+			if err != nil {
+				return fmt.Errorf("invalid rule '%s' of '%s': %s", source, rule.Path, err.Error())
+			}
+			for _, name := range expr.Variables() {
+				if !variables[name] && !vars[name] {
+					return fmt.Errorf("invalid rule '%s' of '%s': %s '%s'", source, rule.Path, errUnknownVariable.Error(), name)
+				}
+			}
+		}
+	}
+
+	return nil
+}
+
+// Check evaluates the rules which apply to the request in order, until a rule allows access. Rules apply to the paths
+// matching their pattern and every path below them. Access is denied if no rule allows it.
+func Check(rules []*models.JSONRule, req *Request) (bool, []*Result) {
+	results := []*Result{}
+
+	// the trees are loaded at most once
+	var root, newRoot interface{}
+	var rootErr, newRootErr error
+	rootLoaded, newRootLoaded := false, false
+	loadRoot := func() (interface{}, error) {
+		if !rootLoaded {
+			root, rootErr = req.Root()
+			rootLoaded = true
+		}
+		return root, rootErr
+	}
+	loadNewRoot := func() (interface{}, error) {
+		if !req.Write {
+			return loadRoot()
+		}
+		if !newRootLoaded {
+			newRoot, newRootErr = req.NewRoot()
+			newRootLoaded = true
+		}
+		return newRoot, newRootErr
+	}
+
+	for _, rule := range rules {
+		source := rule.Read
+		if req.Write {
+			source = rule.Write
+		}
+		if source == "" {
+			continue
+		}
+
+		pattern, err := parsePattern(rule.Path)
+		if err != nil {
+			continue
+		}
+		vars, ok := match(pattern, req.Keys)
+		if !ok {
+			continue
+		}
+		path := req.Keys[:len(pattern)]
+
+		result := &Result{Path: rule.Path, Expression: source}
+		results = append(results, result)
+
+		expr, err := Parse(source)
+		if err != nil {
+			result.Error = err.Error()
+			continue
+		}
+
+		result.Allowed, err = expr.Eval(func(name string) (interface{}, error) {
+			switch name {
+			case AuthVar:
+				if req.Auth == nil {
+					return nil, nil
+				}
+				return req.Auth, nil
+			case DataVar:
+				tree, err := loadRoot()
+				return valueAt(tree, path), err
+			case NewDataVar:
+				tree, err := loadNewRoot()
+				return valueAt(tree, path), err
+			case RootVar:
+				return loadRoot()
+			case NewRootVar:
+				return loadNewRoot()
+			case NowVar:
+				return float64(time.Now().UnixNano() / int64(time.Millisecond)), nil
+			}
+			if value, ok := vars[name]; ok {
+				return value, nil
+			}
+			return nil, fmt.Errorf("%s '%s'", errUnknownVariable.Error(), name)
+		})
+		if err != nil {
+			result.Error = err.Error()
+		}
+		if result.Allowed {
+			return true, results
+		}
+	}
+
+	return false, results
+}
+
+// valueAt returns the value of the tree at the keys, or nil if it does not exist
+func valueAt(tree interface{}, keys []string) interface{} {
+	current := tree
+	for _, key := range keys {
+		switch value := current.(type) {
+		case map[string]interface{}:
+			current = value[key]
+		case []interface{}:
+			i, ok := arrayIndex(key, len(value))
+			if !ok {
+				return nil
+			}
+			current = value[i]
+		default:
+			return nil
+		}
+	}
+	return current
+}
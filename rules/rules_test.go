@@ -0,0 +1,123 @@
+package rules
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/machinable/machinable/dsi/models"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestExpression(t *testing.T) {
+	vars := map[string]interface{}{
+		"auth": map[string]interface{}{"id": "abc", "role": "admin"},
+		"data": map[string]interface{}{"owner": "abc", "count": float64(3), "tags": []interface{}{"a", "b"}},
+		"$uid": "abc",
+	}
+	lookup := func(name string) (interface{}, error) {
+		return vars[name], nil
+	}
+
+	tests := []struct {
+		source  string
+		allowed bool
+		err     bool
+	}{
+		{"true", true, false},
+		{"auth.id == $uid", true, false},
+		{"auth != null && data.owner == auth.id", true, false},
+		{"data.count > 2 && data.count <= 3", true, false},
+		{"data.tags[1] == 'b'", true, false},
+		{"data.missing.key == null", true, false},
+		{"!(auth.role == \"admin\")", false, false},
+		{"false || auth.role == 'admin'", true, false},
+		{"data.count", false, true},
+		{"data.count < 'a'", false, true},
+	}
+
+	for _, test := range tests {
+		expr, err := Parse(test.source)
+		assert.Nil(t, err, test.source)
+		allowed, err := expr.Eval(lookup)
+		assert.Equal(t, test.allowed, allowed, test.source)
+		assert.Equal(t, test.err, err != nil, test.source)
+	}
+
+	for _, source := range []string{"", "auth.", "a == b == c", "'open", "(true", "a & b"} {
+		_, err := Parse(source)
+		assert.NotNil(t, err, source)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	assert.Nil(t, Validate([]*models.JSONRule{{Path: "/users/$uid", Read: "auth.id == $uid", Write: "newData.id == $uid"}}))
+	assert.NotNil(t, Validate([]*models.JSONRule{{Path: "/users", Read: "auth.id == $uid"}}), "$uid is not bound by the path")
+	assert.NotNil(t, Validate([]*models.JSONRule{{Path: "users", Read: "true"}}))
+	assert.NotNil(t, Validate([]*models.JSONRule{{Path: "/", Write: "auth ="}}))
+}
+
+func TestCheck(t *testing.T) {
+	tree := map[string]interface{}{
+		"users": map[string]interface{}{
+			"abc": map[string]interface{}{"name": "Ann"},
+		},
+	}
+	rules := []*models.JSONRule{
+		{Path: "/", Read: "auth.role == 'admin'"},
+		{Path: "/users/$uid", Read: "auth.id == $uid", Write: "auth.id == $uid && newData.name != null"},
+	}
+	request := func(write bool, id string, body string, keys ...string) *Request {
+		req := &Request{Write: write, Keys: keys, Auth: map[string]interface{}{"id": id, "role": "user"}}
+		req.Root = func() (interface{}, error) { return tree, nil }
+		req.NewRoot = func() (interface{}, error) { return NewRoot(tree, "PUT", keys, []byte(body)) }
+		return req
+	}
+
+	allowed, results := Check(rules, request(false, "abc", "", "users", "abc", "name"))
+	assert.True(t, allowed)
+	assert.Len(t, results, 2)
+
+	allowed, _ = Check(rules, request(false, "xyz", "", "users", "abc"))
+	assert.False(t, allowed)
+
+	allowed, _ = Check(rules, request(false, "abc", "", "users"))
+	assert.False(t, allowed, "rules only apply at and below their path")
+
+	allowed, _ = Check(rules, request(true, "abc", `{"name": "Anne"}`, "users", "abc"))
+	assert.True(t, allowed)
+
+	allowed, _ = Check(rules, request(true, "abc", `{}`, "users", "abc"))
+	assert.False(t, allowed, "new data must have a name")
+
+	allowed, _ = Check(rules, &Request{Keys: []string{}, Root: func() (interface{}, error) { return tree, nil }})
+	assert.False(t, allowed, "anonymous auth is null")
+}
+
+func TestNewRoot(t *testing.T) {
+	var root interface{}
+	json.Unmarshal([]byte(`{"count": 1, "tags": ["a"], "dogs": {"rex": {"age": 2}}}`), &root)
+
+	tests := []struct {
+		method string
+		keys   []string
+		body   string
+		result string
+	}{
+		{"PUT", []string{"dogs", "rex", "age"}, `3`, `{"count": 1, "tags": ["a"], "dogs": {"rex": {"age": 3}}}`},
+		{"POST", []string{"tags", "-"}, `"b"`, `{"count": 1, "tags": ["a", "b"], "dogs": {"rex": {"age": 2}}}`},
+		{"POST", []string{"cats", "tom"}, `{}`, `{"count": 1, "tags": ["a"], "dogs": {"rex": {"age": 2}}}`},
+		{"DELETE", []string{"dogs", "rex"}, ``, `{"count": 1, "tags": ["a"], "dogs": {}}`},
+		{"PATCH", []string{"count"}, `{"op": "increment", "value": 2}`, `{"count": 3, "tags": ["a"], "dogs": {"rex": {"age": 2}}}`},
+		{"PATCH", []string{"count"}, `{"op": "compareAndSwap", "value": 5, "expected": 0}`, `{"count": 1, "tags": ["a"], "dogs": {"rex": {"age": 2}}}`},
+	}
+
+	for _, test := range tests {
+		result, err := NewRoot(root, test.method, test.keys, []byte(test.body))
+		assert.Nil(t, err, test.method)
+		b, _ := json.Marshal(result)
+		assert.JSONEq(t, test.result, string(b), test.method)
+	}
+
+	b, _ := json.Marshal(root)
+	assert.JSONEq(t, `{"count": 1, "tags": ["a"], "dogs": {"rex": {"age": 2}}}`, string(b), "the current tree is not modified")
+}
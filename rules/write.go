@@ -0,0 +1,126 @@
+package rules
+
+import (
+	"encoding/json"
+	"strconv"
+
+	"github.com/machinable/machinable/dsi/models"
+)
+
+// NewRoot returns the tree resulting from the write of the request body at the keys, mirroring the writes of the JSON
+// tree routes: `POST` and `PUT` set the value, `PATCH` applies an operation and `DELETE` removes the value. The current
+// tree is not modified.
+func NewRoot(root interface{}, method string, keys []string, body []byte) (interface{}, error) {
+	tree := copyValue(root)
+
+	switch method {
+	case "DELETE":
+		return remove(tree, keys), nil
+	case "PATCH":
+		op := &models.JSONOperation{}
+		if err := json.Unmarshal(body, op); err != nil {
+			return nil, err
+		}
+		value, err := op.Apply(valueAt(tree, keys))
+		if err == models.ErrJSONOperationConflict {
+			// the operation will fail without changing the tree
+			return tree, nil
+		} else if err != nil {
+			return nil, err
+		}
+		return set(tree, keys, value), nil
+	}
+
+	var value interface{}
+	if err := json.Unmarshal(body, &value); err != nil {
+		return nil, err
+	}
+	return set(tree, keys, value), nil
+}
+
+// set sets the value at the keys. Like `jsonb_set`, only the last key is created if it is missing, and the `-` key
+// appends to an array.
+func set(tree interface{}, keys []string, value interface{}) interface{} {
+	if len(keys) == 0 {
+		return value
+	}
+	key, rest := keys[0], keys[1:]
+
+	switch current := tree.(type) {
+	case map[string]interface{}:
+		child, exists := current[key]
+		if !exists && len(rest) > 0 {
+			return tree
+		}
+		current[key] = set(child, rest, value)
+	case []interface{}:
+		if key == models.JSONPointerAppend && len(rest) == 0 {
+			return append(current, value)
+		}
+		i, ok := arrayIndex(key, len(current))
+		if !ok {
+			if _, err := strconv.Atoi(key); err == nil && len(rest) == 0 {
+				return append(current, value)
+			}
+			return tree
+		}
+		current[i] = set(current[i], rest, value)
+	}
+
+	return tree
+}
+
+// remove removes the value at the keys
+func remove(tree interface{}, keys []string) interface{} {
+	if len(keys) == 0 {
+		return tree
+	}
+	key, rest := keys[0], keys[1:]
+
+	switch current := tree.(type) {
+	case map[string]interface{}:
+		if len(rest) == 0 {
+			delete(current, key)
+		} else if child, ok := current[key]; ok {
+			current[key] = remove(child, rest)
+		}
+	case []interface{}:
+		i, ok := arrayIndex(key, len(current))
+		if !ok {
+			return tree
+		}
+		if len(rest) == 0 {
+			return append(current[:i], current[i+1:]...)
+		}
+		current[i] = remove(current[i], rest)
+	}
+
+	return tree
+}
+
+// arrayIndex parses the key as an index of an array of the length
+func arrayIndex(key string, length int) (int, bool) {
+	i, err := strconv.Atoi(key)
+	if err != nil || i < 0 || i >= length {
+		return 0, false
+	}
+	return i, true
+}
+
+func copyValue(value interface{}) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		c := make(map[string]interface{}, len(v))
+		for key, child := range v {
+			c[key] = copyValue(child)
+		}
+		return c
+	case []interface{}:
+		c := make([]interface{}, len(v))
+		for i, child := range v {
+			c[i] = copyValue(child)
+		}
+		return c
+	}
+	return value
+}
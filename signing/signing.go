@@ -0,0 +1,115 @@
+// Package signing signs web hook deliveries, and verifies them for receivers. Each delivery is signed with the secret of
+// its hook, over the delivery timestamp and the request body, so receivers can check it was sent by machinable and
+// reject old deliveries which are replayed.
+//
+//	func handle(w http.ResponseWriter, r *http.Request) {
+//		body, _ := ioutil.ReadAll(r.Body)
+//		if err := signing.Verify(secret, r.Header, body, signing.DefaultTolerance); err != nil {
+//			http.Error(w, err.Error(), http.StatusUnauthorized)
+//			return
+//		}
+//		...
+//	}
+package signing
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// HeaderTimestamp is the header of the time a delivery was signed, in unix seconds
+	HeaderTimestamp = "X-Machinable-Timestamp"
+	// HeaderSignature is the header of the signature of a delivery, as `v1=<hex encoded HMAC-SHA256>`
+	HeaderSignature = "X-Machinable-Signature"
+)
+
+// signatureVersion prefixes the signatures of the current scheme
+const signatureVersion = "v1="
+
+// secretPrefix prefixes every secret, so they are recognizable
+const secretPrefix = "whsec_"
+
+// DefaultTolerance is how old a delivery can be before it is rejected as a replay
+const DefaultTolerance = 5 * time.Minute
+
+var (
+	// ErrMissingHeaders is returned for requests without a timestamp or signature
+	ErrMissingHeaders = errors.New("missing signature headers")
+	// ErrInvalidTimestamp is returned for timestamps which are not unix seconds
+	ErrInvalidTimestamp = errors.New("invalid signature timestamp")
+	// ErrExpired is returned for deliveries signed outside of the tolerance
+	ErrExpired = errors.New("signature timestamp is outside of the tolerance")
+	// ErrInvalidSignature is returned if no signature matches the body
+	ErrInvalidSignature = errors.New("invalid signature")
+)
+
+// NewSecret returns a new random signing secret
+func NewSecret() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return secretPrefix + hex.EncodeToString(b), nil
+}
+
+// Sign returns the signature of the body sent at the timestamp, the value of the `HeaderSignature` header
+func Sign(secret string, timestamp int64, body []byte) string {
+	return signatureVersion + hex.EncodeToString(mac(secret, timestamp, body))
+}
+
+// SetHeaders signs the body at the current time and sets the timestamp and signature headers
+func SetHeaders(header http.Header, secret string, body []byte) {
+	timestamp := time.Now().Unix()
+	header.Set(HeaderTimestamp, strconv.FormatInt(timestamp, 10))
+	header.Set(HeaderSignature, Sign(secret, timestamp, body))
+}
+
+// Verify checks the signature headers of a delivery against its raw body. Deliveries signed more than `tolerance` from
+// now are rejected, so a captured delivery can not be replayed later. The signature header can hold several comma
+// separated signatures, any one of which can match.
+func Verify(secret string, header http.Header, body []byte, tolerance time.Duration) error {
+	ts := header.Get(HeaderTimestamp)
+	signatures := header.Get(HeaderSignature)
+	if ts == "" || signatures == "" {
+		return ErrMissingHeaders
+	}
+
+	timestamp, err := strconv.ParseInt(ts, 10, 64)
+	if err != nil {
+		return ErrInvalidTimestamp
+	}
+	age := time.Since(time.Unix(timestamp, 0))
+	if age > tolerance || age < -tolerance {
+		return ErrExpired
+	}
+
+	expected := mac(secret, timestamp, body)
+	for _, signature := range strings.Split(signatures, ",") {
+		signature = strings.TrimSpace(signature)
+		if !strings.HasPrefix(signature, signatureVersion) {
+			continue
+		}
+		sig, err := hex.DecodeString(strings.TrimPrefix(signature, signatureVersion))
+		if err == nil && hmac.Equal(sig, expected) {
+			return nil
+		}
+	}
+	return ErrInvalidSignature
+}
+
+// mac returns the HMAC-SHA256 of `<timestamp>.<body>`
+func mac(secret string, timestamp int64, body []byte) []byte {
+	h := hmac.New(sha256.New, []byte(secret))
+	h.Write([]byte(strconv.FormatInt(timestamp, 10)))
+	h.Write([]byte("."))
+	h.Write(body)
+	return h.Sum(nil)
+}
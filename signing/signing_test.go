@@ -0,0 +1,46 @@
+package signing
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewSecret(t *testing.T) {
+	a, err := NewSecret()
+	assert.Nil(t, err)
+	b, _ := NewSecret()
+	assert.True(t, strings.HasPrefix(a, "whsec_"))
+	assert.Len(t, a, len("whsec_")+64)
+	assert.NotEqual(t, a, b)
+}
+
+func TestVerify(t *testing.T) {
+	secret := "whsec_test"
+	body := []byte(`{"name": "rex"}`)
+
+	header := http.Header{}
+	SetHeaders(header, secret, body)
+	assert.Nil(t, Verify(secret, header, body, DefaultTolerance))
+	assert.Equal(t, ErrInvalidSignature, Verify("whsec_other", header, body, DefaultTolerance))
+	assert.Equal(t, ErrInvalidSignature, Verify(secret, header, []byte(`{"name": "fido"}`), DefaultTolerance))
+
+	// signatures of several secrets, i.e. while a secret is rotated
+	header.Set(HeaderSignature, "v1=00ff, "+header.Get(HeaderSignature))
+	assert.Nil(t, Verify(secret, header, body, DefaultTolerance))
+
+	old := time.Now().Add(-10 * time.Minute).Unix()
+	header.Set(HeaderTimestamp, strconv.FormatInt(old, 10))
+	header.Set(HeaderSignature, Sign(secret, old, body))
+	assert.Equal(t, ErrExpired, Verify(secret, header, body, DefaultTolerance))
+	assert.Nil(t, Verify(secret, header, body, time.Hour))
+
+	header.Set(HeaderTimestamp, "yesterday")
+	assert.Equal(t, ErrInvalidTimestamp, Verify(secret, header, body, DefaultTolerance))
+
+	assert.Equal(t, ErrMissingHeaders, Verify(secret, http.Header{}, body, DefaultTolerance))
+}
@@ -52,7 +52,7 @@ CREATE TABLE app_projects (
 );
 
 CREATE view app_project_limits AS 
-  SELECT p.*, u.id as account_id, t.requests 
+  SELECT p.*, u.id as account_id, t.requests, t.storage 
   FROM app_users as u 
   INNER JOIN app_projects as p ON p.user_id = u.id 
   INNER JOIN app_tiers as t ON u.tier_id = t.id;
@@ -123,6 +123,7 @@ CREATE TABLE project_resource_definitions_real (
     "read" BOOLEAN DEFAULT false,
     "update" BOOLEAN DEFAULT false,
     "delete" BOOLEAN DEFAULT false,
+    upsert BOOLEAN DEFAULT false,
     schema JSONB,
     created TIMESTAMP NOT NULL DEFAULT NOW(),
 
@@ -141,6 +142,19 @@ CREATE TABLE project_resource_objects_real (
 CREATE INDEX project_resource_objects_idx ON project_resource_objects_real (project_id, resource_path);
 CREATE INDEX project_resource_objects_creator_idx ON project_resource_objects_real (project_id, resource_path, creator);
 
+CREATE TABLE project_files_real (
+    id uuid DEFAULT uuid_generate_v4() PRIMARY KEY,
+    project_id uuid NOT NULL REFERENCES app_projects(id),
+    resource_path VARCHAR NOT NULL,
+    document_id uuid NOT NULL,
+    field VARCHAR NOT NULL,
+    name VARCHAR NOT NULL,
+    content_type VARCHAR NOT NULL,
+    size BIGINT NOT NULL DEFAULT 0,
+    created TIMESTAMP NOT NULL DEFAULT NOW()
+);
+CREATE INDEX project_files_idx ON project_files_real (project_id, resource_path, document_id);
+
 CREATE TABLE project_json_real(
   id uuid DEFAULT uuid_generate_v4() PRIMARY KEY,
   project_id uuid NOT NULL REFERENCES app_projects(id),
@@ -150,11 +164,26 @@ CREATE TABLE project_json_real(
   "update" BOOLEAN DEFAULT false,
   "delete" BOOLEAN DEFAULT false,
   data JSONB,
+  schema JSONB,
+  rules JSONB,
 
   UNIQUE(project_id, root_key)
 );
 CREATE INDEX project_json_idx ON project_json_real (project_id, root_key);
 
+-- snapshots are not removed with their root key, so deleted root keys can be restored
+CREATE TABLE project_json_snapshots_real(
+  id uuid DEFAULT uuid_generate_v4() PRIMARY KEY,
+  project_id uuid NOT NULL REFERENCES app_projects(id),
+  root_key VARCHAR NOT NULL,
+  reason VARCHAR NOT NULL,
+  settings JSONB,
+  data JSONB,
+  expires TIMESTAMP,
+  created TIMESTAMP NOT NULL DEFAULT NOW()
+);
+CREATE INDEX project_json_snapshots_idx ON project_json_snapshots_real (project_id, root_key, created);
+
 CREATE TYPE hook_type AS ENUM ('create', 'edit', 'delete');
 CREATE TYPE entity_type AS ENUM ('resource', 'json');
 CREATE TABLE project_webhooks_real(
@@ -163,10 +192,16 @@ CREATE TABLE project_webhooks_real(
   label VARCHAR,
   isenabled BOOLEAN DEFAULT false,
   entity entity_type,
-  entity_id uuid NOT NULL,
-  hook_event hook_type,
+  -- every resource or root key of the project if NULL
+  entity_id uuid,
+  -- JSON Pointer of the writes of a root key the hook is limited to
+  path VARCHAR NOT NULL DEFAULT '',
+  hook_events hook_type[] NOT NULL,
+  -- conditions of the payload the events must pass, see `models.MatchHookFilter`
+  filter JSONB,
   headers JSONB,
-  hook_url VARCHAR NOT NULL
+  hook_url VARCHAR NOT NULL,
+  secret VARCHAR NOT NULL DEFAULT ''
 );
 
 -- DELETE FROM project_webhook_results WHERE created < now()-'2 hours'::interval;
@@ -177,9 +212,140 @@ CREATE TABLE project_webhook_results_real(
   status_code INT NOT NULL DEFAULT -1,
   response_time INT NOT NULL DEFAULT -1,
   error_message VARCHAR,
+  request_headers JSONB,
+  request_body VARCHAR,
+  response_headers JSONB,
+  response_body VARCHAR,
   created TIMESTAMP NOT NULL DEFAULT NOW()
 );
 
+-- web hook deliveries which failed every attempt, kept with their payload and attempts until they are replayed or
+-- discarded
+CREATE TABLE project_webhook_failures_real(
+  id uuid DEFAULT uuid_generate_v4() PRIMARY KEY,
+  project_id uuid NOT NULL REFERENCES app_projects(id),
+  webhook_id uuid NOT NULL REFERENCES project_webhooks_real(id),
+  delivery_id VARCHAR NOT NULL,
+  event hook_type,
+  entity_key VARCHAR,
+  payload JSONB,
+  attempts JSONB NOT NULL DEFAULT '[]',
+  created TIMESTAMP NOT NULL DEFAULT NOW()
+);
+
+-- the append-only change log of resource documents and JSON trees, written by `notify_change`. Deletes are kept as
+-- tombstones without data. Change ids increase with every change of the project.
+CREATE TABLE project_changes_real(
+  id BIGINT NOT NULL,
+  project_id uuid NOT NULL REFERENCES app_projects(id),
+  entity VARCHAR NOT NULL,
+  entity_key VARCHAR NOT NULL,
+  document_id uuid,
+  action VARCHAR NOT NULL,
+  creator uuid,
+  data JSONB,
+  created TIMESTAMP NOT NULL DEFAULT NOW(),
+
+  PRIMARY KEY(project_id, id)
+);
+CREATE INDEX project_changes_idx ON project_changes_real (project_id, id);
+
+-- the latest change id of each project. `notify_change` increments it in the transaction of the change, which holds the
+-- lock of the row until it commits, so the changes of a project are committed in the order of their ids and a sync
+-- never skips a change committed after it read a later one.
+CREATE TABLE project_change_counters(
+  project_id uuid PRIMARY KEY REFERENCES app_projects(id),
+  id BIGINT NOT NULL
+);
+
+-- the latest tombstone of each project removed by compaction, changes since earlier ids can no longer be synced
+CREATE TABLE project_change_compactions(
+  project_id uuid PRIMARY KEY REFERENCES app_projects(id),
+  id BIGINT NOT NULL
+);
+
+/* CHANGES */
+
+-- notify_change records the changes of resource documents and JSON trees in the change log, and notifies them on the
+-- `project_changes` channel, as the entity of the first argument (`resource` or `json`). Notifications are limited to
+-- 8000 bytes, the data of larger changes is left out and marked as truncated, to be read by the listener.
+CREATE OR REPLACE FUNCTION notify_change() RETURNS trigger AS
+  $BODY$
+    DECLARE
+      change JSONB;
+      change_id BIGINT;
+      action TEXT;
+    BEGIN
+      IF TG_OP = 'INSERT' THEN
+        action := 'create';
+      ELSIF TG_OP = 'UPDATE' THEN
+        -- settings of root keys are not changes
+        IF NEW.data IS NOT DISTINCT FROM OLD.data THEN
+          RETURN NULL;
+        END IF;
+        action := 'edit';
+      ELSE
+        action := 'delete';
+      END IF;
+
+      IF TG_ARGV[0] = 'resource' THEN
+        IF TG_OP = 'DELETE' THEN
+          change := jsonb_build_object('project_id', OLD.project_id, 'entity_key', OLD.resource_path, 'document_id', OLD.id, 'creator', OLD.creator);
+        ELSE
+          change := jsonb_build_object(
+            'project_id', NEW.project_id,
+            'entity_key', NEW.resource_path,
+            'document_id', NEW.id,
+            'creator', NEW.creator,
+            'data', COALESCE(NEW.data, '{}'::jsonb) || jsonb_build_object(
+              'id', NEW.id,
+              '_metadata', jsonb_build_object('creator', NEW.creator, 'creator_type', NEW.creator_type, 'created', extract(epoch from NEW.created)::bigint)
+            )
+          );
+        END IF;
+      ELSE
+        IF TG_OP = 'DELETE' THEN
+          change := jsonb_build_object('project_id', OLD.project_id, 'entity_key', OLD.root_key);
+        ELSE
+          change := jsonb_build_object('project_id', NEW.project_id, 'entity_key', NEW.root_key, 'data', NEW.data);
+        END IF;
+      END IF;
+
+      -- the first change of a project continues from its changes recorded before the counter
+      INSERT INTO project_change_counters (project_id, id)
+      VALUES (
+        (change->>'project_id')::uuid,
+        (SELECT COALESCE(MAX(id), 0) + 1 FROM project_changes_real WHERE project_id = (change->>'project_id')::uuid)
+      )
+      ON CONFLICT (project_id) DO UPDATE SET id = project_change_counters.id + 1
+      RETURNING id INTO change_id;
+
+      change := change || jsonb_build_object('id', change_id, 'entity', TG_ARGV[0], 'action', action, 'created', NOW());
+
+      INSERT INTO project_changes (id, project_id, entity, entity_key, document_id, action, creator, data, created)
+      VALUES (
+        (change->>'id')::bigint,
+        (change->>'project_id')::uuid,
+        TG_ARGV[0],
+        change->>'entity_key',
+        (change->>'document_id')::uuid,
+        action,
+        (change->>'creator')::uuid,
+        change->'data',
+        NOW()
+      );
+
+      IF octet_length(change::text) > 7900 THEN
+        change := (change - 'data') || jsonb_build_object('truncated', true);
+      END IF;
+
+      PERFORM pg_notify('project_changes', change::text);
+      RETURN NULL;
+    END;
+  $BODY$
+LANGUAGE plpgsql VOLATILE
+COST 100;
+
 /* PARTITIONING */
 
 CREATE OR REPLACE FUNCTION create_partition_and_insert() RETURNS trigger AS
@@ -191,6 +357,12 @@ CREATE OR REPLACE FUNCTION create_partition_and_insert() RETURNS trigger AS
       IF NOT EXISTS(SELECT relname FROM pg_class WHERE relname=partition) THEN
         RAISE NOTICE 'A partition has been created %',partition;
         EXECUTE 'CREATE TABLE ' || partition || ' (check (project_id = ''' || NEW.project_id || ''')) INHERITS (' || TG_RELNAME || '_real' || ');';
+        -- row triggers of the parent table do not fire for partitions, so each partition notifies its changes
+        IF TG_RELNAME = 'project_resource_objects' THEN
+          EXECUTE 'CREATE TRIGGER notify_change AFTER INSERT OR UPDATE OR DELETE ON ' || partition || ' FOR EACH ROW EXECUTE PROCEDURE notify_change(''resource'');';
+        ELSIF TG_RELNAME = 'project_json' THEN
+          EXECUTE 'CREATE TRIGGER notify_change AFTER INSERT OR UPDATE OR DELETE ON ' || partition || ' FOR EACH ROW EXECUTE PROCEDURE notify_change(''json'');';
+        END IF;
       END IF;
       EXECUTE 'INSERT INTO ' || partition || ' SELECT(' || TG_RELNAME || ' ' || quote_literal(NEW) || ').* RETURNING id;';
       RETURN NEW;
@@ -213,6 +385,13 @@ CREATE TRIGGER project_resource_objects_insert_trigger
 INSTEAD OF INSERT ON project_resource_objects
 FOR EACH ROW EXECUTE PROCEDURE create_partition_and_insert();
 
+/* project_files */
+CREATE view project_files as select * from project_files_real;
+ALTER view project_files ALTER column id set DEFAULT uuid_generate_v4();
+CREATE TRIGGER project_files_insert_trigger
+INSTEAD OF INSERT ON project_files
+FOR EACH ROW EXECUTE PROCEDURE create_partition_and_insert();
+
 /* project_json */
 CREATE view project_json as select * from project_json_real;
 ALTER view project_json ALTER column id set DEFAULT uuid_generate_v4();
@@ -224,6 +403,19 @@ CREATE TRIGGER project_json
 INSTEAD OF INSERT ON project_json
 FOR EACH ROW EXECUTE PROCEDURE create_partition_and_insert();
 
+/* project_json_snapshots */
+CREATE view project_json_snapshots as select * from project_json_snapshots_real;
+ALTER view project_json_snapshots ALTER column id set DEFAULT uuid_generate_v4();
+CREATE TRIGGER project_json_snapshots_insert_trigger
+INSTEAD OF INSERT ON project_json_snapshots
+FOR EACH ROW EXECUTE PROCEDURE create_partition_and_insert();
+
+/* project_changes */
+CREATE view project_changes as select * from project_changes_real;
+CREATE TRIGGER project_changes_insert_trigger
+INSTEAD OF INSERT ON project_changes
+FOR EACH ROW EXECUTE PROCEDURE create_partition_and_insert();
+
 /* project_apikeys */
 CREATE view project_apikeys as select * from project_apikeys_real;
 ALTER view project_apikeys ALTER column id set DEFAULT uuid_generate_v4();
@@ -256,6 +448,7 @@ FOR EACH ROW EXECUTE PROCEDURE create_partition_and_insert();
 CREATE view project_webhooks as select * from project_webhooks_real;
 ALTER view project_webhooks ALTER column id set DEFAULT uuid_generate_v4();
 ALTER view project_webhooks ALTER column isenabled set DEFAULT false;
+ALTER view project_webhooks ALTER column path set DEFAULT '';
 CREATE TRIGGER project_webhooks_insert_trigger
 INSTEAD OF INSERT ON project_webhooks
 FOR EACH ROW EXECUTE PROCEDURE create_partition_and_insert();
@@ -266,3 +459,11 @@ ALTER view project_webhook_results ALTER column id set DEFAULT uuid_generate_v4(
 CREATE TRIGGER project_webhook_results_insert_trigger
 INSTEAD OF INSERT ON project_webhook_results
 FOR EACH ROW EXECUTE PROCEDURE create_partition_and_insert();
+
+/* project_webhook_failures */
+CREATE view project_webhook_failures as select * from project_webhook_failures_real;
+ALTER view project_webhook_failures ALTER column id set DEFAULT uuid_generate_v4();
+ALTER view project_webhook_failures ALTER column attempts set DEFAULT '[]';
+CREATE TRIGGER project_webhook_failures_insert_trigger
+INSTEAD OF INSERT ON project_webhook_failures
+FOR EACH ROW EXECUTE PROCEDURE create_partition_and_insert();
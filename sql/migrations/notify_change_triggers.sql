@@ -0,0 +1,25 @@
+/* NOTIFY CHANGE TRIGGERS */
+
+-- Partitions of resource documents and JSON trees created before `create_partition_and_insert` created the
+-- `notify_change` trigger with each partition never notify their changes or write them to the change log. This attaches
+-- the trigger to every existing partition which does not have it, and can be run more than once. The `notify_change`
+-- function and the change log tables of ../create.sql must exist.
+DO
+  $BODY$
+    DECLARE
+      partition RECORD;
+    BEGIN
+      FOR partition IN
+        SELECT child.oid, child.relname AS name, CASE parent.relname WHEN 'project_resource_objects_real' THEN 'resource' ELSE 'json' END AS entity
+        FROM pg_inherits
+        JOIN pg_class child ON child.oid = pg_inherits.inhrelid
+        JOIN pg_class parent ON parent.oid = pg_inherits.inhparent
+        WHERE parent.relname IN ('project_resource_objects_real', 'project_json_real')
+      LOOP
+        IF NOT EXISTS(SELECT 1 FROM pg_trigger WHERE tgrelid = partition.oid AND tgname = 'notify_change') THEN
+          RAISE NOTICE 'A notify_change trigger has been created %',partition.name;
+          EXECUTE 'CREATE TRIGGER notify_change AFTER INSERT OR UPDATE OR DELETE ON ' || quote_ident(partition.name) || ' FOR EACH ROW EXECUTE PROCEDURE notify_change(''' || partition.entity || ''');';
+        END IF;
+      END LOOP;
+    END;
+  $BODY$;
@@ -0,0 +1,96 @@
+package storage
+
+import (
+	"errors"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// NewLocal returns a pointer to a new `Local` backend, storing files under the `root` directory
+func NewLocal(root string) *Local {
+	return &Local{root: root}
+}
+
+// Local is a `Backend` which stores files on the local filesystem
+type Local struct {
+	root string
+}
+
+// path returns the filesystem path of the key, keys can not reference files outside of the root directory
+func (l *Local) path(key string) (string, error) {
+	cleaned := filepath.Clean("/" + key)
+	if cleaned == "/" || strings.Contains(key, "..") {
+		return "", errors.New("invalid file key")
+	}
+	return filepath.Join(l.root, filepath.FromSlash(cleaned)), nil
+}
+
+// Put writes the contents of the reader to the file of the key, replacing the file if it exists
+func (l *Local) Put(key string, r io.Reader) (int64, error) {
+	path, err := l.path(key)
+	if err != nil {
+		return 0, err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return 0, err
+	}
+
+	// write to a temporary file first so readers never see a partial file
+	tmp, err := ioutil.TempFile(filepath.Dir(path), ".upload-")
+	if err != nil {
+		return 0, err
+	}
+	defer os.Remove(tmp.Name())
+
+	size, err := io.Copy(tmp, r)
+	if err != nil {
+		tmp.Close()
+		return 0, err
+	}
+	if err := tmp.Close(); err != nil {
+		return 0, err
+	}
+
+	return size, os.Rename(tmp.Name(), path)
+}
+
+// Get opens the file of the key
+func (l *Local) Get(key string) (io.ReadCloser, error) {
+	path, err := l.path(key)
+	if err != nil {
+		return nil, err
+	}
+
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return nil, ErrNotFound
+	}
+	return f, err
+}
+
+// Delete removes the file of the key
+func (l *Local) Delete(key string) error {
+	path, err := l.path(key)
+	if err != nil {
+		return err
+	}
+
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+// DeleteAll removes the directory of the key prefix
+func (l *Local) DeleteAll(prefix string) error {
+	path, err := l.path(prefix)
+	if err != nil {
+		return err
+	}
+
+	return os.RemoveAll(path)
+}
@@ -0,0 +1,42 @@
+package storage
+
+import (
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLocal(t *testing.T) {
+	root, err := ioutil.TempDir("", "machinable-files")
+	assert.Nil(t, err)
+	defer os.RemoveAll(root)
+
+	backend := NewLocal(root)
+
+	size, err := backend.Put("project/dogs/1/a", strings.NewReader("hello"))
+	assert.Nil(t, err)
+	assert.Equal(t, int64(5), size)
+
+	r, err := backend.Get("project/dogs/1/a")
+	assert.Nil(t, err)
+	b, _ := ioutil.ReadAll(r)
+	r.Close()
+	assert.Equal(t, "hello", string(b))
+
+	_, err = backend.Put("../outside", strings.NewReader("x"))
+	assert.NotNil(t, err)
+
+	assert.Nil(t, backend.Delete("project/dogs/1/a"))
+	assert.Nil(t, backend.Delete("project/dogs/1/a"))
+	_, err = backend.Get("project/dogs/1/a")
+	assert.Equal(t, ErrNotFound, err)
+
+	_, err = backend.Put("project/dogs/2/b", strings.NewReader("x"))
+	assert.Nil(t, err)
+	assert.Nil(t, backend.DeleteAll("project/dogs"))
+	_, err = backend.Get("project/dogs/2/b")
+	assert.Equal(t, ErrNotFound, err)
+}
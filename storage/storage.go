@@ -0,0 +1,24 @@
+package storage
+
+import (
+	"errors"
+	"io"
+)
+
+// ErrNotFound is returned when the file of a key does not exist
+var ErrNotFound = errors.New("file not found")
+
+// Backend stores the contents of files attached to resource documents. Keys are slash separated paths, so the files
+// of a project, resource or document can be deleted together by their key prefix.
+// implemented backends: local filesystem
+// potential backends: S3, GCS, etc.
+type Backend interface {
+	// Put stores the contents of the reader, returning the number of bytes written
+	Put(key string, r io.Reader) (int64, error)
+	// Get returns a reader of the contents of the file, `ErrNotFound` if it does not exist
+	Get(key string) (io.ReadCloser, error)
+	// Delete removes the file, it is not an error if the file does not exist
+	Delete(key string) error
+	// DeleteAll removes every file with the key prefix
+	DeleteAll(prefix string) error
+}